@@ -0,0 +1,472 @@
+package client
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+)
+
+// Client of a chord ring's data APIs. It learns the ring from its seed nodes, sends each key straight
+// to the node owning it, and refreshes its view of the ring whenever a node redirects a request or
+// cannot be reached. A Client is safe for concurrent use.
+
+const (
+	HTTP = "http"
+	GRPC = "grpc"
+)
+
+const DefaultHTTPPort int = 8080
+const DefaultGRPCPort int = 8081
+
+// Attempts per request, each after a redirect or a refresh of the ring.
+const maxAttempts int = 3
+const watchRetryDelay time.Duration = 1 * time.Second
+
+var (
+	ErrNotFound           = errors.New("key not found")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrNoNodes            = errors.New("no reachable node")
+)
+
+// A node could not be reached; the ring is refreshed and the request retried.
+var errUnavailable = errors.New("node unavailable")
+
+// A node answered that another node owns the key.
+type redirectError struct {
+	owner string
+}
+
+func (err *redirectError) Error() string {
+	return "redirected to " + err.owner
+}
+
+type Options struct {
+	// Addresses (without port) of nodes to learn the ring from.
+	Seeds []string
+	// HTTP (the default) or GRPC.
+	Transport string
+	HTTPPort  int
+	GRPCPort  int
+	// Timeout of each call to a node; 0 for none besides the caller's context.
+	Timeout time.Duration
+}
+
+type Value struct {
+	Data        []byte
+	ContentType string
+	// Set by the node that stored the value; also its ETag.
+	Version uint64
+	// Zero for a value that never expires.
+	ExpiresAt time.Time
+}
+
+type PutOptions struct {
+	// Expire the value after TTL; 0 for a value that never expires.
+	TTL time.Duration
+	// Write only if the stored version is IfMatch.
+	IfMatch uint64
+	// Write only if the key does not exist.
+	IfAbsent bool
+}
+
+type DeleteOptions struct {
+	// Delete only if the stored version is IfMatch.
+	IfMatch uint64
+}
+
+// Event types reported by Watch.
+const (
+	EventPut    = "put"
+	EventDelete = "delete"
+	EventExpire = "expire"
+	EventEvict  = "evict"
+)
+
+type Event struct {
+	Type    string
+	Key     string
+	Version uint64
+	// nil except for puts.
+	Value *Value
+}
+
+type WatchOptions struct {
+	// Watch every key starting with the watched key.
+	Prefix bool
+	// Skip changes at or before this version.
+	Since uint64
+}
+
+type transport interface {
+	ring(ctx context.Context, node string) (*pb.Ring, error)
+	get(ctx context.Context, node string, key string) (Value, error)
+	put(ctx context.Context, node string, key string, value Value, options PutOptions) (uint64, error)
+	remove(ctx context.Context, node string, key string, options DeleteOptions) error
+	batchGet(ctx context.Context, node string, keys []string) (map[string]Value, error)
+	batchPut(ctx context.Context, node string, values map[string]Value) (map[string]uint64, error)
+	// Stream events to visit until the stream or ctx ends.
+	watch(ctx context.Context, node string, key string, options WatchOptions, visit func(Event)) error
+	close() error
+}
+
+type Client struct {
+	transport transport
+	seeds     []string
+	timeout   time.Duration
+
+	ringMux  sync.RWMutex
+	capacity uint64
+	// Node IDs in ascending order and the node with each ID: a key belongs to the first ID at or after its hash.
+	ids   []uint64
+	nodes []string
+}
+
+// Connect to a ring through its seed nodes and learn its topology.
+func New(ctx context.Context, options Options) (*Client, error) {
+	if len(options.Seeds) == 0 {
+		return nil, fmt.Errorf("no seed nodes")
+	}
+
+	if options.HTTPPort == 0 {
+		options.HTTPPort = DefaultHTTPPort
+	}
+	if options.GRPCPort == 0 {
+		options.GRPCPort = DefaultGRPCPort
+	}
+
+	client := &Client{seeds: options.Seeds, timeout: options.Timeout}
+
+	switch options.Transport {
+	case HTTP, "":
+		client.transport = newHTTPTransport(options.HTTPPort)
+	case GRPC:
+		client.transport = newGRPCTransport(options.GRPCPort)
+	default:
+		return nil, fmt.Errorf("unknown transport %q (expected http or grpc)", options.Transport)
+	}
+
+	if err := client.Refresh(ctx); err != nil {
+		client.transport.close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (client *Client) Close() error {
+	return client.transport.close()
+}
+
+// Relearn the ring from the first known node (or seed) that answers.
+func (client *Client) Refresh(ctx context.Context) error {
+	client.ringMux.RLock()
+	candidates := append(slices.Clone(client.nodes), client.seeds...)
+	client.ringMux.RUnlock()
+
+	err := ErrNoNodes
+	for _, node := range candidates {
+		err = client.learn(ctx, node)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
+
+// Replace the cached ring with the one node walks.
+func (client *Client) learn(ctx context.Context, node string) error {
+	callCtx, cancel := client.callContext(ctx)
+	defer cancel()
+
+	ring, err := client.transport.ring(callCtx, node)
+	if err != nil {
+		return err
+	}
+
+	if ring.Capacity == 0 {
+		return fmt.Errorf("%s did not report the ring's capacity", node)
+	}
+
+	ids := make([]uint64, 0, len(ring.Nodes))
+	nodes := make(map[uint64]string)
+
+	for _, ringNode := range ring.Nodes {
+		if !ringNode.Reachable || ringNode.Info == nil {
+			continue
+		}
+
+		if _, duplicate := nodes[ringNode.Info.Id]; !duplicate {
+			ids = append(ids, ringNode.Info.Id)
+		}
+		nodes[ringNode.Info.Id] = ringNode.Info.Ip
+	}
+
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: %s knows no reachable nodes", ErrNoNodes, node)
+	}
+
+	slices.Sort(ids)
+
+	client.ringMux.Lock()
+	defer client.ringMux.Unlock()
+
+	client.capacity = ring.Capacity
+	client.ids = ids
+	client.nodes = make([]string, len(ids))
+	for i, id := range ids {
+		client.nodes[i] = nodes[id]
+	}
+
+	return nil
+}
+
+// Must match the overlay's placement of keys on the ring.
+func hash(key string, capacity uint64) uint64 {
+	hashBytes := sha1.Sum([]byte(key))
+	return binary.BigEndian.Uint64(hashBytes[12:]) % (1 << capacity)
+}
+
+// The node owning key according to the cached ring.
+func (client *Client) owner(key string) string {
+	client.ringMux.RLock()
+	defer client.ringMux.RUnlock()
+
+	keyHash := hash(key, client.capacity)
+	i, _ := slices.BinarySearch(client.ids, keyHash)
+	if i == len(client.ids) {
+		i = 0
+	}
+	return client.nodes[i]
+}
+
+func (client *Client) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if client.timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, client.timeout)
+}
+
+// Call the owner of key, following redirects and refreshing the ring when a node cannot be reached.
+func (client *Client) do(ctx context.Context, key string, call func(ctx context.Context, node string) error) error {
+	node := client.owner(key)
+
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		callCtx, cancel := client.callContext(ctx)
+		err = call(callCtx, node)
+		cancel()
+
+		node, err = client.retryNode(ctx, key, err)
+		if node == "" {
+			return err
+		}
+	}
+
+	return err
+}
+
+// The node to retry a failed call with, or "" if err is final.
+func (client *Client) retryNode(ctx context.Context, key string, err error) (string, error) {
+	var redirect *redirectError
+	switch {
+	case err == nil || ctx.Err() != nil:
+		return "", err
+	case errors.As(err, &redirect):
+		go client.Refresh(context.WithoutCancel(ctx))
+		return redirect.owner, err
+	case errors.Is(err, errUnavailable):
+		if refreshErr := client.Refresh(ctx); refreshErr != nil {
+			return "", errors.Join(err, refreshErr)
+		}
+		return client.owner(key), err
+	}
+
+	return "", err
+}
+
+func (client *Client) Get(ctx context.Context, key string) (Value, error) {
+	var value Value
+	err := client.do(ctx, key, func(ctx context.Context, node string) error {
+		var err error
+		value, err = client.transport.get(ctx, node, key)
+		return err
+	})
+	return value, err
+}
+
+// Store a value, returning its new version.
+func (client *Client) Put(ctx context.Context, key string, value Value, options PutOptions) (uint64, error) {
+	var version uint64
+	err := client.do(ctx, key, func(ctx context.Context, node string) error {
+		var err error
+		version, err = client.transport.put(ctx, node, key, value, options)
+		return err
+	})
+	return version, err
+}
+
+func (client *Client) Delete(ctx context.Context, key string, options DeleteOptions) error {
+	return client.do(ctx, key, func(ctx context.Context, node string) error {
+		return client.transport.remove(ctx, node, key, options)
+	})
+}
+
+// Values of the keys that exist, fetched from each owner in parallel. Keys that could not be read are
+// reported in the error, alongside the values that could.
+func (client *Client) BatchGet(ctx context.Context, keys []string) (map[string]Value, error) {
+	values := make(map[string]Value)
+	var valuesMux sync.Mutex
+
+	err := client.batch(ctx, keys, func(ctx context.Context, node string, keys []string) error {
+		nodeValues, err := client.transport.batchGet(ctx, node, keys)
+		if err != nil {
+			return err
+		}
+
+		valuesMux.Lock()
+		defer valuesMux.Unlock()
+		for key, value := range nodeValues {
+			values[key] = value
+		}
+		return nil
+	})
+
+	return values, err
+}
+
+// Store values with each owner in parallel, returning their new versions. Keys that could not be written
+// are reported in the error, alongside the versions of those that were.
+func (client *Client) BatchPut(ctx context.Context, values map[string]Value) (map[string]uint64, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	versions := make(map[string]uint64)
+	var versionsMux sync.Mutex
+
+	err := client.batch(ctx, keys, func(ctx context.Context, node string, keys []string) error {
+		batch := make(map[string]Value, len(keys))
+		for _, key := range keys {
+			batch[key] = values[key]
+		}
+
+		nodeVersions, err := client.transport.batchPut(ctx, node, batch)
+		if err != nil {
+			return err
+		}
+
+		versionsMux.Lock()
+		defer versionsMux.Unlock()
+		for key, version := range nodeVersions {
+			versions[key] = version
+		}
+		return nil
+	})
+
+	return versions, err
+}
+
+// Group keys by owner and call each owner in parallel, retrying the keys of redirected or unreachable
+// owners against a refreshed ring.
+func (client *Client) batch(ctx context.Context, keys []string, call func(ctx context.Context, node string, keys []string) error) error {
+	pending := keys
+	var errs []error
+
+	for attempt := 0; attempt < maxAttempts && len(pending) > 0; attempt++ {
+		keysByOwner := make(map[string][]string)
+		for _, key := range pending {
+			owner := client.owner(key)
+			keysByOwner[owner] = append(keysByOwner[owner], key)
+		}
+
+		pending = nil
+		errs = nil
+		var resultsMux sync.Mutex
+		var wg sync.WaitGroup
+
+		for owner, ownerKeys := range keysByOwner {
+			wg.Add(1)
+			go func(owner string, ownerKeys []string) {
+				defer wg.Done()
+
+				callCtx, cancel := client.callContext(ctx)
+				err := call(callCtx, owner, ownerKeys)
+				cancel()
+
+				if err == nil {
+					return
+				}
+
+				resultsMux.Lock()
+				defer resultsMux.Unlock()
+
+				var redirect *redirectError
+				if ctx.Err() == nil && (errors.As(err, &redirect) || errors.Is(err, errUnavailable)) {
+					pending = append(pending, ownerKeys...)
+				}
+				errs = append(errs, fmt.Errorf("%s (%d keys): %w", owner, len(ownerKeys), err))
+			}(owner, ownerKeys)
+		}
+		wg.Wait()
+
+		if len(pending) > 0 {
+			if err := client.Refresh(ctx); err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Follow changes to key (or with options.Prefix, to every key it prefixes) until ctx ends. The stream is
+// resumed from the last version seen whenever its node fails; the channel is closed when ctx ends.
+func (client *Client) Watch(ctx context.Context, key string, options WatchOptions) (<-chan Event, error) {
+	if key == "" && !options.Prefix {
+		return nil, fmt.Errorf("no key to watch")
+	}
+
+	events := make(chan Event, 64)
+
+	go func() {
+		defer close(events)
+
+		for ctx.Err() == nil {
+			err := client.transport.watch(ctx, client.owner(key), key, options, func(event Event) {
+				options.Since = max(options.Since, event.Version)
+				select {
+				case events <- event:
+				case <-ctx.Done():
+				}
+			})
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if errors.Is(err, errUnavailable) {
+				client.Refresh(ctx)
+			}
+
+			select {
+			case <-time.After(watchRetryDelay):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return events, nil
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+
+	pb "github.com/girivad/go-chord/Proto"
+)
+
+const testCapacity uint64 = 8
+
+// A transport over canned rings and a get handler; the other calls are unused.
+type fakeTransport struct {
+	mux sync.Mutex
+	// Returned by successive ring calls; the last one repeats.
+	rings     []*pb.Ring
+	ringCalls int
+	onGet     func(node string, key string) (Value, error)
+	gets      []string
+}
+
+func (transport *fakeTransport) ring(ctx context.Context, node string) (*pb.Ring, error) {
+	transport.mux.Lock()
+	defer transport.mux.Unlock()
+
+	ring := transport.rings[min(transport.ringCalls, len(transport.rings)-1)]
+	transport.ringCalls++
+	return ring, nil
+}
+
+func (transport *fakeTransport) get(ctx context.Context, node string, key string) (Value, error) {
+	transport.mux.Lock()
+	transport.gets = append(transport.gets, node)
+	transport.mux.Unlock()
+
+	return transport.onGet(node, key)
+}
+
+func (transport *fakeTransport) put(ctx context.Context, node string, key string, value Value, options PutOptions) (uint64, error) {
+	return 0, errors.New("unused")
+}
+
+func (transport *fakeTransport) remove(ctx context.Context, node string, key string, options DeleteOptions) error {
+	return errors.New("unused")
+}
+
+func (transport *fakeTransport) batchGet(ctx context.Context, node string, keys []string) (map[string]Value, error) {
+	return nil, errors.New("unused")
+}
+
+func (transport *fakeTransport) batchPut(ctx context.Context, node string, values map[string]Value) (map[string]uint64, error) {
+	return nil, errors.New("unused")
+}
+
+func (transport *fakeTransport) watch(ctx context.Context, node string, key string, options WatchOptions, visit func(Event)) error {
+	return errors.New("unused")
+}
+
+func (transport *fakeTransport) close() error {
+	return nil
+}
+
+// A ring of reachable nodes by ID.
+func testRing(nodes map[uint64]string) *pb.Ring {
+	ring := &pb.Ring{Capacity: testCapacity, Complete: true}
+	for id, ip := range nodes {
+		ring.Nodes = append(ring.Nodes, &pb.RingNode{Ip: ip, Reachable: true, Info: &pb.NodeInfo{Id: id, Ip: ip}})
+	}
+	return ring
+}
+
+func newTestClient(t *testing.T, transport *fakeTransport) *Client {
+	t.Helper()
+
+	client := &Client{transport: transport, seeds: []string{"seed"}}
+	if err := client.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// A key whose hash is keyHash.
+func keyAt(t *testing.T, keyHash uint64) string {
+	t.Helper()
+
+	for i := 0; i < 1<<16; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if hash(key, testCapacity) == keyHash {
+			return key
+		}
+	}
+	t.Fatalf("no key hashes to %d", keyHash)
+	return ""
+}
+
+func TestOwnerWraparound(t *testing.T) {
+	client := newTestClient(t, &fakeTransport{rings: []*pb.Ring{testRing(map[uint64]string{10: "a", 100: "b", 200: "c"})}})
+
+	for _, test := range []struct {
+		keyHash uint64
+		owner   string
+	}{
+		{0, "a"},
+		{10, "a"},
+		{11, "b"},
+		{100, "b"},
+		{150, "c"},
+		{200, "c"},
+		// Past the last node, keys wrap around to the first.
+		{201, "a"},
+		{255, "a"},
+	} {
+		if owner := client.owner(keyAt(t, test.keyHash)); owner != test.owner {
+			t.Errorf("hash %d is owned by %s, want %s", test.keyHash, owner, test.owner)
+		}
+	}
+}
+
+func TestLearnRing(t *testing.T) {
+	ring := testRing(map[uint64]string{10: "a", 100: "b"})
+	ring.Nodes = append(ring.Nodes, &pb.RingNode{Ip: "dead"})
+
+	client := newTestClient(t, &fakeTransport{rings: []*pb.Ring{ring}})
+
+	if client.capacity != testCapacity {
+		t.Errorf("capacity %d, want %d", client.capacity, testCapacity)
+	}
+	if !slices.Equal(client.nodes, []string{"a", "b"}) {
+		t.Errorf("nodes %v, want [a b] without the unreachable node", client.nodes)
+	}
+
+	// A ring that does not report its capacity cannot place keys.
+	client = &Client{transport: &fakeTransport{rings: []*pb.Ring{{Nodes: ring.Nodes}}}, seeds: []string{"seed"}}
+	if err := client.Refresh(context.Background()); err == nil {
+		t.Error("learned a ring without a capacity")
+	}
+}
+
+func TestDoFollowsRedirect(t *testing.T) {
+	transport := &fakeTransport{rings: []*pb.Ring{testRing(map[uint64]string{255: "a"})}}
+	transport.onGet = func(node string, key string) (Value, error) {
+		if node == "a" {
+			return Value{}, &redirectError{owner: "b"}
+		}
+		return Value{Data: []byte(node)}, nil
+	}
+
+	client := newTestClient(t, transport)
+
+	value, err := client.Get(context.Background(), "key")
+	if err != nil || string(value.Data) != "b" {
+		t.Fatalf("Get returned %q, %v, want the value from b", value.Data, err)
+	}
+	if !slices.Equal(transport.gets, []string{"a", "b"}) {
+		t.Fatalf("called %v, want [a b]", transport.gets)
+	}
+}
+
+func TestDoRefreshesUnavailableNode(t *testing.T) {
+	// a leaves the ring after the client first learns it.
+	transport := &fakeTransport{rings: []*pb.Ring{
+		testRing(map[uint64]string{255: "a"}),
+		testRing(map[uint64]string{255: "b"}),
+	}}
+	transport.onGet = func(node string, key string) (Value, error) {
+		if node == "a" {
+			return Value{}, errUnavailable
+		}
+		return Value{Data: []byte(node)}, nil
+	}
+
+	client := newTestClient(t, transport)
+
+	value, err := client.Get(context.Background(), "key")
+	if err != nil || string(value.Data) != "b" {
+		t.Fatalf("Get returned %q, %v, want the value from b", value.Data, err)
+	}
+	if !slices.Equal(transport.gets, []string{"a", "b"}) {
+		t.Fatalf("called %v, want [a b]", transport.gets)
+	}
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	transport := &fakeTransport{rings: []*pb.Ring{testRing(map[uint64]string{255: "a"})}}
+	transport.onGet = func(node string, key string) (Value, error) {
+		return Value{}, &redirectError{owner: "a"}
+	}
+
+	client := newTestClient(t, transport)
+
+	var redirect *redirectError
+	if _, err := client.Get(context.Background(), "key"); !errors.As(err, &redirect) {
+		t.Fatalf("Get returned %v, want the last redirect", err)
+	}
+	if len(transport.gets) != maxAttempts {
+		t.Fatalf("called %d times, want %d", len(transport.gets), maxAttempts)
+	}
+}
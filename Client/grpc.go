@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// The nodes' gRPC KV, Topology and Watch services. Connections are kept per node until Close.
+
+type grpcTransport struct {
+	port     int
+	connsMux sync.Mutex
+	conns    map[string]*grpc.ClientConn
+}
+
+func newGRPCTransport(port int) *grpcTransport {
+	return &grpcTransport{port: port, conns: make(map[string]*grpc.ClientConn)}
+}
+
+func (transport *grpcTransport) conn(node string) (*grpc.ClientConn, error) {
+	transport.connsMux.Lock()
+	defer transport.connsMux.Unlock()
+
+	if conn, found := transport.conns[node]; found {
+		return conn, nil
+	}
+
+	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", node, transport.port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+
+	transport.conns[node] = conn
+	return conn, nil
+}
+
+// Translate a status into the Client's errors: an ABORTED status naming the owner is a redirect.
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.OK:
+		return nil
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.FailedPrecondition:
+		return ErrPreconditionFailed
+	case codes.Unavailable:
+		return fmt.Errorf("%w: %v", errUnavailable, err)
+	case codes.Aborted:
+		for _, detail := range status.Convert(err).Details() {
+			if hint, ok := detail.(*pb.OwnerHint); ok {
+				return &redirectError{owner: hint.Owner}
+			}
+		}
+	}
+	return err
+}
+
+func (transport *grpcTransport) ring(ctx context.Context, node string) (*pb.Ring, error) {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := pb.NewTopologyClient(conn).RingWalk(ctx, &emptypb.Empty{})
+	return ring, grpcError(err)
+}
+
+func valueFromProto(value *pb.Value) Value {
+	clientValue := Value{Data: value.Data, ContentType: value.ContentType, Version: value.Version}
+	if value.ExpiresAt != 0 {
+		clientValue.ExpiresAt = time.Unix(0, value.ExpiresAt)
+	}
+	return clientValue
+}
+
+func valueToProto(value Value) *pb.Value {
+	protoValue := &pb.Value{Data: value.Data, ContentType: value.ContentType}
+	if protoValue.ContentType == "" {
+		protoValue.ContentType = "application/octet-stream"
+	}
+	if !value.ExpiresAt.IsZero() {
+		protoValue.ExpiresAt = value.ExpiresAt.UnixNano()
+	}
+	return protoValue
+}
+
+func (transport *grpcTransport) get(ctx context.Context, node string, key string) (Value, error) {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return Value{}, err
+	}
+
+	value, err := pb.NewKVClient(conn).Get(ctx, &pb.KVKey{Key: key})
+	if err != nil {
+		return Value{}, grpcError(err)
+	}
+	return valueFromProto(value), nil
+}
+
+func (transport *grpcTransport) put(ctx context.Context, node string, key string, value Value, options PutOptions) (uint64, error) {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return 0, err
+	}
+
+	request := &pb.KVPutRequest{Key: key, Data: value.Data, ContentType: value.ContentType, IfVersion: options.IfMatch, IfAbsent: options.IfAbsent}
+	if options.TTL > 0 {
+		request.Ttl = durationpb.New(options.TTL)
+	}
+
+	result, err := pb.NewKVClient(conn).Put(ctx, request)
+	if err != nil {
+		return 0, grpcError(err)
+	}
+	return result.Version, nil
+}
+
+func (transport *grpcTransport) remove(ctx context.Context, node string, key string, options DeleteOptions) error {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return err
+	}
+
+	_, err = pb.NewKVClient(conn).Delete(ctx, &pb.KVDeleteRequest{Key: key, IfVersion: options.IfMatch})
+	return grpcError(err)
+}
+
+func (transport *grpcTransport) batchGet(ctx context.Context, node string, keys []string) (map[string]Value, error) {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := pb.NewKVClient(conn).BatchGet(ctx, &pb.KVBatchGetRequest{Keys: keys})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	values := make(map[string]Value, len(response.Values))
+	for key, value := range response.Values {
+		values[key] = valueFromProto(value)
+	}
+
+	var errs []error
+	for key, failure := range response.Errors {
+		errs = append(errs, fmt.Errorf("%q: %s", key, failure))
+	}
+
+	return values, errors.Join(errs...)
+}
+
+func (transport *grpcTransport) batchPut(ctx context.Context, node string, values map[string]Value) (map[string]uint64, error) {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &pb.KVBatchPutRequest{Values: make(map[string]*pb.Value, len(values))}
+	for key, value := range values {
+		request.Values[key] = valueToProto(value)
+	}
+
+	writeResults, err := pb.NewKVClient(conn).BatchPut(ctx, request)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	versions := make(map[string]uint64)
+	var errs []error
+	for key, result := range writeResults.Results {
+		if result.Error != "" {
+			errs = append(errs, fmt.Errorf("%q: %s", key, result.Error))
+			continue
+		}
+		versions[key] = result.Version
+	}
+
+	return versions, errors.Join(errs...)
+}
+
+func (transport *grpcTransport) watch(ctx context.Context, node string, key string, options WatchOptions, visit func(Event)) error {
+	conn, err := transport.conn(node)
+	if err != nil {
+		return err
+	}
+
+	stream, err := pb.NewWatchClient(conn).Watch(ctx, &pb.WatchRequest{Key: key, Prefix: options.Prefix, SinceVersion: options.Since})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return grpcError(err)
+		}
+
+		clientEvent := Event{Type: watchEventTypes[event.Type], Key: event.Key, Version: event.Version}
+		if event.Type == pb.WatchEventType_PUT && event.Value != nil {
+			value := valueFromProto(event.Value)
+			clientEvent.Value = &value
+		}
+		visit(clientEvent)
+	}
+}
+
+var watchEventTypes = map[pb.WatchEventType]string{
+	pb.WatchEventType_PUT:    EventPut,
+	pb.WatchEventType_DELETE: EventDelete,
+	pb.WatchEventType_EXPIRE: EventExpire,
+	pb.WatchEventType_EVICT:  EventEvict,
+}
+
+func (transport *grpcTransport) close() error {
+	transport.connsMux.Lock()
+	defer transport.connsMux.Unlock()
+
+	var errs []error
+	for node, conn := range transport.conns {
+		errs = append(errs, conn.Close())
+		delete(transport.conns, node)
+	}
+	return errors.Join(errs...)
+}
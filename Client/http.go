@@ -0,0 +1,328 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// The nodes' HTTP API: /data/{key}, /batch/get, /batch/put, /watch (server-sent events) and /ring.
+
+type httpTransport struct {
+	port   int
+	client *http.Client
+}
+
+func newHTTPTransport(port int) *httpTransport {
+	return &httpTransport{
+		port: port,
+		// Redirects are followed by the Client, which also refreshes its ring.
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+func (transport *httpTransport) url(node string, path string) string {
+	return fmt.Sprintf("http://%s:%d%s", node, transport.port, path)
+}
+
+func dataPath(key string) string {
+	return "/data/" + url.PathEscape(key)
+}
+
+func formatETag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+func parseETag(etag string) uint64 {
+	version, _ := strconv.ParseUint(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), 10, 64)
+	return version
+}
+
+func (transport *httpTransport) do(ctx context.Context, method string, node string, path string, body []byte, header http.Header) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, transport.url(node, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	response, err := transport.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+
+	if response.StatusCode == http.StatusTemporaryRedirect {
+		response.Body.Close()
+
+		location, err := url.Parse(response.Header.Get("Location"))
+		if err != nil || location.Hostname() == "" {
+			return nil, fmt.Errorf("invalid redirect from %s", node)
+		}
+		return nil, &redirectError{owner: location.Hostname()}
+	}
+
+	return response, nil
+}
+
+// An error for a response outside the 2xx range, which it closes.
+func statusError(response *http.Response) error {
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusPreconditionFailed:
+		return ErrPreconditionFailed
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1<<10))
+	err := fmt.Errorf("%s: %s", response.Status, strings.TrimSpace(string(body)))
+	if response.StatusCode == http.StatusServiceUnavailable {
+		err = fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+	return err
+}
+
+func (transport *httpTransport) ring(ctx context.Context, node string) (*pb.Ring, error) {
+	response, err := transport.do(ctx, http.MethodGet, node, "/ring", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &pb.Ring{}
+	return ring, protojson.Unmarshal(body, ring)
+}
+
+func (transport *httpTransport) get(ctx context.Context, node string, key string) (Value, error) {
+	response, err := transport.do(ctx, http.MethodGet, node, dataPath(key), nil, nil)
+	if err != nil {
+		return Value{}, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return Value{}, statusError(response)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return Value{}, err
+	}
+
+	value := Value{Data: data, ContentType: response.Header.Get("Content-Type"), Version: parseETag(response.Header.Get("ETag"))}
+	if expires, err := http.ParseTime(response.Header.Get("Expires")); err == nil {
+		value.ExpiresAt = expires
+	}
+	return value, nil
+}
+
+func (transport *httpTransport) put(ctx context.Context, node string, key string, value Value, options PutOptions) (uint64, error) {
+	header := http.Header{}
+	if value.ContentType != "" {
+		header.Set("Content-Type", value.ContentType)
+	}
+	if options.TTL > 0 {
+		header.Set("TTL", options.TTL.String())
+	}
+	if options.IfMatch != 0 {
+		header.Set("If-Match", formatETag(options.IfMatch))
+	}
+	if options.IfAbsent {
+		header.Set("If-None-Match", "*")
+	}
+
+	response, err := transport.do(ctx, http.MethodPut, node, dataPath(key), value.Data, header)
+	if err != nil {
+		return 0, err
+	}
+	if response.StatusCode/100 != 2 {
+		return 0, statusError(response)
+	}
+	response.Body.Close()
+
+	return parseETag(response.Header.Get("ETag")), nil
+}
+
+func (transport *httpTransport) remove(ctx context.Context, node string, key string, options DeleteOptions) error {
+	header := http.Header{}
+	if options.IfMatch != 0 {
+		header.Set("If-Match", formatETag(options.IfMatch))
+	}
+
+	response, err := transport.do(ctx, http.MethodDelete, node, dataPath(key), nil, header)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode/100 != 2 {
+		return statusError(response)
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+// Request and response bodies of the batch endpoints.
+type batchPutEntry struct {
+	Key         string `json:"key"`
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	TTL         string `json:"ttl,omitempty"`
+}
+
+type batchResult struct {
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (transport *httpTransport) batch(ctx context.Context, node string, path string, request any) (map[string]*batchResult, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := transport.do(ctx, http.MethodPost, node, path, body, http.Header{"Content-Type": {"application/json"}})
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, statusError(response)
+	}
+	defer response.Body.Close()
+
+	results := struct {
+		Results map[string]*batchResult `json:"results"`
+	}{}
+	return results.Results, json.NewDecoder(response.Body).Decode(&results)
+}
+
+func (transport *httpTransport) batchGet(ctx context.Context, node string, keys []string) (map[string]Value, error) {
+	results, err := transport.batch(ctx, node, "/batch/get", map[string][]string{"keys": keys})
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]Value)
+	var errs []error
+	for key, result := range results {
+		switch result.Error {
+		case "":
+			values[key] = Value{Data: result.Value, ContentType: result.ContentType, Version: parseETag(result.ETag)}
+		case http.StatusText(http.StatusNotFound):
+		default:
+			errs = append(errs, fmt.Errorf("%q: %s", key, result.Error))
+		}
+	}
+
+	return values, errors.Join(errs...)
+}
+
+func (transport *httpTransport) batchPut(ctx context.Context, node string, values map[string]Value) (map[string]uint64, error) {
+	entries := make([]batchPutEntry, 0, len(values))
+	for key, value := range values {
+		entry := batchPutEntry{Key: key, Value: value.Data, ContentType: value.ContentType}
+		if !value.ExpiresAt.IsZero() {
+			entry.TTL = time.Until(value.ExpiresAt).String()
+		}
+		entries = append(entries, entry)
+	}
+
+	results, err := transport.batch(ctx, node, "/batch/put", map[string][]batchPutEntry{"entries": entries})
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]uint64)
+	var errs []error
+	for key, result := range results {
+		if result.Error != "" {
+			errs = append(errs, fmt.Errorf("%q: %s", key, result.Error))
+			continue
+		}
+		versions[key] = parseETag(result.ETag)
+	}
+
+	return versions, errors.Join(errs...)
+}
+
+type watchEvent struct {
+	Type        string `json:"type"`
+	Key         string `json:"key"`
+	Version     uint64 `json:"version"`
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+func (transport *httpTransport) watch(ctx context.Context, node string, key string, options WatchOptions, visit func(Event)) error {
+	query := url.Values{"key": {key}}
+	if options.Prefix {
+		query.Set("prefix", "true")
+	}
+	if options.Since != 0 {
+		query.Set("since", strconv.FormatUint(options.Since, 10))
+	}
+
+	response, err := transport.do(ctx, http.MethodGet, node, "/watch?"+query.Encode(), nil, http.Header{"Accept": {"text/event-stream"}})
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return statusError(response)
+	}
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(nil, 1<<26)
+
+	for scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found {
+			continue
+		}
+
+		event := watchEvent{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("invalid watch event from %s: %w", node, err)
+		}
+
+		clientEvent := Event{Type: event.Type, Key: event.Key, Version: event.Version}
+		if event.Type == EventPut {
+			clientEvent.Value = &Value{Data: event.Value, ContentType: event.ContentType, Version: event.Version}
+		}
+		visit(clientEvent)
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+	return nil
+}
+
+func (transport *httpTransport) close() error {
+	transport.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,185 @@
+package data
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Size-bounded in-memory backend: once the keys and values exceed maxBytes, the least recently
+// used keys are evicted. Suited to nodes that front another source of truth.
+type CacheStore struct {
+	lock     sync.Mutex
+	maxBytes uint64
+	// Keys from most to least recently used, and each key's element in that list.
+	recency  *list.List
+	elements map[string]*list.Element
+	indexedMap
+}
+
+func NewCacheStore(maxBytes uint64, hashFunc func(key string) uint64) *CacheStore {
+	return &CacheStore{
+		maxBytes:   maxBytes,
+		recency:    list.New(),
+		elements:   make(map[string]*list.Element),
+		indexedMap: newIndexedMap(hashFunc),
+	}
+}
+
+// Must be called with the lock held.
+func (store *CacheStore) touch(key string) {
+	if element, found := store.elements[key]; found {
+		store.recency.MoveToFront(element)
+		return
+	}
+
+	store.elements[key] = store.recency.PushFront(key)
+}
+
+// Must be called with the lock held.
+func (store *CacheStore) forget(key string, eventType string) bool {
+	if element, found := store.elements[key]; found {
+		store.recency.Remove(element)
+		delete(store.elements, key)
+	}
+
+	return store.remove(key, eventType)
+}
+
+// Evict least recently used keys until the store fits, always keeping the most recent key.
+func (store *CacheStore) evict() {
+	for store.bytes > store.maxBytes && store.recency.Len() > 1 {
+		key := store.recency.Back().Value.(string)
+		store.forget(key, EventEvict)
+		logger.Debug("Evicted key from cache", "key", key)
+	}
+}
+
+func (store *CacheStore) Get(key string) (Value, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	value, found := store.get(key)
+	if found {
+		store.touch(key)
+	}
+
+	return value, found
+}
+
+func (store *CacheStore) Entry(key string) (Value, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	value, found := store.entry(key)
+	if found {
+		store.touch(key)
+	}
+
+	return value, found
+}
+
+func (store *CacheStore) Put(key string, value Value, precondition Precondition) (Value, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	value, found, err := store.prepare(key, value, precondition)
+	if err != nil {
+		return Value{}, found, err
+	}
+
+	store.put(key, value)
+	store.touch(key)
+	store.evict()
+
+	return value, found, nil
+}
+
+func (store *CacheStore) Delete(key string, precondition Precondition) (Value, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	found, err := store.check(key, precondition)
+	if err != nil || !found {
+		return Value{}, false, err
+	}
+
+	tombstone := store.delete(key)
+	store.touch(key)
+	store.evict()
+
+	return tombstone, true, nil
+}
+
+func (store *CacheStore) Range(startHash, endHash uint64, visit func(key string, value Value) bool) {
+	store.lock.Lock()
+	entries := store.entries(startHash, endHash)
+	store.lock.Unlock()
+
+	visitEntries(entries, visit)
+}
+
+func (store *CacheStore) Apply(mutations []Mutation) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, mutation := range mutations {
+		if !store.accepts(mutation) {
+			continue
+		}
+
+		if mutation.Value == nil {
+			store.forget(mutation.Key, EventDelete)
+			continue
+		}
+
+		store.put(mutation.Key, *mutation.Value)
+		store.touch(mutation.Key)
+	}
+
+	store.evict()
+
+	return nil
+}
+
+func (store *CacheStore) Purge(tombstones []Mutation) (int, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	purged := 0
+	for _, tombstone := range tombstones {
+		if store.purgeable(tombstone.Key, tombstone.Value.Version) {
+			store.forget(tombstone.Key, "")
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (store *CacheStore) Sweep() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	expired := store.expiredKeys()
+	for _, key := range expired {
+		store.forget(key, EventExpire)
+	}
+
+	return len(expired)
+}
+
+func (store *CacheStore) SetListener(listener func(Event)) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.listener = listener
+}
+
+func (store *CacheStore) Stats() StoreStats {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.stats()
+}
+
+func (store *CacheStore) Close() error {
+	return nil
+}
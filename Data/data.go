@@ -1,31 +1,137 @@
 package data
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"sync"
+	"strconv"
+	"time"
+	"unicode/utf8"
 
+	logging "github.com/girivad/go-chord/Logging"
+	metrics "github.com/girivad/go-chord/Metrics"
 	pb "github.com/girivad/go-chord/Proto"
+	tracing "github.com/girivad/go-chord/Tracing"
 	"github.com/gorilla/mux"
-	"google.golang.org/protobuf/types/known/anypb"
 )
 
+var logger = logging.Logger(logging.Data)
+
+// A stored value: opaque bytes, returned exactly as they were written, with their content type.
 type Value struct {
-	Val any
+	Data        []byte
+	ContentType string
+	// Assigned by the store on every write and exposed as the value's ETag.
+	Version uint64
+	// Absolute expiry in Unix nanoseconds, or 0 for a value that never expires.
+	ExpiresAt int64 `json:",omitempty"`
+	// A tombstone: the key was deleted at Version. Clients never see tombstones; they replicate like
+	// values so that stale copies cannot bring the key back, and are purged after a grace period.
+	Deleted bool `json:",omitempty"`
+}
+
+const defaultContentType = "application/octet-stream"
+
+const sweepPeriod time.Duration = 1 * time.Second
+
+func (value Value) expired(now time.Time) bool {
+	return value.ExpiresAt != 0 && now.UnixNano() >= value.ExpiresAt
+}
+
+// TTL of a PUT from its ttl query parameter or TTL header; 0 when neither is set.
+func requestTTL(r *http.Request) (time.Duration, error) {
+	ttl := r.URL.Query().Get("ttl")
+	if ttl == "" {
+		ttl = r.Header.Get("TTL")
+	}
+	if ttl == "" {
+		return 0, nil
+	}
+
+	return ParseTTL(ttl)
+}
+
+var ErrInvalidTTL = errors.New("invalid TTL")
+
+// The value a PUT stores: its body, content type and expiry (unversioned).
+func RequestValue(r *http.Request) (Value, error) {
+	defer r.Body.Close()
+	requestBody, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	ttl, err := requestTTL(r)
+
+	if err != nil {
+		return Value{}, fmt.Errorf("%w: %w", ErrInvalidTTL, err)
+	}
+
+	value := Value{Data: requestBody, ContentType: r.Header.Get("Content-Type")}
+	if value.ContentType == "" {
+		value.ContentType = defaultContentType
+	}
+	if ttl > 0 {
+		value.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	return value, nil
+}
+
+// Parse a TTL given as a Go duration ("90s") or in seconds.
+func ParseTTL(ttl string) (time.Duration, error) {
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		seconds, secondsErr := strconv.ParseUint(ttl, 10, 32)
+		if secondsErr != nil {
+			return 0, err
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	if duration <= 0 {
+		return 0, errors.New("TTL must be positive")
+	}
+
+	return duration, nil
+}
+
+// Values are logged as their content type and size, plus their contents when they are valid UTF-8 and
+// logging.ShowValues is on.
+func (value Value) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("content_type", value.ContentType), slog.Int("bytes", len(value.Data))}
+	if logging.ShowingValues() && utf8.Valid(value.Data) {
+		attrs = append(attrs, slog.String("data", string(value.Data)))
+	}
+	return slog.GroupValue(attrs...)
 }
 
 type DataServer struct {
-	KVMap          map[string]Value
-	Lock           sync.RWMutex
-	RegisterKey    func(string)
-	RegisterDelete func(string)
+	Store    Store
+	Watchers *Watchers
+	router   *mux.Router
+}
+
+func NewDataServer(store Store) *DataServer {
+	dataServer := &DataServer{Watchers: NewWatchers(), router: mux.NewRouter()}
+	dataServer.SetStore(store)
+	return dataServer
 }
 
-func NewDataServer(registerKey func(string), registerDelete func(string)) *DataServer {
-	return &DataServer{KVMap: make(map[string]Value), RegisterKey: registerKey, RegisterDelete: registerDelete}
+// Replace the store (e.g. with the backend selected at startup). Must be called before Serve.
+func (dataServer *DataServer) SetStore(store Store) {
+	store.SetListener(dataServer.Watchers.Publish)
+	dataServer.Store = store
+}
+
+// Register an additional route (e.g. cluster-level endpoints served by the overlay) alongside the data routes.
+// Must be called before Serve.
+func (dataServer *DataServer) HandleFunc(path string, handler http.HandlerFunc, methods ...string) {
+	dataServer.router.HandleFunc(path, handler).Methods(methods...)
 }
 
 func (dataServer *DataServer) GetValue(w http.ResponseWriter, r *http.Request) {
@@ -38,9 +144,7 @@ func (dataServer *DataServer) GetValue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Retrieve value from map
-	dataServer.Lock.RLock()
-	value, found := dataServer.KVMap[key]
-	dataServer.Lock.RUnlock()
+	value, found := dataServer.Get(r.Context(), key)
 
 	// Handle not found
 	if !found {
@@ -48,19 +152,63 @@ func (dataServer *DataServer) GetValue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Else, put in JSON and return
+	// Else, return the value as it was stored
 
-	log.Printf("[INFO] GET: K: %s, V: %v", key, value)
+	WriteValue(w, r, value)
+}
 
-	valBytes, err := json.Marshal(value)
+// The live value of a key, for the GET handler and the overlay's KV service.
+func (dataServer *DataServer) Get(ctx context.Context, key string) (Value, bool) {
+	_, span := tracing.Start(ctx, "store.get")
+	value, found := dataServer.Store.Get(key)
+	span.End()
 
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if found {
+		logger.Debug("GET", "key", key, logging.Value(value))
+	}
+
+	return value, found
+}
+
+// Write a key if precondition holds, for the PUT handler and the overlay's KV service. Returns the stored
+// value and whether the key already existed.
+func (dataServer *DataServer) Put(ctx context.Context, key string, value Value, precondition Precondition) (Value, bool, error) {
+	logger.Debug("PUT", "key", key, logging.Value(value))
+
+	_, span := tracing.Start(ctx, "store.put")
+	value, found, err := dataServer.Store.Put(key, value, precondition)
+	tracing.End(span, err)
+
+	return value, found, err
+}
+
+// Delete a key if precondition holds, for the DELETE handler and the overlay's KV service. Returns the
+// tombstone and whether the key existed.
+func (dataServer *DataServer) Delete(ctx context.Context, key string, precondition Precondition) (Value, bool, error) {
+	logger.Debug("DELETE", "key", key)
+
+	_, span := tracing.Start(ctx, "store.delete")
+	value, found, err := dataServer.Store.Delete(key, precondition)
+	tracing.End(span, err)
+
+	return value, found, err
+}
+
+// Respond to a GET with a stored value, its ETag and expiry, or 304 if the client's copy is current.
+func WriteValue(w http.ResponseWriter, r *http.Request, value Value) {
+	w.Header().Set("ETag", FormatETag(value.Version))
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagsMatch(ifNoneMatch, value, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
+	w.Header().Set("Content-Type", value.ContentType)
+	if value.ExpiresAt != 0 {
+		w.Header().Set("Expires", time.Unix(0, value.ExpiresAt).UTC().Format(http.TimeFormat))
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write(valBytes)
+	w.Write(value.Data)
 }
 
 func (dataServer *DataServer) PutValue(w http.ResponseWriter, r *http.Request) {
@@ -69,41 +217,43 @@ func (dataServer *DataServer) PutValue(w http.ResponseWriter, r *http.Request) {
 
 	if key == "" {
 		http.Error(w, http.StatusText(http.StatusBadRequest)+": No key provided.", http.StatusBadRequest)
+		return
 	}
 
-	// Retrieve Value from Body
-	defer r.Body.Close()
-	requestBody, err := io.ReadAll(r.Body)
+	value, err := RequestValue(r)
+
+	if errors.Is(err, ErrInvalidTTL) {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	value := Value{}
-	err = json.Unmarshal(requestBody, &value)
+	// Edit the key-value pair
+	value, found, err := dataServer.Put(r.Context(), key, value, RequestPrecondition(r))
 
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest)+": invalid or no value provided.", http.StatusBadRequest)
+	if err == ErrPreconditionFailed {
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
 		return
 	}
 
-	log.Printf("[INFO] PUT key: %s, value: %v", key, value)
-
-	// Edit the key-value pair
-	dataServer.Lock.Lock()
-	_, found := dataServer.KVMap[key]
-	dataServer.KVMap[key] = value
-	dataServer.Lock.Unlock()
+	if err != nil {
+		logger.Error("Storing PUT failed", "key", key, "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
 	var status int
 	if found {
 		status = http.StatusAccepted
 	} else {
-		dataServer.RegisterKey(key)
 		status = http.StatusCreated
 	}
 
+	w.Header().Set("ETag", FormatETag(value.Version))
 	w.WriteHeader(status)
 	w.Write(([]byte)(http.StatusText(status)))
 }
@@ -111,79 +261,179 @@ func (dataServer *DataServer) PutValue(w http.ResponseWriter, r *http.Request) {
 func (dataServer *DataServer) DeleteKV(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
 
-	log.Printf("[INFO] DEL key: %s, value:%v", key, dataServer.KVMap[key])
-
 	if key == "" {
 		http.Error(w, http.StatusText(http.StatusBadRequest)+": No key provided.", http.StatusBadRequest)
 		return
 	}
 
-	_, found := dataServer.KVMap[key]
+	_, found, err := dataServer.Delete(r.Context(), key, RequestPrecondition(r))
 
-	if !found {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	if err == ErrPreconditionFailed {
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
 		return
 	}
 
-	dataServer.Lock.Lock()
-	delete(dataServer.KVMap, key)
-	dataServer.Lock.Unlock()
+	if err != nil {
+		logger.Error("Storing DELETE failed", "key", key, "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
 
-	dataServer.RegisterDelete(key)
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write(([]byte)(http.StatusText(http.StatusOK)))
 }
 
 func (dataServer *DataServer) Serve(port int) {
-	router := mux.NewRouter()
-	router.HandleFunc("/data/{key}", dataServer.GetValue).Methods("GET")
-	router.HandleFunc("/data/{key}", dataServer.PutValue).Methods("PUT")
-	router.HandleFunc("/data/{key}", dataServer.DeleteKV).Methods("DELETE")
+	metrics.RegisterStore(dataServer.keyCount, dataServer.byteCount)
+
+	router := dataServer.router
+	router.Use(tracing.HTTPMiddleware, metrics.HTTPMiddleware)
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	// The /data/{key} routes are registered by the overlay (see HandleFunc), which wraps GetValue,
+	// PutValue and DeleteKV with routing and replication.
 
-	http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	go dataServer.SweepExpired()
+
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), router)
+	logger.Error("Data server stopped", "err", err)
 }
 
-func (dataServer *DataServer) GetValuesForTransfer(keys []string) (*pb.KVMap, error) {
+// Periodically remove expired keys from the store (and so from its key index).
+func (dataServer *DataServer) SweepExpired() {
+	for {
+		time.Sleep(sweepPeriod)
+
+		if swept := dataServer.Store.Sweep(); swept > 0 {
+			logger.Debug("Swept expired keys", "keys", swept)
+		}
+	}
+}
+
+func (dataServer *DataServer) keyCount() float64 {
+	return float64(dataServer.Store.Stats().Keys)
+}
+
+func (dataServer *DataServer) byteCount() float64 {
+	return float64(dataServer.Store.Stats().Bytes)
+}
+
+// Collect the keys in the arc (startHash, endHash] for transfer to another node, tombstones included.
+func (dataServer *DataServer) GetValuesForTransfer(startHash, endHash uint64) (*pb.KVMap, error) {
 	kvMap := make(map[string]*pb.Value)
-	dataServer.Lock.RLock()
-	for _, key := range keys {
-		value, ok := dataServer.KVMap[key]
 
-		if !ok {
+	dataServer.Store.Range(startHash, endHash, func(key string, value Value) bool {
+		kvMap[key] = value.ToProto()
+		return true
+	})
+
+	return &pb.KVMap{Kvmap: kvMap}, nil
+}
+
+func (dataServer *DataServer) PutValuesForTransfer(data *pb.KVMap) error {
+	mutations := make([]Mutation, 0, len(data.Kvmap))
+
+	for key, value := range data.Kvmap {
+		if _, found := dataServer.Store.Entry(key); found && data.KeepExisting {
 			continue
 		}
 
-		byteValue, err := json.Marshal(value)
+		mutations = append(mutations, Mutation{Key: key, Value: ValueFromProto(value)})
+	}
 
-		if err != nil {
-			fmt.Printf("byteValue marshalling failed: %v", err)
-			return nil, err
-		}
+	return dataServer.Store.Apply(mutations)
+}
 
-		kvMap[key] = &pb.Value{Val: &anypb.Any{Value: byteValue}}
+// Values of the given keys that this store holds, and with tombstones set their tombstones.
+func (dataServer *DataServer) GetValues(keys []string, tombstones bool) *pb.KVMap {
+	kvMap := make(map[string]*pb.Value)
+
+	get := dataServer.Store.Get
+	if tombstones {
+		get = dataServer.Store.Entry
 	}
-	dataServer.Lock.RUnlock()
 
-	return &pb.KVMap{Kvmap: kvMap}, nil
+	for _, key := range keys {
+		if value, found := get(key); found {
+			kvMap[key] = value.ToProto()
+		}
+	}
+
+	return &pb.KVMap{Kvmap: kvMap}
 }
 
-func (dataServer *DataServer) PutValuesForTransfer(data *pb.KVMap) error {
-	dataServer.Lock.Lock()
+// Write each value as a client PUT would (a new version, keeping its content type and expiry),
+// reporting the outcome per key.
+func (dataServer *DataServer) PutValues(data *pb.KVMap) *pb.WriteResults {
+	results := make(map[string]*pb.WriteResult)
 
 	for key, value := range data.Kvmap {
-		parsedValue := &Value{}
-		err := json.Unmarshal(value.Val.Value, parsedValue)
+		stored, found, err := dataServer.Store.Put(key, *ValueFromProto(value), nil)
 
 		if err != nil {
-			fmt.Printf("Unmarshalling value failed: %v", err)
-			return err
+			logger.Error("Storing batched PUT failed", "key", key, "err", err)
+			results[key] = &pb.WriteResult{Error: err.Error()}
+			continue
+		}
+
+		results[key] = &pb.WriteResult{Version: stored.Version, Created: !found}
+	}
+
+	return &pb.WriteResults{Results: results}
+}
+
+// Apply versioned writes (deletes as tombstones) from a replication coordinator; a replica keeps
+// whichever version is newer. Each result carries the version held afterwards, and whether the key was
+// live before.
+func (dataServer *DataServer) Replicate(mutations *pb.Mutations) *pb.WriteResults {
+	results := make(map[string]*pb.WriteResult)
+
+	for _, mutation := range mutations.Mutations {
+		current, _ := dataServer.Store.Entry(mutation.Key)
+		_, found := dataServer.Store.Get(mutation.Key)
+
+		applied := Mutation{Key: mutation.Key}
+		if mutation.Value != nil {
+			applied.Value = ValueFromProto(mutation.Value)
 		}
 
-		dataServer.KVMap[key] = *parsedValue
+		if err := dataServer.Store.Apply([]Mutation{applied}); err != nil {
+			logger.Error("Storing replicated write failed", "key", mutation.Key, "err", err)
+			results[mutation.Key] = &pb.WriteResult{Error: err.Error()}
+			continue
+		}
+
+		result := &pb.WriteResult{Version: current.Version, Created: !found}
+		if applied.Value != nil && applied.Value.Version > current.Version {
+			result.Version = applied.Value.Version
+		}
+		results[mutation.Key] = result
 	}
 
-	dataServer.Lock.Unlock()
+	return &pb.WriteResults{Results: results}
+}
+
+// Drop tombstones that every replica of their keys holds.
+func (dataServer *DataServer) Purge(tombstones *pb.Mutations) error {
+	mutations := make([]Mutation, 0, len(tombstones.Mutations))
+	for _, tombstone := range tombstones.Mutations {
+		if tombstone.Value != nil && tombstone.Value.Deleted {
+			mutations = append(mutations, Mutation{Key: tombstone.Key, Value: ValueFromProto(tombstone.Value)})
+		}
+	}
+
+	_, err := dataServer.Store.Purge(mutations)
+	return err
+}
+
+func (value Value) ToProto() *pb.Value {
+	return &pb.Value{Data: value.Data, ContentType: value.ContentType, Version: value.Version, ExpiresAt: value.ExpiresAt, Deleted: value.Deleted}
+}
 
-	return nil
+func ValueFromProto(value *pb.Value) *Value {
+	return &Value{Data: value.Data, ContentType: value.ContentType, Version: value.Version, ExpiresAt: value.ExpiresAt, Deleted: value.Deleted}
 }
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	logging "github.com/girivad/go-chord/Logging"
+)
+
+func TestValueLogRedaction(t *testing.T) {
+	defer logging.ShowValues(false)
+
+	value := Value{Data: []byte("secret"), ContentType: "text/plain"}
+
+	tests := []struct {
+		name string
+		show bool
+		attr slog.Attr
+		want bool
+	}{
+		{"redacted", false, logging.Value(value), false},
+		{"shown", true, logging.Value(value), true},
+		{"logged directly", false, slog.Any("value", value), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logging.ShowValues(test.show)
+
+			var out bytes.Buffer
+			slog.New(slog.NewTextHandler(&out, nil)).Info("PUT", test.attr)
+
+			if got := strings.Contains(out.String(), "secret"); got != test.want {
+				t.Errorf("logged %q, want data shown: %v", out.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Hinted handoff: writes meant for a replica that could not be reached, kept by the coordinating node
+// until they can be replayed to it. Hints are held in memory, bounded in size and dropped after a TTL
+// (anti-entropy repairs whatever they would have).
+
+var ErrHintsFull = errors.New("hint storage is full")
+
+type Hint struct {
+	// The node the write was meant for.
+	Target string
+	Key    string
+	// A tombstone for a delete.
+	Value   *Value
+	Created time.Time
+}
+
+func (hint *Hint) size() uint64 {
+	return valueSize(hint.Key, *hint.Value)
+}
+
+type Hints struct {
+	lock sync.Mutex
+	// The latest hint per target and key.
+	hints    map[string]map[string]*Hint
+	bytes    uint64
+	maxBytes uint64
+	ttl      time.Duration
+}
+
+func NewHints(maxBytes uint64, ttl time.Duration) *Hints {
+	return &Hints{hints: make(map[string]map[string]*Hint), maxBytes: maxBytes, ttl: ttl}
+}
+
+// Keep a write for target, replacing an older hint for the same key.
+func (hints *Hints) Add(target string, key string, value *Value) error {
+	hints.lock.Lock()
+	defer hints.lock.Unlock()
+
+	hint := &Hint{Target: target, Key: key, Value: value, Created: time.Now()}
+
+	previous := hints.hints[target][key]
+	if previous != nil {
+		if previous.Value.Version > value.Version {
+			return nil
+		}
+		hints.bytes -= previous.size()
+	}
+
+	if hints.bytes+hint.size() > hints.maxBytes {
+		if previous != nil {
+			hints.bytes += previous.size()
+		}
+		return ErrHintsFull
+	}
+
+	if hints.hints[target] == nil {
+		hints.hints[target] = make(map[string]*Hint)
+	}
+	hints.hints[target][key] = hint
+	hints.bytes += hint.size()
+
+	return nil
+}
+
+// Nodes with pending hints.
+func (hints *Hints) Targets() []string {
+	hints.lock.Lock()
+	defer hints.lock.Unlock()
+
+	targets := make([]string, 0, len(hints.hints))
+	for target := range hints.hints {
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// The pending hints for target.
+func (hints *Hints) Pending(target string) []*Hint {
+	hints.lock.Lock()
+	defer hints.lock.Unlock()
+
+	pending := make([]*Hint, 0, len(hints.hints[target]))
+	for _, hint := range hints.hints[target] {
+		pending = append(pending, hint)
+	}
+	return pending
+}
+
+// Drop hints once replayed, unless a newer hint for the same key arrived in the meantime.
+func (hints *Hints) Remove(replayed []*Hint) {
+	hints.lock.Lock()
+	defer hints.lock.Unlock()
+
+	for _, hint := range replayed {
+		if hints.hints[hint.Target][hint.Key] == hint {
+			hints.remove(hint)
+		}
+	}
+}
+
+// Must be called with the lock held.
+func (hints *Hints) remove(hint *Hint) {
+	delete(hints.hints[hint.Target], hint.Key)
+	if len(hints.hints[hint.Target]) == 0 {
+		delete(hints.hints, hint.Target)
+	}
+	hints.bytes -= hint.size()
+}
+
+// Drop hints older than the TTL, returning how many were dropped.
+func (hints *Hints) Expire() int {
+	hints.lock.Lock()
+	defer hints.lock.Unlock()
+
+	expired := 0
+	for _, targetHints := range hints.hints {
+		for _, hint := range targetHints {
+			if time.Since(hint.Created) >= hints.ttl {
+				hints.remove(hint)
+				expired++
+			}
+		}
+	}
+	return expired
+}
+
+// Number of pending hints and the bytes they hold.
+func (hints *Hints) Stats() (int, uint64) {
+	hints.lock.Lock()
+	defer hints.lock.Unlock()
+
+	count := 0
+	for _, targetHints := range hints.hints {
+		count += len(targetHints)
+	}
+	return count, hints.bytes
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHintsKeepNewestPerKey(t *testing.T) {
+	hints := NewHints(1<<10, time.Hour)
+
+	for _, version := range []uint64{2, 3, 1} {
+		if err := hints.Add("b", "key", &Value{Data: []byte("value"), Version: version}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending := hints.Pending("b")
+	if len(pending) != 1 || pending[0].Value.Version != 3 {
+		t.Fatalf("pending hints are %v, want only version 3", pending)
+	}
+	if count, bytes := hints.Stats(); count != 1 || bytes != uint64(len("key")+len("value")) {
+		t.Fatalf("stats are %d hints, %d bytes after replacing a hint", count, bytes)
+	}
+}
+
+func TestHintsBounded(t *testing.T) {
+	hints := NewHints(10, time.Hour)
+
+	if err := hints.Add("b", "key", &Value{Data: []byte("value"), Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hints.Add("c", "other", &Value{Data: []byte("value"), Version: 1}); !errors.Is(err, ErrHintsFull) {
+		t.Fatalf("adding past the bound returned %v, want %v", err, ErrHintsFull)
+	}
+
+	// A replacement that does not fit keeps the hint it would have replaced.
+	if err := hints.Add("b", "key", &Value{Data: []byte("longer value"), Version: 2}); !errors.Is(err, ErrHintsFull) {
+		t.Fatalf("oversized replacement returned %v, want %v", err, ErrHintsFull)
+	}
+	if pending := hints.Pending("b"); len(pending) != 1 || pending[0].Value.Version != 1 {
+		t.Fatalf("pending hints are %v, want the original hint", pending)
+	}
+	if _, bytes := hints.Stats(); bytes != uint64(len("key")+len("value")) {
+		t.Fatalf("%d bytes held after a rejected replacement", bytes)
+	}
+}
+
+func TestHintsRemoveReplayed(t *testing.T) {
+	hints := NewHints(1<<10, time.Hour)
+	hints.Add("b", "key", &Value{Version: 1})
+	hints.Add("b", "other", &Value{Version: 1})
+
+	replayed := hints.Pending("b")
+
+	// A newer write for key arrived during the replay, and must be replayed next time.
+	hints.Add("b", "key", &Value{Version: 2})
+	hints.Remove(replayed)
+
+	pending := hints.Pending("b")
+	if len(pending) != 1 || pending[0].Key != "key" || pending[0].Value.Version != 2 {
+		t.Fatalf("pending hints are %v, want only the newer hint for key", pending)
+	}
+
+	hints.Remove(pending)
+	if targets := hints.Targets(); len(targets) != 0 {
+		t.Fatalf("targets %v remain once every hint was replayed", targets)
+	}
+}
+
+func TestHintsExpire(t *testing.T) {
+	hints := NewHints(1<<10, time.Hour)
+	hints.Add("b", "key", &Value{Version: 1})
+	hints.Add("c", "key", &Value{Version: 1})
+	hints.hints["b"]["key"].Created = time.Now().Add(-2 * time.Hour)
+
+	if expired := hints.Expire(); expired != 1 {
+		t.Fatalf("%d hints expired, want 1", expired)
+	}
+	if targets := hints.Targets(); len(targets) != 1 || targets[0] != "c" {
+		t.Fatalf("targets are %v, want [c]", targets)
+	}
+}
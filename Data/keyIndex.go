@@ -1,14 +1,16 @@
-package overlay
+package data
 
 import (
-	"log"
+	"cmp"
 	"slices"
 	"sync"
 
-	pb "github.com/girivad/go-chord/Proto"
+	logging "github.com/girivad/go-chord/Logging"
 )
 
-// To-do: Implement KeyIndex containing BST + Lock
+var keyIndexLogger = logging.Logger(logging.KeyIndex)
+
+// Index of a store's keys ordered by their position on the ring, maintained alongside the store's contents.
 
 type KeyIndex struct {
 	root *BST
@@ -39,20 +41,32 @@ func (keyIndex *KeyIndex) Visualize() {
 	keyIndex.lock.RUnlock()
 }
 
-func (keyIndex *KeyIndex) KeysToTransfer(predHash, nodeHash, currHash uint64) []string {
+func (keyIndex *KeyIndex) Count() uint64 {
 	keyIndex.lock.RLock()
-	keys := keyIndex.root.KeysToTransfer(predHash, nodeHash, currHash)
-	keyIndex.lock.RUnlock()
-	return keys
+	defer keyIndex.lock.RUnlock()
+	return keyIndex.root.Count()
 }
 
-func (keyIndex *KeyIndex) InsertBatch(data *pb.KVMap, hashFunc func(key string) uint64) {
-	var keys []string
+func (keyIndex *KeyIndex) Depth() uint64 {
+	keyIndex.lock.RLock()
+	defer keyIndex.lock.RUnlock()
+	return keyIndex.root.Depth()
+}
 
-	for key := range data.Kvmap {
-		keys = append(keys, key)
-	}
+func (keyIndex *KeyIndex) AllKeys() []string {
+	keyIndex.lock.RLock()
+	defer keyIndex.lock.RUnlock()
+	return keyIndex.root.AllKeys()
+}
 
+func (keyIndex *KeyIndex) KeysInArc(startHash, endHash uint64) []string {
+	keyIndex.lock.RLock()
+	keys := keyIndex.root.KeysInArc(startHash, endHash)
+	keyIndex.lock.RUnlock()
+	return keys
+}
+
+func (keyIndex *KeyIndex) InsertKeys(keys []string, hashFunc func(key string) uint64) {
 	keyIndex.lock.Lock()
 	keyIndex.root.InsertBatch(keys, hashFunc)
 	keyIndex.lock.Unlock()
@@ -83,6 +97,10 @@ func (bst *BST) Insert(key string, hash uint64, parent *BST) {
 		return
 	}
 
+	if hash == bst.Hash && key == bst.Key {
+		return
+	}
+
 	if hash < bst.Hash {
 		if bst.Left != nil {
 			bst.Left.Insert(key, hash, bst)
@@ -114,81 +132,87 @@ func (bst *BST) Rightmost() *BST {
 	return bst
 }
 
-func (bst *BST) DeleteLeaf() {
-	if bst.Parent == nil {
-		bst.Set = false
-		return
+func (bst *BST) Find(key string, hash uint64) *BST {
+	if !bst.Set {
+		return nil
 	}
 
-	if bst.Parent.Hash < bst.Hash {
-		bst.Parent.Right = nil
-	} else {
-		bst.Parent.Left = nil
+	if hash == bst.Hash && key == bst.Key {
+		return bst
+	}
+
+	// Equal hashes are inserted to the right, so every node with this hash lies on this path.
+	if hash < bst.Hash && bst.Left != nil {
+		return bst.Left.Find(key, hash)
+	}
+	if hash >= bst.Hash && bst.Right != nil {
+		return bst.Right.Find(key, hash)
 	}
+
+	return nil
 }
 
 func (bst *BST) Delete(key string, hash uint64) bool {
-	var found bool
-	var swapNode *BST
+	node := bst.Find(key, hash)
 
-	if !bst.Set {
+	if node == nil {
 		return false
 	}
 
-	if bst.Hash < hash {
-		if bst.Right != nil {
-			found = bst.Right.Delete(key, hash)
-		}
-		return found
+	node.remove()
+	return true
+}
+
+// Remove this node, keeping the node itself in place (so the root pointer stays valid) whenever
+// it still has children.
+func (bst *BST) remove() {
+	if bst.Left != nil && bst.Right != nil {
+		// Replace with the in-order successor, which has no left child.
+		successor := bst.Right.Leftmost()
+		bst.Key = successor.Key
+		bst.Hash = successor.Hash
+		successor.remove()
+		return
 	}
 
-	if bst.Hash > hash {
-		if bst.Left != nil {
-			found = bst.Left.Delete(key, hash)
-		}
-		return found
+	child := bst.Left
+	if child == nil {
+		child = bst.Right
 	}
 
-	if bst.Key != key {
+	if child != nil {
+		bst.Key, bst.Hash, bst.Left, bst.Right = child.Key, child.Hash, child.Left, child.Right
 		if bst.Left != nil {
-			found = bst.Left.Delete(key, hash)
+			bst.Left.Parent = bst
 		}
 		if bst.Right != nil {
-			found = found || bst.Right.Delete(key, hash)
+			bst.Right.Parent = bst
 		}
-		return found
+		return
 	}
 
-	// Replace bst with the in-order successor/predecessor if bst.Key == key
+	if bst.Parent == nil {
+		bst.Set = false
+		return
+	}
 
-	if bst.Right != nil && bst.Right.Set {
-		swapNode = bst.Right.Leftmost()
-	} else if bst.Left != nil && bst.Left.Set {
-		swapNode = bst.Left.Rightmost()
+	if bst.Parent.Left == bst {
+		bst.Parent.Left = nil
 	} else {
-		swapNode = bst
+		bst.Parent.Right = nil
 	}
-
-	bst.Key = swapNode.Key
-	bst.Hash = swapNode.Hash
-	swapNode.DeleteLeaf()
-
-	return true
 }
 
-// BATCH-OPERATIONS: KeysToTransfer, (TO-DO) Insert Keys, Delete Keys
+// BATCH-OPERATIONS: KeysToTransfer, Insert Keys, (TO-DO) Delete Keys
 
-// Retrieve all keys between my predecessor and a new node
-func (bst *BST) KeysToTransfer(predHash, newHash, currHash uint64) []string {
-	if currHash > predHash {
-		return bst.KeysGreaterThan(newHash)
+// Retrieve all keys in the arc (startHash, endHash], which wraps around zero when endHash <= startHash
+// (so equal bounds cover the whole ring).
+func (bst *BST) KeysInArc(startHash, endHash uint64) []string {
+	if endHash > startHash {
+		return bst.KeysBetween(startHash, endHash)
 	}
 
-	if newHash > predHash {
-		return bst.KeysBetween(predHash, newHash)
-	}
-
-	return append(bst.KeysGreaterThan(predHash), bst.KeysLessThan(newHash)...)
+	return append(bst.KeysGreaterThan(startHash), bst.KeysLessThan(endHash)...)
 }
 
 func (bst *BST) KeysGreaterThan(lowerBound uint64) []string {
@@ -201,13 +225,13 @@ func (bst *BST) KeysGreaterThan(lowerBound uint64) []string {
 
 	// If it is less than or equal to the newHash, return searchRight of the right subtree.
 	if bst.Hash <= lowerBound && bst.Right != nil {
-		log.Printf("[DEBUG] %d not greater than %d", bst.Hash, lowerBound)
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "lower_bound", lowerBound)
 		return bst.Right.KeysGreaterThan(lowerBound)
 	} else if bst.Hash <= lowerBound {
-		log.Printf("[DEBUG] %d not greater than %d and nothing to its right", bst.Hash, lowerBound)
+		keyIndexLogger.Debug("Excluded from traversal, nothing to its right", "key_hash", bst.Hash, "lower_bound", lowerBound)
 		return keys
 	}
-	log.Printf("[DEBUG] %d greater than or equal to %d, %s included.", bst.Hash, lowerBound, bst.Key)
+	keyIndexLogger.Debug("Included in traversal", "key_hash", bst.Hash, "lower_bound", lowerBound)
 	keys = append(keys, bst.Key)
 
 	// Return the traversal of the right subtree, and any elements of the left subtree that might be greater than the lower bound.
@@ -229,15 +253,15 @@ func (bst *BST) KeysLessThan(upperBound uint64) []string {
 	}
 
 	if bst.Hash > upperBound && bst.Left != nil {
-		log.Printf("[DEBUG] %d > %d, excluded.", bst.Hash, upperBound)
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "upper_bound", upperBound)
 		return bst.Left.KeysLessThan(upperBound)
 	} else if bst.Hash > upperBound {
-		log.Printf("[DEBUG] %d > %d, excluded.", bst.Hash, upperBound)
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "upper_bound", upperBound)
 		return keys
 	}
 
 	keys = append(keys, bst.Key)
-	log.Printf("[DEBUG] %d <= %d, %s included.", bst.Hash, upperBound, bst.Key)
+	keyIndexLogger.Debug("Included in traversal", "key_hash", bst.Hash, "upper_bound", upperBound)
 	if bst.Right != nil {
 		keys = append(keys, bst.Right.KeysLessThan(upperBound)...)
 	}
@@ -258,26 +282,26 @@ func (bst *BST) KeysBetween(startHash, endHash uint64) []string {
 
 	// If Key too small:
 	if bst.Hash <= startHash && bst.Right != nil {
-		log.Printf("[DEBUG] %d < %d, excluded.", bst.Hash, startHash)
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "lower_bound", startHash)
 		return bst.Right.KeysBetween(startHash, endHash)
-	} else if bst.Hash < startHash {
-		log.Printf("[DEBUG] %d < %d, excluded.", bst.Hash, startHash)
+	} else if bst.Hash <= startHash {
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "lower_bound", startHash)
 		return keys
 	}
 
 	// If Key too large:
 	if bst.Hash > endHash && bst.Left != nil {
-		log.Printf("[DEBUG] %d > %d, excluded", bst.Hash, endHash)
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "upper_bound", endHash)
 		return bst.Left.KeysBetween(startHash, endHash)
 	} else if bst.Hash > endHash {
-		log.Printf("[DEBUG] %d > %d, excluded", bst.Hash, endHash)
+		keyIndexLogger.Debug("Excluded from traversal", "key_hash", bst.Hash, "upper_bound", endHash)
 		return keys
 	}
 
 	// If Key in range:
 
 	keys = append(keys, bst.Key)
-	log.Printf("[DEBUG] %d in between %d and %d, %s included", bst.Hash, startHash, endHash, bst.Key)
+	keyIndexLogger.Debug("Included in traversal", "key_hash", bst.Hash, "lower_bound", startHash, "upper_bound", endHash)
 
 	if bst.Right != nil {
 		keys = append(keys, bst.Right.KeysLessThan(endHash)...)
@@ -296,7 +320,7 @@ func (bst *BST) AllKeys() []string {
 	}
 
 	traversal = append(traversal, bst.Key)
-	log.Printf("[DEBUG] %s included in traversal", bst.Key)
+	keyIndexLogger.Debug("Included in traversal", "key_hash", bst.Hash)
 
 	if bst.Left != nil {
 		traversal = append(traversal, bst.Left.AllKeys()...)
@@ -309,6 +333,40 @@ func (bst *BST) AllKeys() []string {
 	return traversal
 }
 
+func (bst *BST) Count() uint64 {
+	if !bst.Set {
+		return 0
+	}
+
+	var count uint64 = 1
+
+	if bst.Left != nil {
+		count += bst.Left.Count()
+	}
+	if bst.Right != nil {
+		count += bst.Right.Count()
+	}
+
+	return count
+}
+
+func (bst *BST) Depth() uint64 {
+	if !bst.Set {
+		return 0
+	}
+
+	var leftDepth, rightDepth uint64
+
+	if bst.Left != nil {
+		leftDepth = bst.Left.Depth()
+	}
+	if bst.Right != nil {
+		rightDepth = bst.Right.Depth()
+	}
+
+	return 1 + max(leftDepth, rightDepth)
+}
+
 func (bst *BST) Visualize() {
 	if !bst.Set {
 		return
@@ -322,7 +380,7 @@ func (bst *BST) Visualize() {
 		rightKey = bst.Right.Key
 	}
 
-	log.Printf("[INFO] %s: L %s R %s", bst.Key, leftKey, rightKey)
+	keyIndexLogger.Info("Key index node", "key", bst.Key, "left", leftKey, "right", rightKey)
 
 	if bst.Left != nil {
 		bst.Left.Visualize()
@@ -332,52 +390,29 @@ func (bst *BST) Visualize() {
 	}
 }
 
+// Insert keys median-first so that a batch inserted into an empty (sub)tree stays balanced.
 func (bst *BST) InsertBatch(keys []string, hashFunc func(key string) uint64) {
-	if len(keys) == 0 {
-		return
-	}
-
-	if !bst.Set {
-		slices.SortFunc(keys, func(key1, key2 string) int {
-			if hashFunc(key1) < hashFunc(key2) {
-				return -1
-			}
-			if hashFunc(key1) == hashFunc(key2) {
-				return 0
-			}
-			return 1
-		})
-
-		midKey := keys[len(keys)/2]
-		bst.Insert(midKey, hashFunc(midKey), bst.Parent)
-	}
-
-	var leftKeys, rightKeys []string
-	var leftNodeKey, rightNodeKey string
-
+	hashes := make(map[string]uint64, len(keys))
 	for _, key := range keys {
-		if hashFunc(key) < bst.Hash {
-			leftKeys = append(leftKeys, key)
-			if key > leftNodeKey {
-				leftNodeKey = key
-			}
-		} else if hashFunc(key) > bst.Hash {
-			rightKeys = append(rightKeys, key)
-			if key < rightNodeKey {
-				rightNodeKey = key
-			}
-		}
+		hashes[key] = hashFunc(key)
 	}
 
-	if bst.Left == nil {
-		bst.Left = NewBST(leftNodeKey, hashFunc(leftNodeKey), nil, nil, bst)
-	}
+	sorted := slices.Clone(keys)
+	slices.SortFunc(sorted, func(key1, key2 string) int {
+		return cmp.Compare(hashes[key1], hashes[key2])
+	})
 
-	bst.Left.InsertBatch(leftKeys, hashFunc)
+	var insertMedians func(keys []string)
+	insertMedians = func(keys []string) {
+		if len(keys) == 0 {
+			return
+		}
 
-	if bst.Right == nil {
-		bst.Right = NewBST(rightNodeKey, hashFunc(rightNodeKey), nil, nil, bst)
+		mid := len(keys) / 2
+		bst.Insert(keys[mid], hashes[keys[mid]], nil)
+		insertMedians(keys[:mid])
+		insertMedians(keys[mid+1:])
 	}
 
-	bst.Right.InsertBatch(rightKeys, hashFunc)
+	insertMedians(sorted)
 }
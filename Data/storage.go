@@ -0,0 +1,657 @@
+package data
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Durable storage: every mutation is appended to a write-ahead log before it is applied, and the
+// log is periodically compacted into a snapshot. A generation number ties the two together:
+// snapshot-N holds every mutation logged before wal-N, so recovery loads the newest valid snapshot
+// and replays the logs from its generation onwards.
+
+type FsyncPolicy int
+
+const (
+	// Sync the log after every mutation.
+	FsyncAlways FsyncPolicy = iota
+	// Sync the log every fsyncInterval; a crash may lose the last interval of writes.
+	FsyncInterval
+	// Leave syncing to the operating system.
+	FsyncNever
+)
+
+const fsyncInterval time.Duration = 1 * time.Second
+const snapshotInterval time.Duration = 5 * time.Minute
+
+// Compact once the current log holds this many records, even before snapshotInterval.
+const snapshotThreshold int = 10000
+
+func ParseFsyncPolicy(policy string) (FsyncPolicy, error) {
+	switch policy {
+	case "always":
+		return FsyncAlways, nil
+	case "interval":
+		return FsyncInterval, nil
+	case "never":
+		return FsyncNever, nil
+	}
+
+	return 0, fmt.Errorf("unknown fsync policy %q (expected always, interval or never)", policy)
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+type walRecord struct {
+	Op    string
+	Key   string
+	Value *Value `json:",omitempty"`
+}
+
+type Storage struct {
+	dir        string
+	policy     FsyncPolicy
+	generation uint64
+	wal        *os.File
+	writer     *bufio.Writer
+	records    int
+	closed     bool
+	lock       sync.Mutex
+}
+
+// Open the storage in dir, creating it if needed, and recover its contents.
+func OpenStorage(dir string, policy FsyncPolicy) (*Storage, map[string]Value, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	storage := &Storage{dir: dir, policy: policy}
+
+	kvMap, err := storage.recover()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = storage.openWAL(storage.generation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return storage, kvMap, nil
+}
+
+func (storage *Storage) walPath(generation uint64) string {
+	return filepath.Join(storage.dir, fmt.Sprintf("wal-%020d.log", generation))
+}
+
+func (storage *Storage) snapshotPath(generation uint64) string {
+	return filepath.Join(storage.dir, fmt.Sprintf("snapshot-%020d.json", generation))
+}
+
+// Generations of the files in the storage directory with the given prefix, in ascending order.
+func (storage *Storage) generations(prefix string, suffix string) ([]uint64, error) {
+	entries, err := os.ReadDir(storage.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var generations []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		var generation uint64
+		_, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), "%d", &generation)
+		if err == nil {
+			generations = append(generations, generation)
+		}
+	}
+
+	sort.Slice(generations, func(i, j int) bool { return generations[i] < generations[j] })
+
+	return generations, nil
+}
+
+func (storage *Storage) recover() (map[string]Value, error) {
+	kvMap := make(map[string]Value)
+
+	snapshots, err := storage.generations("snapshot-", ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the newest snapshot that can be read. An older one is only left by a compaction interrupted before
+	// it removed the files it superseded, which removes the logs first: an older snapshot is complete only if
+	// the logs since its generation are still there.
+	skipped := 0
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshotBytes, err := os.ReadFile(storage.snapshotPath(snapshots[i]))
+		if err == nil {
+			snapshot := make(map[string]Value)
+			if err = json.Unmarshal(snapshotBytes, &snapshot); err == nil {
+				kvMap = snapshot
+				storage.generation = snapshots[i]
+				break
+			}
+		}
+
+		logger.Warn("Skipping unreadable snapshot", "generation", snapshots[i], "err", err)
+		skipped++
+	}
+
+	logs, err := storage.generations("wal-", ".log")
+	if err != nil {
+		return nil, err
+	}
+
+	if skipped > 0 && skipped < len(snapshots) && !slices.Contains(logs, storage.generation) {
+		logger.Error("Recovered from an older snapshot whose logs were compacted away, writes since it are lost", "generation", storage.generation)
+	}
+
+	var replayed int
+	for _, generation := range logs {
+		if generation < storage.generation {
+			continue
+		}
+
+		records, err := storage.replay(generation, kvMap)
+		if err != nil {
+			return nil, err
+		}
+
+		replayed += records
+		storage.generation = generation
+	}
+
+	logger.Info("Recovered storage", "dir", storage.dir, "keys", len(kvMap), "replayed_records", replayed, "generation", storage.generation)
+
+	return kvMap, nil
+}
+
+// Apply one log's records to kvMap. A torn or corrupt record ends the log: it can only be the
+// tail of a write that was interrupted by a crash, so the log is truncated there.
+func (storage *Storage) replay(generation uint64, kvMap map[string]Value) (int, error) {
+	file, err := os.OpenFile(storage.walPath(generation), os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	var records int
+
+	for {
+		record, size, err := readRecord(reader)
+
+		if err == io.EOF {
+			return records, nil
+		}
+
+		if err != nil {
+			logger.Warn("Truncating write-ahead log at a torn record", "generation", generation, "offset", offset, "err", err)
+			return records, file.Truncate(offset)
+		}
+
+		switch record.Op {
+		case opPut:
+			kvMap[record.Key] = *record.Value
+		case opDelete:
+			delete(kvMap, record.Key)
+		}
+
+		offset += size
+		records++
+	}
+}
+
+// Records are framed as [length uint32][crc32 uint32][JSON payload].
+func readRecord(reader io.Reader) (*walRecord, int64, error) {
+	header := make([]byte, 8)
+
+	n, err := io.ReadFull(reader, header)
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("short header (%d bytes): %w", n, err)
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	checksum := binary.BigEndian.Uint32(header[4:])
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return nil, 0, fmt.Errorf("short payload: %w", err)
+	}
+
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+
+	record := &walRecord{}
+	err = json.Unmarshal(payload, record)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if record.Op == opPut && record.Value == nil {
+		return nil, 0, errors.New("put record without a value")
+	}
+
+	return record, int64(len(header) + len(payload)), nil
+}
+
+func (storage *Storage) openWAL(generation uint64) error {
+	wal, err := os.OpenFile(storage.walPath(generation), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	storage.wal = wal
+	storage.writer = bufio.NewWriter(wal)
+	storage.generation = generation
+	storage.records = 0
+
+	return syncDir(storage.dir)
+}
+
+func (storage *Storage) append(record *walRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], crc32.ChecksumIEEE(payload))
+
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if _, err = storage.writer.Write(header); err != nil {
+		return err
+	}
+	if _, err = storage.writer.Write(payload); err != nil {
+		return err
+	}
+
+	storage.records++
+
+	if storage.policy == FsyncAlways {
+		return storage.sync()
+	}
+
+	// Hand the record to the operating system even if it will not be synced yet.
+	return storage.writer.Flush()
+}
+
+// Must be called with the lock held.
+func (storage *Storage) sync() error {
+	if err := storage.writer.Flush(); err != nil {
+		return err
+	}
+	return storage.wal.Sync()
+}
+
+func (storage *Storage) LogPut(key string, value Value) error {
+	return storage.append(&walRecord{Op: opPut, Key: key, Value: &value})
+}
+
+func (storage *Storage) LogDelete(key string) error {
+	return storage.append(&walRecord{Op: opDelete, Key: key})
+}
+
+func (storage *Storage) needsCompaction() bool {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	return storage.records >= snapshotThreshold
+}
+
+func (storage *Storage) isClosed() bool {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	return storage.closed
+}
+
+// Start a new log generation. The caller must prevent concurrent appends so that the snapshot
+// taken alongside the rotation holds exactly the mutations of the previous generations.
+func (storage *Storage) rotate() (uint64, error) {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	if err := storage.sync(); err != nil {
+		return 0, err
+	}
+
+	previous := storage.wal
+	if err := storage.openWAL(storage.generation + 1); err != nil {
+		return 0, err
+	}
+
+	previous.Close()
+
+	return storage.generation, nil
+}
+
+// Write the snapshot for a generation, then drop the logs and snapshots it supersedes.
+func (storage *Storage) compact(generation uint64, kvMap map[string]Value) error {
+	snapshotBytes, err := json.Marshal(kvMap)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := storage.snapshotPath(generation) + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(snapshotBytes)
+	if err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err = os.Rename(tmpPath, storage.snapshotPath(generation)); err != nil {
+		return err
+	}
+
+	if err = syncDir(storage.dir); err != nil {
+		return err
+	}
+
+	logs, _ := storage.generations("wal-", ".log")
+	for _, old := range logs {
+		if old < generation {
+			os.Remove(storage.walPath(old))
+		}
+	}
+
+	snapshots, _ := storage.generations("snapshot-", ".json")
+	for _, old := range snapshots {
+		if old < generation {
+			os.Remove(storage.snapshotPath(old))
+		}
+	}
+
+	logger.Info("Compacted storage", "generation", generation, "keys", len(kvMap))
+
+	return nil
+}
+
+func (storage *Storage) Close() error {
+	storage.lock.Lock()
+	defer storage.lock.Unlock()
+
+	storage.closed = true
+
+	if err := storage.sync(); err != nil {
+		return err
+	}
+	return storage.wal.Close()
+}
+
+func syncDir(dir string) error {
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+
+	return dirFile.Sync()
+}
+
+// Durable backend: an in-memory map and index whose every mutation is written to the log first.
+
+type DiskStore struct {
+	// Mutations log under the write lock, so the log order matches the order they are applied in.
+	lock    sync.RWMutex
+	storage *Storage
+	indexedMap
+}
+
+// Recover the store's contents from dir and log every subsequent mutation there.
+func OpenDiskStore(dir string, policy FsyncPolicy, hashFunc func(key string) uint64) (*DiskStore, error) {
+	storage, kvMap, err := OpenStorage(dir, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &DiskStore{storage: storage, indexedMap: newIndexedMap(hashFunc)}
+	store.load(kvMap)
+
+	go store.maintain()
+
+	return store, nil
+}
+
+func (store *DiskStore) Get(key string) (Value, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.get(key)
+}
+
+func (store *DiskStore) Entry(key string) (Value, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.entry(key)
+}
+
+func (store *DiskStore) Put(key string, value Value, precondition Precondition) (Value, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	value, found, err := store.prepare(key, value, precondition)
+	if err != nil {
+		return Value{}, found, err
+	}
+
+	if err := store.storage.LogPut(key, value); err != nil {
+		return Value{}, found, err
+	}
+
+	store.put(key, value)
+	return value, found, nil
+}
+
+// The tombstone is logged as a put, so it survives restarts and snapshots until it is purged.
+func (store *DiskStore) Delete(key string, precondition Precondition) (Value, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	found, err := store.check(key, precondition)
+	if err != nil || !found {
+		return Value{}, false, err
+	}
+
+	tombstone := store.tombstone(key)
+
+	if err := store.storage.LogPut(key, tombstone); err != nil {
+		return Value{}, true, err
+	}
+
+	store.put(key, tombstone)
+	return tombstone, true, nil
+}
+
+func (store *DiskStore) Range(startHash, endHash uint64, visit func(key string, value Value) bool) {
+	store.lock.RLock()
+	entries := store.entries(startHash, endHash)
+	store.lock.RUnlock()
+
+	visitEntries(entries, visit)
+}
+
+func (store *DiskStore) Apply(mutations []Mutation) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, mutation := range mutations {
+		if !store.accepts(mutation) {
+			continue
+		}
+
+		var err error
+		if mutation.Value == nil {
+			err = store.storage.LogDelete(mutation.Key)
+		} else {
+			err = store.storage.LogPut(mutation.Key, *mutation.Value)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		store.apply(mutation)
+	}
+
+	return nil
+}
+
+func (store *DiskStore) Purge(tombstones []Mutation) (int, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	purged := 0
+	for _, tombstone := range tombstones {
+		if !store.purgeable(tombstone.Key, tombstone.Value.Version) {
+			continue
+		}
+
+		if err := store.storage.LogDelete(tombstone.Key); err != nil {
+			return purged, err
+		}
+
+		store.remove(tombstone.Key, "")
+		purged++
+	}
+
+	return purged, nil
+}
+
+// Expired keys are dropped from memory without being logged: replaying their puts recreates them
+// already expired, and the next snapshot leaves them out.
+func (store *DiskStore) Sweep() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	expired := store.expiredKeys()
+	for _, key := range expired {
+		store.remove(key, EventExpire)
+	}
+
+	return len(expired)
+}
+
+func (store *DiskStore) SetListener(listener func(Event)) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.listener = listener
+}
+
+func (store *DiskStore) Stats() StoreStats {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.stats()
+}
+
+// Sync the log under the interval policy and compact it periodically, until the store is closed.
+func (store *DiskStore) maintain() {
+	lastSnapshot := time.Now()
+
+	for {
+		time.Sleep(fsyncInterval)
+
+		if store.storage.isClosed() {
+			return
+		}
+
+		if store.storage.policy == FsyncInterval {
+			store.storage.lock.Lock()
+			err := store.storage.sync()
+			store.storage.lock.Unlock()
+
+			if err != nil {
+				logger.Error("Syncing write-ahead log failed", "err", err)
+			}
+		}
+
+		if time.Since(lastSnapshot) < snapshotInterval && !store.storage.needsCompaction() {
+			continue
+		}
+
+		if err := store.Compact(); err != nil {
+			logger.Error("Compacting storage failed", "err", err)
+			continue
+		}
+
+		lastSnapshot = time.Now()
+	}
+}
+
+// Snapshot the current contents and drop the write-ahead log records they cover.
+func (store *DiskStore) Compact() error {
+	// Holding the read lock keeps writers out while the log is rotated and the map copied.
+	store.lock.RLock()
+	if store.storage.isClosed() {
+		store.lock.RUnlock()
+		return nil
+	}
+
+	generation, err := store.storage.rotate()
+	if err != nil {
+		store.lock.RUnlock()
+		return err
+	}
+
+	now := time.Now()
+	kvMap := make(map[string]Value, len(store.kvMap))
+	for key, value := range store.kvMap {
+		if !value.expired(now) {
+			kvMap[key] = value
+		}
+	}
+	store.lock.RUnlock()
+
+	return store.storage.compact(generation, kvMap)
+}
+
+// Flush and close the write-ahead log.
+func (store *DiskStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.storage.isClosed() {
+		return nil
+	}
+
+	return store.storage.Close()
+}
@@ -0,0 +1,130 @@
+package data
+
+import (
+	"os"
+	"testing"
+)
+
+func openTestStorage(t *testing.T, dir string) (*Storage, map[string]Value) {
+	t.Helper()
+
+	storage, kvMap, err := OpenStorage(dir, FsyncAlways)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage, kvMap
+}
+
+func walSize(t *testing.T, storage *Storage) int64 {
+	t.Helper()
+
+	info, err := os.Stat(storage.walPath(storage.generation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestRecoverTornRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		// Damage the last record, which starts at offset in the log at path.
+		damage func(t *testing.T, path string, offset int64)
+	}{
+		{"truncated header", func(t *testing.T, path string, offset int64) {
+			if err := os.Truncate(path, offset+3); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"truncated payload", func(t *testing.T, path string, offset int64) {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(path, info.Size()-2); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"corrupt payload", func(t *testing.T, path string, offset int64) {
+			log, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			log[len(log)-2] ^= 0xff
+			if err := os.WriteFile(path, log, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			storage, _ := openTestStorage(t, dir)
+			if err := storage.LogPut("a", Value{Data: []byte("1"), Version: 1}); err != nil {
+				t.Fatal(err)
+			}
+			intact := walSize(t, storage)
+			if err := storage.LogPut("b", Value{Data: []byte("2"), Version: 1}); err != nil {
+				t.Fatal(err)
+			}
+			path := storage.walPath(storage.generation)
+			storage.Close()
+
+			test.damage(t, path, intact)
+
+			storage, kvMap := openTestStorage(t, dir)
+			if _, found := kvMap["a"]; !found || len(kvMap) != 1 {
+				t.Fatalf("recovered %v, want only a", kvMap)
+			}
+			if size := walSize(t, storage); size != intact {
+				t.Fatalf("log is %d bytes after recovery, want it truncated to %d", size, intact)
+			}
+
+			// Records appended after the truncation are replayed on the next recovery.
+			if err := storage.LogPut("c", Value{Data: []byte("3"), Version: 1}); err != nil {
+				t.Fatal(err)
+			}
+			storage.Close()
+
+			storage, kvMap = openTestStorage(t, dir)
+			defer storage.Close()
+			if _, found := kvMap["c"]; !found || len(kvMap) != 2 {
+				t.Fatalf("recovered %v, want a and c", kvMap)
+			}
+		})
+	}
+}
+
+func TestRecoverSnapshotAndLog(t *testing.T) {
+	dir := t.TempDir()
+
+	storage, _ := openTestStorage(t, dir)
+	storage.LogPut("a", Value{Data: []byte("1"), Version: 1})
+
+	generation, err := storage.rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.compact(generation, map[string]Value{"a": {Data: []byte("1"), Version: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(storage.walPath(generation - 1)); !os.IsNotExist(err) {
+		t.Fatalf("superseded log still exists: %v", err)
+	}
+
+	storage.LogPut("b", Value{Data: []byte("2"), Version: 1})
+	storage.LogDelete("a")
+	storage.Close()
+
+	storage, kvMap := openTestStorage(t, dir)
+	defer storage.Close()
+
+	if _, found := kvMap["b"]; !found || len(kvMap) != 1 {
+		t.Fatalf("recovered %v, want only b", kvMap)
+	}
+	if storage.generation != generation {
+		t.Fatalf("recovered generation %d, want %d", storage.generation, generation)
+	}
+}
@@ -0,0 +1,445 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Storage backend of a DataServer. Implementations are safe for concurrent use and keep a key
+// index ordered by hash, so that the overlay can select the keys of an arc without its own index.
+type Store interface {
+	// Get returns a key's live value: deleted and expired keys are not found.
+	Get(key string) (Value, bool)
+	// Entry returns what the store holds for a key, including a tombstone.
+	Entry(key string) (Value, bool)
+	// Put stores value under a new version if precondition (when not nil) holds, returning the stored
+	// value and whether the key already existed.
+	Put(key string, value Value, precondition Precondition) (Value, bool, error)
+	// Delete replaces the key with a tombstone if it exists and precondition (when not nil) holds,
+	// returning the tombstone and whether the key existed.
+	Delete(key string, precondition Precondition) (Value, bool, error)
+	// Visit every key whose hash lies in the arc (startHash, endHash], wrapping around zero when
+	// endHash <= startHash, until visit returns false. Tombstones are visited too.
+	Range(startHash, endHash uint64, visit func(key string, value Value) bool)
+	// Apply a batch of mutations, e.g. the contents of a transfer. Puts (tombstones included) keep their
+	// versions and are skipped when the store already holds the key at the same or a newer version.
+	Apply(mutations []Mutation) error
+	// Drop the given tombstones where the store holds them at the same or an older version, returning
+	// how many were dropped.
+	Purge(tombstones []Mutation) (int, error)
+	// Remove expired keys, returning how many were removed.
+	Sweep() int
+	// Report every subsequent change to listener, which is called with the store locked and must not block.
+	SetListener(listener func(Event))
+	Stats() StoreStats
+	Close() error
+}
+
+// Condition on a key's current value (found is false when the key does not exist) for a write to go ahead.
+type Precondition func(current Value, found bool) bool
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// A put (of a tombstone, for a delete), or when Value is nil the removal of the key outright, e.g.
+// once it has been handed off to its owner.
+type Mutation struct {
+	Key   string
+	Value *Value
+}
+
+type StoreStats struct {
+	// Live keys; tombstones are counted apart.
+	Keys       uint64
+	Tombstones uint64
+	Bytes      uint64
+	IndexDepth uint64
+}
+
+const (
+	MemoryBackend = "memory"
+	DiskBackend   = "disk"
+	CacheBackend  = "cache"
+)
+
+type StoreOptions struct {
+	Backend string
+	// Directory and fsync policy of the disk backend.
+	Dir   string
+	Fsync FsyncPolicy
+	// Capacity of the cache backend, in bytes of keys, values and content types.
+	MaxBytes uint64
+}
+
+// Open the backend selected by options. hashFunc places keys on the ring.
+func OpenStore(options StoreOptions, hashFunc func(key string) uint64) (Store, error) {
+	switch options.Backend {
+	case MemoryBackend, "":
+		return NewMemoryStore(hashFunc), nil
+	case DiskBackend:
+		if options.Dir == "" {
+			return nil, fmt.Errorf("the disk backend needs a data directory")
+		}
+		return OpenDiskStore(options.Dir, options.Fsync, hashFunc)
+	case CacheBackend:
+		if options.MaxBytes == 0 {
+			return nil, fmt.Errorf("the cache backend needs a size limit")
+		}
+		return NewCacheStore(options.MaxBytes, hashFunc), nil
+	}
+
+	return nil, fmt.Errorf("unknown store backend %q (expected memory, disk or cache)", options.Backend)
+}
+
+// Map plus key index shared by the backends. It is not synchronised: each backend guards it with its own lock.
+type indexedMap struct {
+	kvMap    map[string]Value
+	sizes    map[string]uint64
+	bytes    uint64
+	index    *KeyIndex
+	hashFunc func(key string) uint64
+	listener func(Event)
+
+	// Entries of kvMap that are tombstones.
+	tombstones uint64
+}
+
+func newIndexedMap(hashFunc func(key string) uint64) indexedMap {
+	return indexedMap{
+		kvMap:    make(map[string]Value),
+		sizes:    make(map[string]uint64),
+		index:    NewKeyIndex(),
+		hashFunc: hashFunc,
+	}
+}
+
+func valueSize(key string, value Value) uint64 {
+	return uint64(len(key) + len(value.Data) + len(value.ContentType))
+}
+
+// The live value of a key: tombstones are not found, and expired keys are invisible from the moment
+// they expire, before the sweeper removes them.
+func (indexedMap *indexedMap) get(key string) (Value, bool) {
+	value, found := indexedMap.entry(key)
+	if value.Deleted {
+		return Value{}, false
+	}
+	return value, found
+}
+
+// The stored value of a key, tombstone or not.
+func (indexedMap *indexedMap) entry(key string) (Value, bool) {
+	value, found := indexedMap.kvMap[key]
+	if found && value.expired(time.Now()) {
+		return Value{}, false
+	}
+	return value, found
+}
+
+// Store a value or tombstone, reporting a tombstone as the deletion of a live key.
+func (indexedMap *indexedMap) put(key string, value Value) bool {
+	size := valueSize(key, value)
+	_, live := indexedMap.get(key)
+
+	oldSize, found := indexedMap.sizes[key]
+	if found {
+		indexedMap.bytes -= oldSize
+		if indexedMap.kvMap[key].Deleted {
+			indexedMap.tombstones--
+		}
+	} else {
+		indexedMap.index.Insert(key, indexedMap.hashFunc(key))
+	}
+
+	indexedMap.kvMap[key] = value
+	indexedMap.sizes[key] = size
+	indexedMap.bytes += size
+
+	if value.Deleted {
+		indexedMap.tombstones++
+		if live {
+			indexedMap.notify(Event{Type: EventDelete, Key: key, Version: value.Version})
+		}
+	} else {
+		indexedMap.notify(Event{Type: EventPut, Key: key, Version: value.Version, Value: &value})
+	}
+
+	return found
+}
+
+// A tombstone versioned after the key's value.
+func (indexedMap *indexedMap) tombstone(key string) Value {
+	return Value{Version: nextVersion(indexedMap.kvMap[key].Version), Deleted: true}
+}
+
+// Replace a key with a tombstone.
+func (indexedMap *indexedMap) delete(key string) Value {
+	tombstone := indexedMap.tombstone(key)
+	indexedMap.put(key, tombstone)
+	return tombstone
+}
+
+// Whether the store holds the key as a tombstone no newer than version.
+func (indexedMap *indexedMap) purgeable(key string, version uint64) bool {
+	current, found := indexedMap.kvMap[key]
+	return found && current.Deleted && current.Version <= version
+}
+
+// Remove a key, reporting the removal as eventType (nothing is reported when it is empty).
+func (indexedMap *indexedMap) remove(key string, eventType string) bool {
+	size, found := indexedMap.sizes[key]
+	if !found {
+		return false
+	}
+
+	current := indexedMap.kvMap[key]
+	if current.Deleted {
+		indexedMap.tombstones--
+	}
+
+	indexedMap.index.Delete(key, indexedMap.hashFunc(key))
+	delete(indexedMap.kvMap, key)
+	delete(indexedMap.sizes, key)
+	indexedMap.bytes -= size
+
+	if eventType != "" && !current.Deleted {
+		indexedMap.notify(Event{Type: eventType, Key: key, Version: nextVersion(current.Version)})
+	}
+
+	return true
+}
+
+func (indexedMap *indexedMap) notify(event Event) {
+	if indexedMap.listener != nil {
+		indexedMap.listener(event)
+	}
+}
+
+// Check a write's precondition and version the value to be stored.
+func (indexedMap *indexedMap) prepare(key string, value Value, precondition Precondition) (Value, bool, error) {
+	current, found := indexedMap.get(key)
+
+	if precondition != nil && !precondition(current, found) {
+		return Value{}, found, ErrPreconditionFailed
+	}
+
+	// Version past a tombstone too, so the write wins over the delete wherever both are replicated.
+	entry, _ := indexedMap.entry(key)
+	value.Version = nextVersion(entry.Version)
+	value.Deleted = false
+	return value, found, nil
+}
+
+func (indexedMap *indexedMap) check(key string, precondition Precondition) (bool, error) {
+	current, found := indexedMap.get(key)
+
+	if precondition != nil && !precondition(current, found) {
+		return found, ErrPreconditionFailed
+	}
+
+	return found, nil
+}
+
+// Whether a transferred mutation changes the store: removals of present keys, and puts (tombstones
+// included) newer than what is stored.
+func (indexedMap *indexedMap) accepts(mutation Mutation) bool {
+	current, found := indexedMap.entry(mutation.Key)
+
+	if mutation.Value == nil {
+		return found
+	}
+
+	observeVersion(mutation.Value.Version)
+	return !mutation.Value.expired(time.Now()) && (!found || mutation.Value.Version > current.Version)
+}
+
+func (indexedMap *indexedMap) apply(mutation Mutation) {
+	if mutation.Value == nil {
+		indexedMap.remove(mutation.Key, EventDelete)
+	} else {
+		indexedMap.put(mutation.Key, *mutation.Value)
+	}
+}
+
+func (indexedMap *indexedMap) emptied() indexedMap {
+	emptied := newIndexedMap(indexedMap.hashFunc)
+	emptied.listener = indexedMap.listener
+	return emptied
+}
+
+// Replace the contents wholesale, e.g. with recovered data; the index is rebuilt in balanced order.
+func (indexedMap *indexedMap) load(kvMap map[string]Value) {
+	*indexedMap = indexedMap.emptied()
+
+	keys := make([]string, 0, len(kvMap))
+	for key, value := range kvMap {
+		keys = append(keys, key)
+		size := valueSize(key, value)
+		indexedMap.sizes[key] = size
+		indexedMap.bytes += size
+		if value.Deleted {
+			indexedMap.tombstones++
+		}
+	}
+
+	indexedMap.kvMap = kvMap
+	indexedMap.index.InsertKeys(keys, indexedMap.hashFunc)
+}
+
+// Collect the entries of an arc, tombstones included; visiting happens outside the caller's lock.
+func (indexedMap *indexedMap) entries(startHash, endHash uint64) []Mutation {
+	keys := indexedMap.index.KeysInArc(startHash, endHash)
+	entries := make([]Mutation, 0, len(keys))
+
+	for _, key := range keys {
+		value, found := indexedMap.entry(key)
+		if found {
+			entries = append(entries, Mutation{Key: key, Value: &value})
+		}
+	}
+
+	return entries
+}
+
+func (indexedMap *indexedMap) expiredKeys() []string {
+	now := time.Now()
+
+	var keys []string
+	for key, value := range indexedMap.kvMap {
+		if value.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (indexedMap *indexedMap) stats() StoreStats {
+	return StoreStats{
+		Keys:       uint64(len(indexedMap.kvMap)) - indexedMap.tombstones,
+		Tombstones: indexedMap.tombstones,
+		Bytes:      indexedMap.bytes,
+		IndexDepth: indexedMap.index.Depth(),
+	}
+}
+
+func visitEntries(entries []Mutation, visit func(key string, value Value) bool) {
+	for _, entry := range entries {
+		if !visit(entry.Key, *entry.Value) {
+			return
+		}
+	}
+}
+
+// In-memory backend: contents are lost when the process exits.
+
+type MemoryStore struct {
+	lock sync.RWMutex
+	indexedMap
+}
+
+func NewMemoryStore(hashFunc func(key string) uint64) *MemoryStore {
+	return &MemoryStore{indexedMap: newIndexedMap(hashFunc)}
+}
+
+func (store *MemoryStore) Get(key string) (Value, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.get(key)
+}
+
+func (store *MemoryStore) Entry(key string) (Value, bool) {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.entry(key)
+}
+
+func (store *MemoryStore) Put(key string, value Value, precondition Precondition) (Value, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	value, found, err := store.prepare(key, value, precondition)
+	if err != nil {
+		return Value{}, found, err
+	}
+
+	store.put(key, value)
+	return value, found, nil
+}
+
+func (store *MemoryStore) Delete(key string, precondition Precondition) (Value, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	found, err := store.check(key, precondition)
+	if err != nil || !found {
+		return Value{}, false, err
+	}
+
+	return store.delete(key), true, nil
+}
+
+func (store *MemoryStore) Range(startHash, endHash uint64, visit func(key string, value Value) bool) {
+	store.lock.RLock()
+	entries := store.entries(startHash, endHash)
+	store.lock.RUnlock()
+
+	visitEntries(entries, visit)
+}
+
+func (store *MemoryStore) Apply(mutations []Mutation) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	for _, mutation := range mutations {
+		if store.accepts(mutation) {
+			store.apply(mutation)
+		}
+	}
+
+	return nil
+}
+
+func (store *MemoryStore) Purge(tombstones []Mutation) (int, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	purged := 0
+	for _, tombstone := range tombstones {
+		if store.purgeable(tombstone.Key, tombstone.Value.Version) {
+			store.remove(tombstone.Key, "")
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (store *MemoryStore) Sweep() int {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	expired := store.expiredKeys()
+	for _, key := range expired {
+		store.remove(key, EventExpire)
+	}
+
+	return len(expired)
+}
+
+func (store *MemoryStore) SetListener(listener func(Event)) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.listener = listener
+}
+
+func (store *MemoryStore) Stats() StoreStats {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	return store.stats()
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Versions are hybrid logical timestamps: nanoseconds of wall-clock time, bumped past the previous
+// version of the key and every version this node has issued or received. They stay unique and
+// increasing per key across deletes and ownership changes, so an ETag is never reused.
+var lastVersion atomic.Uint64
+
+func nextVersion(current uint64) uint64 {
+	for {
+		last := lastVersion.Load()
+		version := max(uint64(time.Now().UnixNano()), last+1, current+1)
+
+		if lastVersion.CompareAndSwap(last, version) {
+			return version
+		}
+	}
+}
+
+// A version newer than current and than every version this node has seen, for a write coordinated elsewhere.
+func NextVersion(current uint64) uint64 {
+	return nextVersion(current)
+}
+
+// Advance the clock past a version received from another node.
+func observeVersion(version uint64) {
+	for {
+		last := lastVersion.Load()
+		if version <= last || lastVersion.CompareAndSwap(last, version) {
+			return
+		}
+	}
+}
+
+func FormatETag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// Whether an If-Match/If-None-Match header value ("*" or a list of ETags) matches the current value.
+func etagsMatch(header string, current Value, found bool) bool {
+	if !found {
+		return false
+	}
+
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+
+		if etag == "*" || etag == FormatETag(current.Version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Precondition of a write from its If-Match and If-None-Match headers; nil for an unconditional write.
+func RequestPrecondition(r *http.Request) Precondition {
+	return HeaderPrecondition(r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))
+}
+
+// Precondition from If-Match and If-None-Match header values, e.g. as forwarded by another node.
+func HeaderPrecondition(ifMatch string, ifNoneMatch string) Precondition {
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	return func(current Value, found bool) bool {
+		if ifMatch != "" && !etagsMatch(ifMatch, current, found) {
+			return false
+		}
+		if ifNoneMatch != "" && etagsMatch(ifNoneMatch, current, found) {
+			return false
+		}
+		return true
+	}
+}
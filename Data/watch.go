@@ -0,0 +1,98 @@
+package data
+
+import (
+	"strings"
+	"sync"
+)
+
+// Change notifications: stores report every change to their listener, and Watchers fans them out
+// to the subscriptions whose key or prefix matches.
+
+const (
+	EventPut    = "put"
+	EventDelete = "delete"
+	EventExpire = "expire"
+	// The cache backend dropped the key to stay within its size limit.
+	EventEvict = "evict"
+)
+
+type Event struct {
+	Type string
+	Key  string
+	// The put value's version, or a version newer than the removed value's for other events.
+	Version uint64
+	// Set for puts.
+	Value *Value
+}
+
+// Events buffered per subscription; a subscription that falls further behind is closed.
+const watchBuffer int = 256
+
+type Subscription struct {
+	Key    string
+	Prefix bool
+	// Closed when the subscription is cancelled or falls behind.
+	Events chan Event
+	closed bool
+}
+
+func (subscription *Subscription) Matches(key string) bool {
+	if subscription.Prefix {
+		return strings.HasPrefix(key, subscription.Key)
+	}
+	return key == subscription.Key
+}
+
+type Watchers struct {
+	subscriptions map[*Subscription]bool
+	lock          sync.Mutex
+}
+
+func NewWatchers() *Watchers {
+	return &Watchers{subscriptions: make(map[*Subscription]bool)}
+}
+
+func (watchers *Watchers) Subscribe(key string, prefix bool) *Subscription {
+	subscription := &Subscription{Key: key, Prefix: prefix, Events: make(chan Event, watchBuffer)}
+
+	watchers.lock.Lock()
+	watchers.subscriptions[subscription] = true
+	watchers.lock.Unlock()
+
+	return subscription
+}
+
+func (watchers *Watchers) Unsubscribe(subscription *Subscription) {
+	watchers.lock.Lock()
+	defer watchers.lock.Unlock()
+
+	watchers.close(subscription)
+}
+
+// Must be called with the lock held.
+func (watchers *Watchers) close(subscription *Subscription) {
+	if !subscription.closed {
+		subscription.closed = true
+		close(subscription.Events)
+	}
+	delete(watchers.subscriptions, subscription)
+}
+
+// Deliver an event without blocking the store that reported it.
+func (watchers *Watchers) Publish(event Event) {
+	watchers.lock.Lock()
+	defer watchers.lock.Unlock()
+
+	for subscription := range watchers.subscriptions {
+		if !subscription.Matches(event.Key) {
+			continue
+		}
+
+		select {
+		case subscription.Events <- event:
+		default:
+			logger.Warn("Closing watch subscription that fell behind", "key", subscription.Key, "prefix", subscription.Prefix)
+			watchers.close(subscription)
+		}
+	}
+}
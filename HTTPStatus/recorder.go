@@ -0,0 +1,25 @@
+package httpstatus
+
+import "net/http"
+
+// The status code of a response, shared by the HTTP middlewares that report on it (metrics and tracing).
+
+type Recorder struct {
+	http.ResponseWriter
+	// The status written by the handler; 200 if it wrote none.
+	Status int
+}
+
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (recorder *Recorder) WriteHeader(status int) {
+	recorder.Status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+// Expose the underlying writer so that http.ResponseController can flush streamed responses.
+func (recorder *Recorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
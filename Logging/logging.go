@@ -0,0 +1,186 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Structured, leveled logging shared by every package. Each subsystem has its own level that can be
+// changed at runtime, and stored values are redacted from log records unless explicitly enabled.
+
+const (
+	Overlay     = "overlay"
+	Maintenance = "maintenance"
+	KeyIndex    = "keyindex"
+	Data        = "data"
+)
+
+var levels = map[string]*slog.LevelVar{
+	Overlay:     new(slog.LevelVar),
+	Maintenance: new(slog.LevelVar),
+	KeyIndex:    new(slog.LevelVar),
+	Data:        new(slog.LevelVar),
+}
+
+var base atomic.Pointer[slog.Handler]
+var showValues atomic.Bool
+var configureLock sync.Mutex
+
+func init() {
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	base.Store(&handler)
+}
+
+// Set the output and format of every logger; attrs (e.g. the node's IP and ID) are attached to every record.
+func Configure(w io.Writer, json bool, attrs ...any) {
+	configureLock.Lock()
+	defer configureLock.Unlock()
+
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var handler slog.Handler
+	if json {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	handler = slog.New(handler).With(attrs...).Handler()
+	base.Store(&handler)
+}
+
+// Logger for a subsystem. Loggers may be created before Configure is called.
+func Logger(subsystem string) *slog.Logger {
+	level, ok := levels[subsystem]
+	if !ok {
+		panic("logging: unknown subsystem " + subsystem)
+	}
+
+	return slog.New(&subsystemHandler{level: level}).With("subsystem", subsystem)
+}
+
+func SetLevel(subsystem string, level slog.Level) error {
+	levelVar, ok := levels[subsystem]
+	if !ok {
+		return fmt.Errorf("unknown subsystem %q", subsystem)
+	}
+
+	levelVar.Set(level)
+	return nil
+}
+
+func Levels() map[string]slog.Level {
+	current := make(map[string]slog.Level)
+	for subsystem, level := range levels {
+		current[subsystem] = level.Level()
+	}
+	return current
+}
+
+func Subsystems() []string {
+	var subsystems []string
+	for subsystem := range levels {
+		subsystems = append(subsystems, subsystem)
+	}
+	sort.Strings(subsystems)
+	return subsystems
+}
+
+// Parse a level specification: either a single level for every subsystem ("debug"), or a
+// comma-separated list of subsystem=level pairs ("overlay=debug,keyindex=warn").
+func SetLevels(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		subsystem, levelName, scoped := strings.Cut(part, "=")
+		if !scoped {
+			levelName = subsystem
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(levelName)); err != nil {
+			return err
+		}
+
+		if !scoped {
+			for _, levelVar := range levels {
+				levelVar.Set(level)
+			}
+			continue
+		}
+
+		if err := SetLevel(subsystem, level); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Include stored values in log records instead of redacting them.
+func ShowValues(show bool) {
+	showValues.Store(show)
+}
+
+// Whether stored values are included in log records.
+func ShowingValues() bool {
+	return showValues.Load()
+}
+
+type redacted struct {
+	value any
+}
+
+func (r redacted) LogValue() slog.Value {
+	if showValues.Load() {
+		return slog.AnyValue(r.value)
+	}
+	return slog.StringValue("[REDACTED]")
+}
+
+// Attribute for a stored value, redacted unless ShowValues(true) was called.
+func Value(value any) slog.Attr {
+	return slog.Any("value", redacted{value})
+}
+
+// subsystemHandler filters by its subsystem's level and forwards to the current base handler,
+// replaying any With/WithGroup calls made on the logger.
+type subsystemHandler struct {
+	level *slog.LevelVar
+	ops   []func(slog.Handler) slog.Handler
+}
+
+func (handler *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= handler.level.Level()
+}
+
+func (handler *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	next := *base.Load()
+	for _, op := range handler.ops {
+		next = op(next)
+	}
+	return next.Handle(ctx, record)
+}
+
+func (handler *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (handler *subsystemHandler) WithGroup(name string) slog.Handler {
+	return handler.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (handler *subsystemHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	ops := append(append([]func(slog.Handler) slog.Handler(nil), handler.ops...), op)
+	return &subsystemHandler{level: handler.level, ops: ops}
+}
@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	httpstatus "github.com/girivad/go-chord/HTTPStatus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+)
+
+// Prometheus metrics for the overlay and data layers, exposed on the data server at /metrics.
+
+const namespace = "chord"
+
+// Overlay
+
+var Lookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "lookups_total",
+	Help:      "Successor lookups originated by this node, by result.",
+}, []string{"result"})
+
+var LookupDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "lookup_duration_seconds",
+	Help:      "Latency of successor lookups originated by this node.",
+	Buckets:   prometheus.DefBuckets,
+})
+
+var LookupHops = promauto.NewHistogram(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "lookup_hops",
+	Help:      "Number of nodes a successor lookup was forwarded through.",
+	Buckets:   prometheus.LinearBuckets(0, 1, 16),
+})
+
+var RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rpc_errors_total",
+	Help:      "Failed outgoing gRPC calls, by peer and method.",
+}, []string{"peer", "method"})
+
+var StabilizeEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "stabilize_total",
+	Help:      "Stabilize rounds, by result (ok, error, successor_changed).",
+}, []string{"result"})
+
+var FixFingerEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "fix_fingers_total",
+	Help:      "Finger updates, by result (ok, error).",
+}, []string{"result"})
+
+var PredecessorChanges = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "predecessor_changes_total",
+	Help:      "Times this node's predecessor was replaced or cleared.",
+})
+
+// Data
+
+var TransferKeys = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "transfer_keys_total",
+	Help:      "Keys moved between nodes, by direction (in, out).",
+}, []string{"direction"})
+
+var TransferBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "transfer_bytes_total",
+	Help:      "Bytes moved between nodes, by direction (in, out).",
+}, []string{"direction"})
+
+var TransferDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "transfer_duration_seconds",
+	Help:      "Duration of data transfers, by direction (in, out).",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"direction"})
+
+var ReadRepairs = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "read_repairs_total",
+	Help:      "Stale replicas updated after a coordinated read.",
+})
+
+var QuorumFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "quorum_failures_total",
+	Help:      "Coordinated requests that did not get the replies their consistency level requires.",
+})
+
+var AntiEntropyKeys = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "anti_entropy_keys_total",
+	Help:      "Keys repaired by anti-entropy, by direction (push, pull).",
+}, []string{"direction"})
+
+var Hints = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "hints_total",
+	Help:      "Writes kept for unreachable replicas, by event (stored, replayed, expired, dropped).",
+}, []string{"event"})
+
+var TombstonesPurged = promauto.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "tombstones_purged_total",
+	Help:      "Delete tombstones dropped after their grace period, once every replica held them.",
+})
+
+var FencedWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "fenced_writes_total",
+	Help:      "Direct writes held back by ownership fencing, by outcome (waited for a handoff, redirected to the owner).",
+}, []string{"outcome"})
+
+var RESPCommands = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "resp_commands_total",
+	Help:      "Commands served by the Redis protocol listener, by command and outcome (ok, error, moved).",
+}, []string{"command", "outcome"})
+
+var HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "http_requests_total",
+	Help:      "HTTP requests served, by method and status code.",
+}, []string{"method", "code"})
+
+var HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Latency of HTTP requests served, by method.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method"})
+
+// Register gauges reporting the keys and bytes held by this node, evaluated on every scrape.
+func RegisterStore(keys func() float64, bytes func() float64) {
+	prometheus.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "keys",
+			Help:      "Keys currently held by this node.",
+		}, keys),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "bytes",
+			Help:      "Bytes of values currently held by this node.",
+		}, bytes),
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+func ObserveTransfer(direction string, keys int, bytes int, start time.Time) {
+	TransferKeys.WithLabelValues(direction).Add(float64(keys))
+	TransferBytes.WithLabelValues(direction).Add(float64(bytes))
+	TransferDuration.WithLabelValues(direction).Observe(time.Since(start).Seconds())
+}
+
+// Count failed outgoing calls to the given peer by (short) method name.
+func UnaryClientInterceptor(peer string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			RPCErrors.WithLabelValues(peer, path.Base(method)).Inc()
+		}
+		return err
+	}
+}
+
+// Record request counts by method and status code, and latency by method.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := httpstatus.NewRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		HTTPRequests.WithLabelValues(r.Method, strconv.Itoa(recorder.Status)).Inc()
+		HTTPDuration.WithLabelValues(r.Method).Observe(time.Since(start).Seconds())
+	})
+}
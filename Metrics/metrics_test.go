@@ -0,0 +1,77 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metrics "github.com/girivad/go-chord/Metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+func TestHandlerExposesSeries(t *testing.T) {
+	// Counters are global, so the test checks what it adds to them.
+	keys := testutil.ToFloat64(metrics.TransferKeys.WithLabelValues("out"))
+	bytes := testutil.ToFloat64(metrics.TransferBytes.WithLabelValues("out"))
+	requests := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("PUT", "201"))
+
+	metrics.Lookups.WithLabelValues("ok").Inc()
+	metrics.ObserveTransfer("out", 3, 120, time.Now())
+
+	handler := metrics.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/data/a", nil))
+
+	for _, test := range []struct {
+		name  string
+		delta float64
+		want  float64
+	}{
+		{"transferred keys", testutil.ToFloat64(metrics.TransferKeys.WithLabelValues("out")) - keys, 3},
+		{"transferred bytes", testutil.ToFloat64(metrics.TransferBytes.WithLabelValues("out")) - bytes, 120},
+		{"HTTP requests", testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("PUT", "201")) - requests, 1},
+	} {
+		if test.delta != test.want {
+			t.Errorf("%s increased by %v, want %v", test.name, test.delta, test.want)
+		}
+	}
+
+	body := scrape(t)
+
+	for _, series := range []string{
+		`chord_lookups_total{result="ok"}`,
+		`chord_transfer_keys_total{direction="out"}`,
+		`chord_transfer_bytes_total{direction="out"}`,
+		`chord_transfer_duration_seconds_count{direction="out"}`,
+		`chord_http_requests_total{code="201",method="PUT"}`,
+		`chord_http_request_duration_seconds_count{method="PUT"}`,
+	} {
+		if !strings.Contains(body, series) {
+			t.Errorf("scrape is missing %s", series)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package overlay
+
+import (
+	"context"
+	"log/slog"
+
+	logging "github.com/girivad/go-chord/Logging"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Admin Services
+
+func (chordServer *ChordServer) GetState(ctx context.Context, empty *emptypb.Empty) (*pb.NodeState, error) {
+	info, err := chordServer.NodeInfo(ctx, empty)
+	if err != nil {
+		return nil, err
+	}
+
+	chordServer.maintenanceMux.Lock()
+	paused := chordServer.maintenancePaused
+	chordServer.maintenanceMux.Unlock()
+
+	stats := chordServer.KVStore.Store.Stats()
+
+	state := &pb.NodeState{
+		Info: info,
+		KeyIndex: &pb.KeyIndexStats{
+			KeyCount: stats.Keys,
+			Depth:    stats.IndexDepth,
+		},
+		MaintenancePaused: paused,
+		GossipEnabled:     chordServer.Membership != nil,
+	}
+
+	if chordServer.Membership != nil {
+		state.Members = chordServer.Membership.snapshot()
+	}
+
+	return state, nil
+}
+
+func (chordServer *ChordServer) TriggerStabilize(ctx context.Context, empty *emptypb.Empty) (*emptypb.Empty, error) {
+	logger.Info("Admin: stabilize triggered")
+	return &emptypb.Empty{}, chordServer.stabilize()
+}
+
+func (chordServer *ChordServer) TriggerFixFingers(ctx context.Context, empty *emptypb.Empty) (*emptypb.Empty, error) {
+	logger.Info("Admin: fix fingers triggered")
+	return &emptypb.Empty{}, chordServer.fixAllFingers()
+}
+
+func (chordServer *ChordServer) PauseMaintenance(ctx context.Context, empty *emptypb.Empty) (*emptypb.Empty, error) {
+	logger.Info("Admin: maintenance paused")
+	chordServer.setMaintenancePaused(true)
+	return &emptypb.Empty{}, nil
+}
+
+func (chordServer *ChordServer) ResumeMaintenance(ctx context.Context, empty *emptypb.Empty) (*emptypb.Empty, error) {
+	logger.Info("Admin: maintenance resumed")
+	chordServer.setMaintenancePaused(false)
+	return &emptypb.Empty{}, nil
+}
+
+func (chordServer *ChordServer) ForceLeave(ctx context.Context, empty *emptypb.Empty) (*emptypb.Empty, error) {
+	logger.Info("Admin: forced leave")
+	return &emptypb.Empty{}, chordServer.Leave()
+}
+
+func (chordServer *ChordServer) Evict(ctx context.Context, ip *pb.IP) (*emptypb.Empty, error) {
+	if ip.GetIp().GetValue() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no peer provided")
+	}
+
+	logger.Info("Admin: evicting peer from routing state", "peer", ip.Ip.Value)
+
+	if chordServer.Membership != nil {
+		chordServer.Membership.Apply([]*pb.Member{{Ip: ip.Ip.Value, State: pb.MemberState_DEAD, Incarnation: chordServer.Membership.incarnationOf(ip.Ip.Value)}})
+	}
+
+	chordServer.EvictPeer(ip.Ip.Value)
+
+	return &emptypb.Empty{}, nil
+}
+
+func (chordServer *ChordServer) GetLogLevels(ctx context.Context, empty *emptypb.Empty) (*pb.LogLevels, error) {
+	levels := logging.Levels()
+	logLevels := &pb.LogLevels{}
+
+	for _, subsystem := range logging.Subsystems() {
+		logLevels.Levels = append(logLevels.Levels, &pb.LogLevel{Subsystem: subsystem, Level: levels[subsystem].String()})
+	}
+
+	return logLevels, nil
+}
+
+func (chordServer *ChordServer) SetLogLevel(ctx context.Context, logLevel *pb.LogLevel) (*emptypb.Empty, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(logLevel.Level)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := logging.SetLevel(logLevel.Subsystem, level); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	logger.Info("Admin: log level changed", "target_subsystem", logLevel.Subsystem, "level", level)
+
+	return &emptypb.Empty{}, nil
+}
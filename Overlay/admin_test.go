@@ -0,0 +1,21 @@
+package overlay
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEvictWithoutPeer(t *testing.T) {
+	chordServer := newTestServer(t)
+
+	for _, ip := range []*pb.IP{nil, {}, {Ip: &wrapperspb.StringValue{}}} {
+		if _, err := chordServer.Evict(context.Background(), ip); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Evict(%v) returned %v, want InvalidArgument", ip, err)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package overlay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"slices"
+	"strings"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Anti-entropy: every node periodically compares the keys of its arc with their replicas on its next
+// N-1 successors. Both sides build a Merkle tree over the arc, whose leaves are equal slices of it filled
+// in KeyIndex (hash) order with each key and its version (tombstones included), and the node walks down from the root asking
+// only for the subtrees whose hashes differ. The keys of differing leaves are then compared by version,
+// and each side is sent the values it lacks or holds an older version of.
+
+const DefaultAntiEntropyInterval time.Duration = 1 * time.Minute
+const maxMerkleDepth uint32 = 10
+
+// Trees are reused for the requests of one sync round rather than rebuilt for each level.
+const merkleCacheTTL time.Duration = 5 * time.Second
+const antiEntropyBatch int = 256
+
+type AntiEntropyOptions struct {
+	// Time between sync rounds; 0 disables anti-entropy.
+	Interval time.Duration
+	// Bytes of values sent or fetched per second; 0 for no limit.
+	Bandwidth uint64
+}
+
+func (chordServer *ChordServer) SetAntiEntropy(options AntiEntropyOptions) {
+	chordServer.antiEntropy = options
+}
+
+type merkleTree struct {
+	startHash uint64
+	endHash   uint64
+	depth     uint32
+	// Node hashes by heap index; nil for subtrees without keys.
+	nodes [][]byte
+	// Keys and versions in each leaf, ordered by key.
+	leaves [][]*pb.KeyVersion
+	built  time.Time
+}
+
+// Deepest tree whose leaves each cover at least one hash of an arc.
+func merkleDepth(arcSize uint64) uint32 {
+	return min(maxMerkleDepth, uint32(bits.Len64(arcSize)-1))
+}
+
+func (chordServer *ChordServer) arcSize(startHash uint64, endHash uint64) uint64 {
+	ringSize := uint64(1) << chordServer.Capacity
+
+	arcSize := (endHash - startHash + ringSize) % ringSize
+	if arcSize == 0 {
+		arcSize = ringSize
+	}
+	return arcSize
+}
+
+// The Merkle tree over (startHash, endHash], reusing a recently built one for the same arc.
+func (chordServer *ChordServer) merkleTree(startHash uint64, endHash uint64, depth uint32) *merkleTree {
+	chordServer.merkleMux.Lock()
+	defer chordServer.merkleMux.Unlock()
+
+	cached := chordServer.merkleCache
+	if cached != nil && cached.startHash == startHash && cached.endHash == endHash && cached.depth == depth && time.Since(cached.built) < merkleCacheTTL {
+		return cached
+	}
+
+	ringSize := uint64(1) << chordServer.Capacity
+	arcSize := chordServer.arcSize(startHash, endHash)
+	leafCount := uint64(1) << depth
+
+	tree := &merkleTree{
+		startHash: startHash,
+		endHash:   endHash,
+		depth:     depth,
+		nodes:     make([][]byte, 2*leafCount),
+		leaves:    make([][]*pb.KeyVersion, leafCount),
+		built:     time.Now(),
+	}
+
+	chordServer.KVStore.Store.Range(startHash, endHash, func(key string, value data.Value) bool {
+		offset := (hash(key, chordServer.Capacity) - startHash - 1 + ringSize) % ringSize
+		high, low := bits.Mul64(offset, leafCount)
+		leaf, _ := bits.Div64(high, low, arcSize)
+
+		tree.leaves[leaf] = append(tree.leaves[leaf], &pb.KeyVersion{Key: key, Version: value.Version})
+		return true
+	})
+
+	for leaf, entries := range tree.leaves {
+		if len(entries) == 0 {
+			continue
+		}
+
+		slices.SortFunc(entries, func(entry1, entry2 *pb.KeyVersion) int {
+			return strings.Compare(entry1.Key, entry2.Key)
+		})
+
+		digest := sha256.New()
+		for _, entry := range entries {
+			digest.Write([]byte(entry.Key))
+			digest.Write([]byte{0})
+			digest.Write(binary.BigEndian.AppendUint64(nil, entry.Version))
+		}
+		tree.nodes[leafCount+uint64(leaf)] = digest.Sum(nil)
+	}
+
+	emptyHash := make([]byte, sha256.Size)
+	for node := leafCount - 1; node >= 1; node-- {
+		left, right := tree.nodes[2*node], tree.nodes[2*node+1]
+		if left == nil && right == nil {
+			continue
+		}
+
+		digest := sha256.New()
+		for _, child := range [][]byte{left, right} {
+			if child == nil {
+				child = emptyHash
+			}
+			digest.Write(child)
+		}
+		tree.nodes[node] = digest.Sum(nil)
+	}
+
+	chordServer.merkleCache = tree
+	return tree
+}
+
+func (chordServer *ChordServer) requestedTree(request *pb.MerkleRequest) (*merkleTree, error) {
+	if request.Depth > maxMerkleDepth || request.Depth > merkleDepth(chordServer.arcSize(request.StartHash, request.EndHash)) {
+		return nil, status.Errorf(codes.InvalidArgument, "depth %d is too deep for the arc", request.Depth)
+	}
+
+	tree := chordServer.merkleTree(request.StartHash, request.EndHash, request.Depth)
+
+	for _, node := range request.Nodes {
+		if node == 0 || int(node) >= len(tree.nodes) {
+			return nil, status.Errorf(codes.InvalidArgument, "no node %d in a tree of depth %d", node, request.Depth)
+		}
+	}
+
+	return tree, nil
+}
+
+// Anti-Entropy Service
+
+func (chordServer *ChordServer) MerkleNodes(ctx context.Context, request *pb.MerkleRequest) (*pb.MerkleHashes, error) {
+	tree, err := chordServer.requestedTree(request)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := &pb.MerkleHashes{Hashes: make([][]byte, len(request.Nodes))}
+	for i, node := range request.Nodes {
+		hashes.Hashes[i] = tree.nodes[node]
+	}
+
+	return hashes, nil
+}
+
+func (chordServer *ChordServer) LeafVersions(request *pb.MerkleRequest, stream pb.AntiEntropy_LeafVersionsServer) error {
+	tree, err := chordServer.requestedTree(request)
+	if err != nil {
+		return err
+	}
+
+	leafCount := uint32(1) << request.Depth
+
+	for _, node := range request.Nodes {
+		if node < leafCount {
+			return status.Errorf(codes.InvalidArgument, "node %d is not a leaf", node)
+		}
+
+		for _, entry := range tree.leaves[node-leafCount] {
+			if err := stream.Send(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Anti-entropy rounds
+
+func (chordServer *ChordServer) SyncReplicas() {
+	for {
+		time.Sleep(chordServer.antiEntropy.Interval)
+		chordServer.waitWhilePaused()
+
+		chordServer.syncReplicas()
+	}
+}
+
+func (chordServer *ChordServer) syncReplicas() {
+	startHash := chordServer.Hash
+	chordServer.PredecessorMux.RLock()
+	if chordServer.Predecessor != nil {
+		startHash = hash(chordServer.Predecessor.Ip, chordServer.Capacity)
+	}
+	chordServer.PredecessorMux.RUnlock()
+
+	chain := chordServer.chain()
+	if len(chain) == 1 {
+		return
+	}
+
+	depth := merkleDepth(chordServer.arcSize(startHash, chordServer.Hash))
+
+	for _, ip := range chain[1:] {
+		tree := chordServer.merkleTree(startHash, chordServer.Hash, depth)
+
+		if err := chordServer.syncReplica(ip, tree); err != nil {
+			maintenanceLogger.Warn("Anti-entropy with replica failed", "peer", ip, "err", err)
+		}
+	}
+}
+
+func (chordServer *ChordServer) syncReplica(ip string, tree *merkleTree) error {
+	replica, err := Connect(ip)
+	if err != nil {
+		return err
+	}
+	defer replica.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), chordServer.antiEntropy.Interval)
+	defer cancel()
+
+	leafCount := uint32(1) << tree.depth
+	request := &pb.MerkleRequest{StartHash: tree.startHash, EndHash: tree.endHash, Depth: tree.depth, Nodes: []uint32{1}}
+
+	// Walk down the levels of the tree, keeping only the nodes whose hashes differ.
+	var differing []uint32
+	for len(request.Nodes) > 0 {
+		remote, err := replica.AntiEntropyClient.MerkleNodes(ctx, request)
+		if err != nil {
+			return err
+		}
+		if len(remote.Hashes) != len(request.Nodes) {
+			return errors.New("mismatched Merkle reply")
+		}
+
+		var next []uint32
+		for i, node := range request.Nodes {
+			if bytes.Equal(tree.nodes[node], remote.Hashes[i]) {
+				continue
+			}
+
+			if node >= leafCount {
+				differing = append(differing, node)
+			} else {
+				next = append(next, 2*node, 2*node+1)
+			}
+		}
+		request.Nodes = next
+	}
+
+	if len(differing) == 0 {
+		maintenanceLogger.Debug("Replica is in sync", "peer", ip)
+		return nil
+	}
+
+	request.Nodes = differing
+	stream, err := replica.AntiEntropyClient.LeafVersions(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	remoteVersions := make(map[string]uint64)
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		remoteVersions[entry.Key] = entry.Version
+	}
+
+	var push, pull []string
+	for _, node := range differing {
+		for _, entry := range tree.leaves[node-leafCount] {
+			remoteVersion, found := remoteVersions[entry.Key]
+			delete(remoteVersions, entry.Key)
+
+			if !found || remoteVersion < entry.Version {
+				push = append(push, entry.Key)
+			} else if remoteVersion > entry.Version {
+				pull = append(pull, entry.Key)
+			}
+		}
+	}
+	// Keys only the replica holds are writes (or deletes) this node missed.
+	for key := range remoteVersions {
+		pull = append(pull, key)
+	}
+
+	if err := chordServer.pushKeys(ctx, replica, push); err != nil {
+		return err
+	}
+	if err := chordServer.pullKeys(ctx, replica, pull); err != nil {
+		return err
+	}
+
+	maintenanceLogger.Info("Anti-entropy repaired replica", "peer", ip, "leaves", len(differing), "pushed", len(push), "pulled", len(pull))
+	return nil
+}
+
+func (chordServer *ChordServer) pushKeys(ctx context.Context, replica *ChordNode, keys []string) error {
+	for start := 0; start < len(keys); start += antiEntropyBatch {
+		batch := keys[start:min(start+antiEntropyBatch, len(keys))]
+
+		mutations := &pb.Mutations{}
+		for _, key := range batch {
+			if value, found := chordServer.KVStore.Store.Entry(key); found {
+				mutations.Mutations = append(mutations.Mutations, &pb.Mutation{Key: key, Value: value.ToProto()})
+			}
+		}
+
+		if _, err := replica.DataClient.Replicate(ctx, mutations); err != nil {
+			return err
+		}
+
+		metrics.AntiEntropyKeys.WithLabelValues("push").Add(float64(len(mutations.Mutations)))
+		chordServer.throttle(proto.Size(mutations))
+	}
+
+	return nil
+}
+
+func (chordServer *ChordServer) pullKeys(ctx context.Context, replica *ChordNode, keys []string) error {
+	for start := 0; start < len(keys); start += antiEntropyBatch {
+		batch := keys[start:min(start+antiEntropyBatch, len(keys))]
+
+		kvMap, err := replica.DataClient.GetValues(ctx, &pb.Keys{Keys: batch, Tombstones: true})
+		if err != nil {
+			return err
+		}
+
+		mutations := &pb.Mutations{}
+		for key, value := range kvMap.Kvmap {
+			mutations.Mutations = append(mutations.Mutations, &pb.Mutation{Key: key, Value: value})
+		}
+		chordServer.KVStore.Replicate(mutations)
+
+		metrics.AntiEntropyKeys.WithLabelValues("pull").Add(float64(len(mutations.Mutations)))
+		chordServer.throttle(proto.Size(kvMap))
+	}
+
+	return nil
+}
+
+// Pace anti-entropy transfers to the configured bandwidth.
+func (chordServer *ChordServer) throttle(size int) {
+	if chordServer.antiEntropy.Bandwidth == 0 {
+		return
+	}
+
+	time.Sleep(time.Duration(uint64(size) * uint64(time.Second) / chordServer.antiEntropy.Bandwidth))
+}
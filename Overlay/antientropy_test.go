@@ -0,0 +1,83 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// A key of each hash in the ring, found by trying candidates.
+func keysByHash(capacity uint64) map[uint64]string {
+	keys := make(map[uint64]string)
+	for i := 0; len(keys) < 1<<capacity; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if _, found := keys[hash(key, capacity)]; !found {
+			keys[hash(key, capacity)] = key
+		}
+	}
+	return keys
+}
+
+func TestMerkleLeafBucketing(t *testing.T) {
+	chordServer := newTestServer(t)
+	keys := keysByHash(chordServer.Capacity)
+
+	// (200, 40] wraps past the top of the ring: 96 hashes, 24 per leaf at depth 2.
+	const startHash, endHash, depth = 200, 40, 2
+	leafRanges := [][2]uint64{{201, 224}, {225, 248}, {249, 16}, {17, 40}}
+	leafKeys := []int{2, 2, 4, 2}
+
+	for _, keyHash := range []uint64{200, 201, 224, 225, 248, 249, 255, 0, 16, 17, 40, 41} {
+		putKeys(t, chordServer, keys[keyHash])
+	}
+
+	tree := chordServer.merkleTree(startHash, endHash, depth)
+
+	if len(tree.leaves) != len(leafRanges) {
+		t.Fatalf("%d leaves, want %d", len(tree.leaves), len(leafRanges))
+	}
+
+	total := 0
+	for leaf, entries := range tree.leaves {
+		first, last := leafRanges[leaf][0], leafRanges[leaf][1]
+		for _, entry := range entries {
+			keyHash := hash(entry.Key, chordServer.Capacity)
+			if !isBetween(keyHash, first-1, last) {
+				t.Errorf("leaf %d holds hash %d, want hashes %d to %d", leaf, keyHash, first, last)
+			}
+		}
+		if len(entries) != leafKeys[leaf] {
+			t.Errorf("leaf %d holds %d keys, want %d", leaf, len(entries), leafKeys[leaf])
+		}
+		total += len(entries)
+	}
+
+	// The keys at 200 and 41 are outside the arc.
+	if total != 10 {
+		t.Errorf("tree holds %d keys, want 10", total)
+	}
+}
+
+func TestMerkleRootTracksVersions(t *testing.T) {
+	chordServer := newTestServer(t)
+	keys := keysByHash(chordServer.Capacity)
+
+	putKeys(t, chordServer, keys[10], keys[100])
+	before := chordServer.merkleTree(0, 128, 3).nodes[1]
+
+	// Rewriting a key bumps its version, which must change the root once the cached tree expires.
+	putKeys(t, chordServer, keys[100])
+	chordServer.merkleCache = nil
+	after := chordServer.merkleTree(0, 128, 3).nodes[1]
+
+	if before == nil || after == nil || bytes.Equal(before, after) {
+		t.Fatalf("root %x did not change to reflect a new version (now %x)", before, after)
+	}
+
+	// Keys outside the arc do not affect it.
+	putKeys(t, chordServer, keys[200])
+	chordServer.merkleCache = nil
+	if outside := chordServer.merkleTree(0, 128, 3).nodes[1]; !bytes.Equal(after, outside) {
+		t.Fatalf("root changed from %x to %x for a key outside the arc", after, outside)
+	}
+}
@@ -0,0 +1,396 @@
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/status"
+)
+
+// Batch HTTP endpoints: keys are grouped by owner with one batched lookup, and each owner is
+// sent a single request, in parallel, and sent again if ownership moved in between. Keys in chain mode are
+// read from and written through their chains instead, one key at a time (up to maxChainFanOut in parallel).
+// Results (or errors) are reported per key.
+
+const maxBatchKeys int = 10000
+
+// Chain-mode keys of a batch read or written at once, each through its own chain.
+const maxChainFanOut int = 64
+
+type batchGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type batchPutEntry struct {
+	Key string `json:"key"`
+	// Either Value (base64 in JSON) or JSON, a JSON document stored as-is with content type application/json.
+	Value       []byte          `json:"value,omitempty"`
+	JSON        json.RawMessage `json:"json,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	TTL         string          `json:"ttl,omitempty"`
+}
+
+type batchPutRequest struct {
+	Entries []batchPutEntry `json:"entries"`
+}
+
+type batchResult struct {
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Created     bool   `json:"created,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results map[string]*batchResult `json:"results"`
+}
+
+func (chordServer *ChordServer) ServeBatchGet(w http.ResponseWriter, r *http.Request) {
+	request := &batchGetRequest{}
+	if !readBatch(w, r, request) {
+		return
+	}
+
+	if len(request.Keys) > maxBatchKeys {
+		http.Error(w, fmt.Sprintf("%s: at most %d keys per batch.", http.StatusText(http.StatusBadRequest), maxBatchKeys), http.StatusBadRequest)
+		return
+	}
+
+	response := &batchResponse{Results: make(map[string]*batchResult)}
+	values, failures := chordServer.batchGet(r.Context(), request.Keys)
+
+	for _, key := range request.Keys {
+		if failure, failed := failures[key]; failed {
+			response.Results[key] = &batchResult{Error: failure}
+		} else if value, found := values[key]; found {
+			response.Results[key] = &batchResult{Value: value.Data, ContentType: value.ContentType, ETag: data.FormatETag(value.Version)}
+		} else {
+			response.Results[key] = &batchResult{Error: http.StatusText(http.StatusNotFound)}
+		}
+	}
+
+	writeJSON(w, response)
+}
+
+// Read keys from their owners, or chain-mode keys from their chains' tails, returning the values found and
+// the error of each key that could not be read.
+func (chordServer *ChordServer) batchGet(ctx context.Context, keys []string) (map[string]*pb.Value, map[string]string) {
+	values := make(map[string]*pb.Value)
+	failures := make(map[string]string)
+	var resultsMux sync.Mutex
+
+	fail := func(keys []string, err error) {
+		resultsMux.Lock()
+		defer resultsMux.Unlock()
+		for _, key := range keys {
+			failures[key] = err.Error()
+		}
+	}
+
+	chainKeys, keys := chordServer.splitChainKeys(keys)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		forEachChainKey(chainKeys, func(key string) {
+			value, err := chordServer.chainGet(ctx, key)
+			if err != nil {
+				fail([]string{key}, err)
+				return
+			}
+
+			if value != nil && !value.Deleted {
+				resultsMux.Lock()
+				values[key] = value
+				resultsMux.Unlock()
+			}
+		})
+	}()
+
+	chordServer.fanOut(ctx, keys, fail, func(ctx context.Context, owner *ChordNode, keys []string) error {
+		var kvMap *pb.KVMap
+		if owner == nil {
+			kvMap = chordServer.KVStore.GetValues(keys, false)
+		} else {
+			var err error
+			kvMap, err = owner.DataClient.GetValues(ctx, &pb.Keys{Keys: keys})
+			if err != nil {
+				return err
+			}
+		}
+
+		resultsMux.Lock()
+		defer resultsMux.Unlock()
+		for key, value := range kvMap.Kvmap {
+			values[key] = value
+		}
+
+		return nil
+	})
+
+	wg.Wait()
+	return values, failures
+}
+
+func (chordServer *ChordServer) ServeBatchPut(w http.ResponseWriter, r *http.Request) {
+	request := &batchPutRequest{}
+	if !readBatch(w, r, request) {
+		return
+	}
+
+	if len(request.Entries) > maxBatchKeys {
+		http.Error(w, fmt.Sprintf("%s: at most %d keys per batch.", http.StatusText(http.StatusBadRequest), maxBatchKeys), http.StatusBadRequest)
+		return
+	}
+
+	response := &batchResponse{Results: make(map[string]*batchResult)}
+	values := make(map[string]*pb.Value)
+
+	for _, entry := range request.Entries {
+		value, err := entry.value()
+		if err != nil {
+			response.Results[entry.Key] = &batchResult{Error: err.Error()}
+			continue
+		}
+
+		values[entry.Key] = value
+	}
+
+	for key, writeResult := range chordServer.batchPut(r.Context(), values) {
+		if writeResult.Error != "" {
+			response.Results[key] = &batchResult{Error: writeResult.Error}
+			continue
+		}
+
+		response.Results[key] = &batchResult{ETag: data.FormatETag(writeResult.Version), Created: writeResult.Created}
+	}
+
+	writeJSON(w, response)
+}
+
+// Write values with their owners, or chain-mode keys through their chains, returning each key's result.
+func (chordServer *ChordServer) batchPut(ctx context.Context, values map[string]*pb.Value) map[string]*pb.WriteResult {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	results := make(map[string]*pb.WriteResult)
+	var resultsMux sync.Mutex
+
+	fail := func(keys []string, err error) {
+		resultsMux.Lock()
+		defer resultsMux.Unlock()
+		for _, key := range keys {
+			results[key] = &pb.WriteResult{Error: err.Error()}
+		}
+	}
+
+	chainKeys, keys := chordServer.splitChainKeys(keys)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		forEachChainKey(chainKeys, func(key string) {
+			result, err := chordServer.chainWrite(ctx, &pb.ChainWriteRequest{Mutation: &pb.Mutation{Key: key, Value: values[key]}})
+			if err != nil {
+				fail([]string{key}, errors.New(status.Convert(err).Message()))
+				return
+			}
+
+			resultsMux.Lock()
+			results[key] = result
+			resultsMux.Unlock()
+		})
+	}()
+
+	// An owner fences its whole group, so if ownership of any key moved since the lookup the group is
+	// resolved and sent again.
+	var moved []string
+	attempt := 1
+
+	put := func(ctx context.Context, owner *ChordNode, keys []string) error {
+		batch := &pb.KVMap{Kvmap: make(map[string]*pb.Value)}
+		for _, key := range keys {
+			batch.Kvmap[key] = values[key]
+		}
+
+		var writeResults *pb.WriteResults
+		var err error
+		if owner == nil {
+			writeResults, err = chordServer.PutValues(ctx, batch)
+		} else {
+			writeResults, err = owner.DataClient.PutValues(ctx, batch)
+		}
+		if _, redirected := OwnerFromError(err); redirected && attempt < MaxRetries {
+			logger.Debug("Batch owner no longer owns its keys, retrying", "keys", len(keys), "err", err)
+
+			resultsMux.Lock()
+			moved = append(moved, keys...)
+			resultsMux.Unlock()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resultsMux.Lock()
+		defer resultsMux.Unlock()
+
+		for _, key := range keys {
+			writeResult, found := writeResults.Results[key]
+			if !found {
+				writeResult = &pb.WriteResult{Error: "no result from owner"}
+			}
+			results[key] = writeResult
+		}
+
+		return nil
+	}
+
+	for ; len(keys) > 0; attempt++ {
+		chordServer.fanOut(ctx, keys, fail, put)
+		keys, moved = moved, nil
+	}
+
+	wg.Wait()
+	return results
+}
+
+func (entry *batchPutEntry) value() (*pb.Value, error) {
+	if entry.Key == "" {
+		return nil, fmt.Errorf("no key provided")
+	}
+
+	value := &pb.Value{Data: entry.Value, ContentType: entry.ContentType}
+
+	if entry.JSON != nil {
+		value.Data = entry.JSON
+		if value.ContentType == "" {
+			value.ContentType = "application/json"
+		}
+	}
+
+	if value.ContentType == "" {
+		value.ContentType = "application/octet-stream"
+	}
+
+	if entry.TTL != "" {
+		ttl, err := data.ParseTTL(entry.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TTL: %w", err)
+		}
+		value.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	return value, nil
+}
+
+// Call visit for each chain-mode key of a batch, at most maxChainFanOut at a time, and return once all are done.
+func forEachChainKey(keys []string, visit func(key string)) {
+	slots := make(chan struct{}, maxChainFanOut)
+	var wg sync.WaitGroup
+
+	for _, key := range keys {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			visit(key)
+		}(key)
+	}
+	wg.Wait()
+}
+
+// Split keys into those in chain mode, which batches read and write through their chains one key at a
+// time, and the rest.
+func (chordServer *ChordServer) splitChainKeys(keys []string) ([]string, []string) {
+	var chainKeys, otherKeys []string
+	for _, key := range keys {
+		if chordServer.replication.Mode(key) == ChainReplication {
+			chainKeys = append(chainKeys, key)
+		} else {
+			otherKeys = append(otherKeys, key)
+		}
+	}
+	return chainKeys, otherKeys
+}
+
+// Resolve the owners of keys with one batched lookup and call visit once per owner, in parallel.
+// visit receives a nil owner for keys this node owns. Keys whose lookup or visit fails are passed to fail,
+// which may be called concurrently.
+func (chordServer *ChordServer) fanOut(ctx context.Context, keys []string, fail func(keys []string, err error), visit func(ctx context.Context, owner *ChordNode, keys []string) error) {
+	hashes := &pb.Hashes{}
+	for _, key := range keys {
+		hashes.Hashes = append(hashes.Hashes, hash(key, chordServer.Capacity))
+	}
+
+	owners, err := chordServer.FindSuccessors(ctx, hashes)
+	if err != nil {
+		fail(keys, err)
+		return
+	}
+
+	keysByOwner := make(map[string][]string)
+	for i, key := range keys {
+		if owners.Ips[i] == "" {
+			fail([]string{key}, errors.New(owners.Errors[i]))
+			continue
+		}
+		keysByOwner[owners.Ips[i]] = append(keysByOwner[owners.Ips[i]], key)
+	}
+
+	var wg sync.WaitGroup
+	for ownerIP, ownerKeys := range keysByOwner {
+		wg.Add(1)
+		go func(ownerIP string, ownerKeys []string) {
+			defer wg.Done()
+
+			var owner *ChordNode
+			var err error
+
+			if ownerIP != chordServer.IP {
+				owner, err = Connect(ownerIP)
+				if err == nil {
+					defer owner.Close()
+				}
+			}
+
+			if err == nil {
+				err = visit(ctx, owner, ownerKeys)
+			}
+
+			if err != nil {
+				logger.Warn("Batch request to owner failed", "peer", ownerIP, "keys", len(ownerKeys), "err", err)
+				fail(ownerKeys, err)
+			}
+		}(ownerIP, ownerKeys)
+	}
+	wg.Wait()
+}
+
+func readBatch(w http.ResponseWriter, r *http.Request, request any) bool {
+	defer r.Body.Close()
+
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": invalid batch: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,67 @@
+package overlay
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestForEachChainKeyCapsFanOut(t *testing.T) {
+	keys := make([]string, 5*maxChainFanOut)
+	for i := range keys {
+		keys[i] = string(rune('a' + i%26))
+	}
+
+	var running, peak, visited atomic.Int64
+	forEachChainKey(keys, func(key string) {
+		now := running.Add(1)
+		for {
+			highest := peak.Load()
+			if now <= highest || peak.CompareAndSwap(highest, now) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		visited.Add(1)
+	})
+
+	if visited.Load() != int64(len(keys)) {
+		t.Fatalf("visited %d keys, want %d", visited.Load(), len(keys))
+	}
+	if peak.Load() > int64(maxChainFanOut) {
+		t.Fatalf("%d keys ran at once, want at most %d", peak.Load(), maxChainFanOut)
+	}
+}
+
+func TestBatchPutRetriesMovedOwner(t *testing.T) {
+	chordServer := newTestServer(t)
+
+	// The whole ring was handed off, but lookups still lead here: every attempt is redirected.
+	handoff := chordServer.beginHandoff(chordServer.Hash, chordServer.Hash, "10.0.0.9")
+	chordServer.endHandoff(handoff, true, true)
+
+	redirected := metrics.FencedWrites.WithLabelValues("redirected")
+	before := testutil.ToFloat64(redirected)
+
+	results := chordServer.batchPut(context.Background(), map[string]*pb.Value{
+		"a": {Data: []byte("1")},
+		"b": {Data: []byte("2")},
+	})
+
+	for _, key := range []string{"a", "b"} {
+		if result := results[key]; result == nil || !strings.Contains(result.Error, "10.0.0.9") {
+			t.Errorf("result for %q is %v, want the owner's redirect", key, result)
+		}
+	}
+	if attempts := testutil.ToFloat64(redirected) - before; attempts != float64(MaxRetries) {
+		t.Errorf("group sent %v times, want %d", attempts, MaxRetries)
+	}
+}
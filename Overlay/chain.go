@@ -0,0 +1,425 @@
+package overlay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Chain replication: for keys in chain mode, writes enter at the key's owner (the head), are applied
+// by each of the next N-1 successors in turn and are acknowledged once the last of them (the tail)
+// has applied them; reads are served by the tail alone, so they only ever see acknowledged writes. The
+// head derives the chain from its successor list on every write, and re-sends the keys it heads to the
+// chain whenever Stabilize or CheckPredecessor observe a membership change.
+//
+// A write the head applied but the chain did not acknowledge is not rolled back: the client is told it
+// failed, as its outcome is unknown, and the head re-sends it from Stabilize until the chain holds it.
+// Until then it is visible at the head and the replicas that applied it, but not to tail reads.
+
+const (
+	// Replicated only for requests that ask for it, through consistency headers.
+	QuorumReplication string = "quorum"
+	ChainReplication  string = "chain"
+)
+
+// Replication mode of each key: a default, and modes for key namespaces (prefixes).
+type ReplicationPolicy struct {
+	Default    string
+	Namespaces map[string]string
+}
+
+// Parse a mode for every key ("chain"), optionally followed by prefix=mode pairs, e.g. quorum,orders/=chain.
+func ParseReplicationPolicy(spec string) (*ReplicationPolicy, error) {
+	policy := &ReplicationPolicy{Default: QuorumReplication, Namespaces: make(map[string]string)}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		prefix, mode, scoped := strings.Cut(part, "=")
+		if !scoped {
+			mode = prefix
+		}
+
+		if mode != QuorumReplication && mode != ChainReplication {
+			return nil, fmt.Errorf("unknown replication mode %q", mode)
+		}
+
+		if scoped {
+			policy.Namespaces[prefix] = mode
+		} else {
+			policy.Default = mode
+		}
+	}
+
+	return policy, nil
+}
+
+// The mode of the longest namespace the key falls in, or the default.
+func (policy *ReplicationPolicy) Mode(key string) string {
+	mode := policy.Default
+	longest := -1
+
+	for prefix, namespaceMode := range policy.Namespaces {
+		if strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			mode = namespaceMode
+			longest = len(prefix)
+		}
+	}
+
+	return mode
+}
+
+func (policy *ReplicationPolicy) usesChain() bool {
+	if policy.Default == ChainReplication {
+		return true
+	}
+
+	for _, mode := range policy.Namespaces {
+		if mode == ChainReplication {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (chordServer *ChordServer) SetReplicationPolicy(policy *ReplicationPolicy) {
+	chordServer.replication = policy
+}
+
+// This node followed by the successors that replicate the keys it owns.
+func (chordServer *ChordServer) chain() []string {
+	return replicaSet(chordServer.IP, chordServer.Successors(), chordServer.replicas)
+}
+
+// Chain Service
+
+func (chordServer *ChordServer) ChainWrite(ctx context.Context, request *pb.ChainWriteRequest) (*pb.WriteResult, error) {
+	mutation := request.Mutation
+	if mutation == nil {
+		return nil, status.Error(codes.InvalidArgument, "no mutation")
+	}
+
+	var result *pb.WriteResult
+
+	if request.Position == 0 {
+		release, hint, err := chordServer.fence(ctx, []string{mutation.Key})
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		if hint != nil {
+			return nil, ownerError(hint)
+		}
+
+		result, mutation, err = chordServer.headWrite(mutation, data.HeaderPrecondition(request.IfMatch, request.IfNoneMatch))
+		release()
+		if err != nil || mutation == nil {
+			return result, err
+		}
+
+		request = &pb.ChainWriteRequest{Mutation: mutation, Chain: chordServer.chain(), Position: 0}
+	} else {
+		result = chordServer.KVStore.Replicate(&pb.Mutations{Mutations: []*pb.Mutation{mutation}}).Results[mutation.Key]
+		if result.Error != "" {
+			return nil, status.Error(codes.Internal, result.Error)
+		}
+	}
+
+	next := int(request.Position) + 1
+	if next >= len(request.Chain) {
+		return result, nil
+	}
+
+	successor, err := Connect(request.Chain[next])
+	if err != nil {
+		if request.Position == 0 {
+			chordServer.markChainPending(mutation)
+		}
+		return nil, status.Errorf(codes.Unavailable, "chain replica %s: %v", request.Chain[next], err)
+	}
+	defer successor.Close()
+
+	_, err = successor.ChainClient.ChainWrite(ctx, &pb.ChainWriteRequest{Mutation: mutation, Chain: request.Chain, Position: uint32(next)})
+	if err != nil {
+		logger.Warn("Chain replica did not apply write", "key", mutation.Key, "peer", request.Chain[next], "err", err)
+		if request.Position == 0 {
+			chordServer.markChainPending(mutation)
+		}
+		return nil, status.Errorf(codes.Unavailable, "chain replica %s: %v", request.Chain[next], err)
+	}
+
+	return result, nil
+}
+
+// Apply a write at the head: check its precondition and version it. Returns the result and the versioned
+// mutation (a tombstone for a delete) to pass down the chain, or no mutation if a delete found no key.
+func (chordServer *ChordServer) headWrite(mutation *pb.Mutation, precondition data.Precondition) (*pb.WriteResult, *pb.Mutation, error) {
+	store := chordServer.KVStore.Store
+
+	if mutation.Value == nil {
+		tombstone, found, err := store.Delete(mutation.Key, precondition)
+		if err == data.ErrPreconditionFailed {
+			return nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if err != nil {
+			return nil, nil, status.Error(codes.Internal, err.Error())
+		}
+
+		if !found {
+			return &pb.WriteResult{Created: true}, nil, nil
+		}
+		return &pb.WriteResult{Version: tombstone.Version}, &pb.Mutation{Key: mutation.Key, Value: tombstone.ToProto()}, nil
+	}
+
+	value, found, err := store.Put(mutation.Key, *data.ValueFromProto(mutation.Value), precondition)
+	if err == data.ErrPreconditionFailed {
+		return nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.WriteResult{Version: value.Version, Created: !found}, &pb.Mutation{Key: mutation.Key, Value: value.ToProto()}, nil
+}
+
+// Send a write to the head of its key's chain, looking the head up again if ownership moved in between.
+func (chordServer *ChordServer) chainWrite(ctx context.Context, request *pb.ChainWriteRequest) (*pb.WriteResult, error) {
+	var err error
+	for attempt := 0; attempt < MaxRetries; attempt++ {
+		var ipMsg *pb.IP
+		ipMsg, err = chordServer.lookup(ctx, hash(request.Mutation.Key, chordServer.Capacity))
+		if err != nil {
+			continue
+		}
+
+		var result *pb.WriteResult
+		if ipMsg.Ip.Value == chordServer.IP {
+			result, err = chordServer.ChainWrite(ctx, request)
+		} else {
+			var head *ChordNode
+			head, err = Connect(ipMsg.Ip.Value)
+			if err != nil {
+				continue
+			}
+			result, err = head.ChainClient.ChainWrite(ctx, request)
+			head.Close()
+		}
+
+		if status.Code(err) == codes.Aborted {
+			logger.Debug("Chain head moved, retrying", "key", request.Mutation.Key, "peer", ipMsg.Ip.Value)
+			continue
+		}
+
+		return result, err
+	}
+
+	return nil, err
+}
+
+// Read a key from the tail of its chain. The other replicas may hold writes the tail has not acknowledged,
+// so an unreachable tail fails the read rather than falling back to them.
+func (chordServer *ChordServer) chainGet(ctx context.Context, key string) (*pb.Value, error) {
+	chain, err := chordServer.preferenceList(ctx, key, chordServer.replicas)
+	if err != nil {
+		return nil, err
+	}
+
+	tail := chain[len(chain)-1]
+	reply := chordServer.replicaGet(ctx, tail, key)
+	if reply.err != nil {
+		logger.Warn("Chain tail unreachable", "key", key, "peer", tail, "err", reply.err)
+		return nil, fmt.Errorf("chain tail %s: %w", tail, reply.err)
+	}
+
+	return reply.value, nil
+}
+
+// Record a versioned write the head applied but its chain did not acknowledge.
+func (chordServer *ChordServer) markChainPending(mutation *pb.Mutation) {
+	chordServer.chainPendingMux.Lock()
+	defer chordServer.chainPendingMux.Unlock()
+
+	if chordServer.chainPending == nil {
+		chordServer.chainPending = make(map[string]uint64)
+	}
+	chordServer.chainPending[mutation.Key] = max(chordServer.chainPending[mutation.Key], mutation.Value.GetVersion())
+}
+
+// Re-send the current value of every key with an unacknowledged chain write to the chain's replicas.
+// Keys this node no longer heads were handed to their new head with the rest of its arc.
+func (chordServer *ChordServer) resendChainWrites() {
+	chordServer.chainPendingMux.Lock()
+	pending := make(map[string]uint64, len(chordServer.chainPending))
+	for key, version := range chordServer.chainPending {
+		pending[key] = version
+	}
+	chordServer.chainPendingMux.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	chordServer.chainMux.Lock()
+	defer chordServer.chainMux.Unlock()
+
+	mutations := &pb.Mutations{}
+	for key := range pending {
+		if !chordServer.ownsHash(hash(key, chordServer.Capacity)) {
+			continue
+		}
+		if value, found := chordServer.KVStore.Store.Entry(key); found {
+			mutations.Mutations = append(mutations.Mutations, &pb.Mutation{Key: key, Value: value.ToProto()})
+		}
+	}
+
+	if len(mutations.Mutations) > 0 {
+		for _, ip := range chordServer.chain()[1:] {
+			if err := chordServer.replicate(ip, mutations); err != nil {
+				maintenanceLogger.Warn("Re-sending unacknowledged chain writes failed", "peer", ip, "keys", len(mutations.Mutations), "err", err)
+				return
+			}
+		}
+		maintenanceLogger.Info("Re-sent unacknowledged chain writes", "keys", len(mutations.Mutations))
+	}
+
+	chordServer.chainPendingMux.Lock()
+	defer chordServer.chainPendingMux.Unlock()
+
+	for key, version := range pending {
+		// A write that failed again since the snapshot stays pending.
+		if chordServer.chainPending[key] <= version {
+			delete(chordServer.chainPending, key)
+		}
+	}
+}
+
+// Bring the replicas of every key this node heads up to date after a membership change: its arc may have
+// grown (a failed predecessor) and its successors may have changed. Replicas keep the newest version of a
+// key, so re-sending keys they already hold is harmless.
+func (chordServer *ChordServer) reconfigureChains() {
+	if !chordServer.replication.usesChain() {
+		return
+	}
+
+	chordServer.chainMux.Lock()
+	defer chordServer.chainMux.Unlock()
+
+	startHash := chordServer.Hash
+	chordServer.PredecessorMux.RLock()
+	if chordServer.Predecessor != nil {
+		startHash = hash(chordServer.Predecessor.Ip, chordServer.Capacity)
+	}
+	chordServer.PredecessorMux.RUnlock()
+
+	mutations := &pb.Mutations{}
+	chordServer.KVStore.Store.Range(startHash, chordServer.Hash, func(key string, value data.Value) bool {
+		if chordServer.replication.Mode(key) == ChainReplication {
+			mutations.Mutations = append(mutations.Mutations, &pb.Mutation{Key: key, Value: value.ToProto()})
+		}
+		return true
+	})
+
+	chain := chordServer.chain()
+	if len(mutations.Mutations) == 0 || len(chain) == 1 {
+		return
+	}
+
+	for _, ip := range chain[1:] {
+		err := chordServer.replicate(ip, mutations)
+		if err != nil {
+			maintenanceLogger.Warn("Re-sending chain keys to replica failed", "peer", ip, "keys", len(mutations.Mutations), "err", err)
+			continue
+		}
+	}
+
+	maintenanceLogger.Info("Reconfigured replication chains", "keys", len(mutations.Mutations), "replicas", chain[1:])
+}
+
+func (chordServer *ChordServer) replicate(ip string, mutations *pb.Mutations) error {
+	node, err := Connect(ip)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+
+	_, err = node.DataClient.Replicate(ctx, mutations)
+	return err
+}
+
+// Data HTTP endpoints for keys in chain mode
+
+func (chordServer *ChordServer) serveChainGet(w http.ResponseWriter, r *http.Request, key string) {
+	value, err := chordServer.chainGet(r.Context(), key)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable)+": "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if value == nil || value.Deleted {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	data.WriteValue(w, r, *data.ValueFromProto(value))
+}
+
+func (chordServer *ChordServer) serveChainWrite(w http.ResponseWriter, r *http.Request, key string, remove bool) {
+	request := &pb.ChainWriteRequest{Mutation: &pb.Mutation{Key: key}, IfMatch: r.Header.Get("If-Match"), IfNoneMatch: r.Header.Get("If-None-Match")}
+
+	if !remove {
+		value, err := data.RequestValue(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Mutation.Value = value.ToProto()
+	}
+
+	result, err := chordServer.chainWrite(r.Context(), request)
+	if status.Code(err) == codes.FailedPrecondition {
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable)+": "+status.Convert(err).Message(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if remove {
+		if result.Created {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(([]byte)(http.StatusText(http.StatusOK)))
+		return
+	}
+
+	statusCode := http.StatusAccepted
+	if result.Created {
+		statusCode = http.StatusCreated
+	}
+
+	w.Header().Set("ETag", data.FormatETag(result.Version))
+	w.WriteHeader(statusCode)
+	w.Write(([]byte)(http.StatusText(statusCode)))
+}
+
+func chainKey(r *http.Request, policy *ReplicationPolicy) (string, bool) {
+	key := mux.Vars(r)["key"]
+	return key, key != "" && policy.Mode(key) == ChainReplication
+}
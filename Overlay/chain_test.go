@@ -0,0 +1,107 @@
+package overlay
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReplicationPolicyMode(t *testing.T) {
+	policy, err := ParseReplicationPolicy("quorum, orders/=chain, orders/archive/=quorum")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		key  string
+		mode string
+	}{
+		{"users/1", QuorumReplication},
+		{"orders/1", ChainReplication},
+		// The longest matching namespace wins.
+		{"orders/archive/1", QuorumReplication},
+		{"orders", QuorumReplication},
+	} {
+		if mode := policy.Mode(test.key); mode != test.mode {
+			t.Errorf("Mode(%q) = %s, want %s", test.key, mode, test.mode)
+		}
+	}
+
+	if !policy.usesChain() {
+		t.Error("policy with a chain namespace does not use chains")
+	}
+
+	for _, spec := range []string{"", "quorum", "chain", "chain,logs/=quorum"} {
+		policy, err := ParseReplicationPolicy(spec)
+		if err != nil {
+			t.Errorf("ParseReplicationPolicy(%q) failed: %v", spec, err)
+			continue
+		}
+		if uses := policy.usesChain(); uses != (spec != "" && spec != "quorum") {
+			t.Errorf("ParseReplicationPolicy(%q) uses chains: %v", spec, uses)
+		}
+	}
+
+	for _, spec := range []string{"primary", "orders/=eventual"} {
+		if _, err := ParseReplicationPolicy(spec); err == nil {
+			t.Errorf("ParseReplicationPolicy(%q) accepted an unknown mode", spec)
+		}
+	}
+}
+
+// A lone node whose chain continues to an address nothing listens at.
+func newBrokenChainServer(t *testing.T) *ChordServer {
+	t.Helper()
+
+	chordServer := newTestServer(t)
+	chordServer.SuccessorList = []string{"127.0.0.2"}
+	if chain := chordServer.chain(); len(chain) != 2 {
+		t.Fatalf("chain is %v, want this node and 127.0.0.2", chain)
+	}
+	return chordServer
+}
+
+func TestChainGetReadsTail(t *testing.T) {
+	chordServer := newBrokenChainServer(t)
+	putKeys(t, chordServer, "key")
+
+	// The head holds the key, but only the tail may answer reads.
+	if value, err := chordServer.chainGet(context.Background(), "key"); err == nil {
+		t.Fatalf("read %v from the head while the tail is unreachable", value)
+	}
+
+	chordServer.SuccessorList = []string{chordServer.IP}
+	if value, err := chordServer.chainGet(context.Background(), "key"); err != nil || value == nil {
+		t.Fatalf("tail read returned %v, %v", value, err)
+	}
+}
+
+func TestChainWriteResendsUnacknowledged(t *testing.T) {
+	chordServer := newBrokenChainServer(t)
+
+	_, err := chordServer.ChainWrite(context.Background(), &pb.ChainWriteRequest{Mutation: &pb.Mutation{Key: "key", Value: &pb.Value{Data: []byte("value")}}})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("write with an unreachable replica returned %v, want %v", err, codes.Unavailable)
+	}
+
+	// The head applied the write, and keeps it pending until the chain holds it.
+	applied, found := chordServer.KVStore.Store.Entry("key")
+	if !found || chordServer.chainPending["key"] != applied.Version {
+		t.Fatalf("pending writes are %v, want key at version %d", chordServer.chainPending, applied.Version)
+	}
+
+	chordServer.resendChainWrites()
+	if _, pending := chordServer.chainPending["key"]; !pending {
+		t.Fatal("write no longer pending after the replica failed again")
+	}
+
+	// Once the replica leaves the chain, re-sending succeeds trivially and clears the write.
+	chordServer.SuccessorList = []string{chordServer.IP}
+	chordServer.resendChainWrites()
+	if _, pending := chordServer.chainPending["key"]; pending {
+		t.Fatal("write still pending after it was re-sent")
+	}
+}
@@ -0,0 +1,194 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ownership fencing: a node accepts direct writes only for keys in its arc, and every change of the arc
+// bumps its ring epoch. While part of the arc is being handed off to a new owner, writes to it wait for
+// the handoff to commit and are then redirected, so that none lands after the keys were copied.
+
+const EpochHeader = "Ring-Epoch"
+
+var errOwnerUnsettled = errors.New("key is outside this node's arc but lookups still lead here")
+
+type arcHandoff struct {
+	startHash uint64
+	endHash   uint64
+	// The node receiving the arc.
+	target    string
+	committed bool
+	done      chan struct{}
+}
+
+// Whether a key hash lies in the handed-off arc (the whole ring when its bounds are equal).
+func (handoff *arcHandoff) covers(keyHash uint64) bool {
+	return handoff.startHash == handoff.endHash || isBetween(keyHash, handoff.startHash, handoff.endHash)
+}
+
+func (chordServer *ChordServer) Epoch() uint64 {
+	return chordServer.epoch.Load()
+}
+
+// Whether a key hash falls in this node's arc (every hash while it has no predecessor).
+func (chordServer *ChordServer) ownsHash(keyHash uint64) bool {
+	chordServer.PredecessorMux.RLock()
+	defer chordServer.PredecessorMux.RUnlock()
+
+	if chordServer.Predecessor == nil {
+		return true
+	}
+
+	predHash := hash(chordServer.Predecessor.Ip, chordServer.Capacity)
+	return predHash == chordServer.Hash || isBetween(keyHash, predHash, chordServer.Hash)
+}
+
+// Record a change of this node's arc.
+func (chordServer *ChordServer) advanceEpoch() {
+	epoch := chordServer.epoch.Add(1)
+	logger.Debug("Arc changed", "epoch", epoch)
+}
+
+// Fence off the arc (startHash, endHash] before copying it to target: writes already holding the fence
+// finish first, and later writes to the arc wait for endHandoff.
+func (chordServer *ChordServer) beginHandoff(startHash uint64, endHash uint64, target string) *arcHandoff {
+	handoff := &arcHandoff{startHash: startHash, endHash: endHash, target: target, done: make(chan struct{})}
+
+	chordServer.fenceMux.Lock()
+	chordServer.handoff = handoff
+	chordServer.fenceMux.Unlock()
+
+	return handoff
+}
+
+// Release the writes waiting on a handoff: redirected to its target once committed, applied here otherwise.
+// A committed handoff stays in place when keep is set, for a node that no longer owns anything.
+func (chordServer *ChordServer) endHandoff(handoff *arcHandoff, committed bool, keep bool) {
+	chordServer.fenceMux.Lock()
+	handoff.committed = committed
+	if (!committed || !keep) && chordServer.handoff == handoff {
+		chordServer.handoff = nil
+	}
+	chordServer.fenceMux.Unlock()
+
+	close(handoff.done)
+}
+
+// Hold the write fence for keys this node owns, returning the function that releases it. Keys in an arc
+// being handed off wait for the handoff; otherwise the first key owned elsewhere is returned with its
+// owner instead, and nothing is held.
+func (chordServer *ChordServer) fence(ctx context.Context, keys []string) (func(), *pb.OwnerHint, error) {
+	for {
+		chordServer.fenceMux.RLock()
+		handoff := chordServer.handoff
+
+		var waiting bool
+		var outside string
+
+		for _, key := range keys {
+			keyHash := hash(key, chordServer.Capacity)
+
+			if handoff != nil && handoff.covers(keyHash) {
+				if handoff.committed {
+					chordServer.fenceMux.RUnlock()
+					metrics.FencedWrites.WithLabelValues("redirected").Inc()
+					return nil, &pb.OwnerHint{Key: key, Owner: handoff.target, Epoch: chordServer.Epoch()}, nil
+				}
+
+				waiting = true
+				break
+			}
+
+			if outside == "" && !chordServer.ownsHash(keyHash) {
+				outside = key
+			}
+		}
+
+		if waiting {
+			chordServer.fenceMux.RUnlock()
+			metrics.FencedWrites.WithLabelValues("waited").Inc()
+
+			select {
+			case <-handoff.done:
+				continue
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+
+		if outside == "" {
+			return chordServer.fenceMux.RUnlock, nil, nil
+		}
+		chordServer.fenceMux.RUnlock()
+
+		ipMsg, err := chordServer.lookup(ctx, hash(outside, chordServer.Capacity))
+		if err != nil {
+			return nil, nil, err
+		}
+		if ipMsg.Ip.Value == chordServer.IP {
+			return nil, nil, errOwnerUnsettled
+		}
+
+		metrics.FencedWrites.WithLabelValues("redirected").Inc()
+		return nil, &pb.OwnerHint{Key: outside, Owner: ipMsg.Ip.Value, Epoch: chordServer.Epoch()}, nil
+	}
+}
+
+// An ABORTED status naming the owner of a key, for writes over gRPC.
+func ownerError(hint *pb.OwnerHint) error {
+	st := status.Newf(codes.Aborted, "%q is owned by %s", hint.Key, hint.Owner)
+	if detailed, err := st.WithDetails(hint); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// The owner named by a write's ABORTED status, if any.
+func OwnerFromError(err error) (*pb.OwnerHint, bool) {
+	if status.Code(err) != codes.Aborted {
+		return nil, false
+	}
+
+	for _, detail := range status.Convert(err).Details() {
+		if hint, ok := detail.(*pb.OwnerHint); ok {
+			return hint, true
+		}
+	}
+	return nil, false
+}
+
+// Run a direct HTTP write under the fence, or redirect it to the key's owner with a 307.
+func (chordServer *ChordServer) serveFenced(w http.ResponseWriter, r *http.Request, write http.HandlerFunc) {
+	key := mux.Vars(r)["key"]
+	if key == "" {
+		write(w, r)
+		return
+	}
+
+	release, hint, err := chordServer.fence(r.Context(), []string{key})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable)+": "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set(EpochHeader, strconv.FormatUint(chordServer.Epoch(), 10))
+
+	if hint != nil {
+		logger.Debug("Redirecting write to owner", "key", key, "peer", hint.Owner)
+		http.Redirect(w, r, fmt.Sprintf("http://%s:%d%s", hint.Owner, DataPort, r.URL.RequestURI()), http.StatusTemporaryRedirect)
+		return
+	}
+
+	defer release()
+	write(w, r)
+}
@@ -0,0 +1,209 @@
+package overlay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Fence a key in the background, reporting the owner it was redirected to ("" if it was fenced here).
+func fenceAsync(chordServer *ChordServer, key string) <-chan string {
+	owners := make(chan string, 1)
+	go func() {
+		release, hint, err := chordServer.fence(context.Background(), []string{key})
+		switch {
+		case err != nil:
+			owners <- err.Error()
+		case hint != nil:
+			owners <- hint.Owner
+		default:
+			release()
+			owners <- ""
+		}
+	}()
+	return owners
+}
+
+func TestOwnsHash(t *testing.T) {
+	chordServer := newTestServer(t)
+	ringSize := uint64(1) << chordServer.Capacity
+
+	// Without a predecessor, the node owns the whole ring.
+	for _, keyHash := range []uint64{0, chordServer.Hash, (chordServer.Hash + 1) % ringSize} {
+		if !chordServer.ownsHash(keyHash) {
+			t.Errorf("node without a predecessor does not own %d", keyHash)
+		}
+	}
+
+	chordServer.Predecessor = &ChordNode{Ip: "10.0.0.9"}
+	predHash := hash("10.0.0.9", chordServer.Capacity)
+
+	for _, test := range []struct {
+		keyHash uint64
+		owned   bool
+	}{
+		{predHash, false},
+		{(predHash + 1) % ringSize, true},
+		{chordServer.Hash, true},
+		{(chordServer.Hash + 1) % ringSize, false},
+	} {
+		if owned := chordServer.ownsHash(test.keyHash); owned != test.owned {
+			t.Errorf("ownsHash(%d) = %v with arc (%d, %d], want %v", test.keyHash, owned, predHash, chordServer.Hash, test.owned)
+		}
+	}
+}
+
+func TestFenceWaitsForHandoff(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		committed bool
+		owner     string
+	}{
+		// An aborted handoff leaves the key here, so the write goes ahead.
+		{"aborted", false, ""},
+		{"committed", true, "10.0.0.9"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			chordServer := newTestServer(t)
+			handoff := chordServer.beginHandoff(chordServer.Hash, chordServer.Hash, "10.0.0.9")
+
+			owners := fenceAsync(chordServer, "key")
+			select {
+			case owner := <-owners:
+				t.Fatalf("write went ahead during the handoff (owner %q)", owner)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			chordServer.endHandoff(handoff, test.committed, true)
+
+			select {
+			case owner := <-owners:
+				if owner != test.owner {
+					t.Fatalf("write went to %q, want %q", owner, test.owner)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("write still waiting after the handoff ended")
+			}
+		})
+	}
+}
+
+func TestFenceOutsideHandoff(t *testing.T) {
+	chordServer := newTestServer(t)
+	keys := keysByHash(chordServer.Capacity)
+
+	// Only the arc (10, 20] moves.
+	handoff := chordServer.beginHandoff(10, 20, "10.0.0.9")
+	defer chordServer.endHandoff(handoff, false, false)
+
+	select {
+	case owner := <-fenceAsync(chordServer, keys[30]):
+		if owner != "" {
+			t.Fatalf("write outside the handed-off arc went to %q", owner)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write outside the handed-off arc waited for the handoff")
+	}
+}
+
+func TestServeFenced(t *testing.T) {
+	chordServer := newTestServer(t)
+	chordServer.advanceEpoch()
+
+	serve := func() *httptest.ResponseRecorder {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/data/key?ttl=1s", nil), map[string]string{"key": "key"})
+		w := httptest.NewRecorder()
+		chordServer.serveFenced(w, r, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+		return w
+	}
+
+	w := serve()
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("owned key answered %d, want the write's %d", w.Code, http.StatusNoContent)
+	}
+	if epoch := w.Header().Get(EpochHeader); epoch != "1" {
+		t.Fatalf("%s is %q, want 1", EpochHeader, epoch)
+	}
+
+	handoff := chordServer.beginHandoff(chordServer.Hash, chordServer.Hash, "10.0.0.9")
+	chordServer.endHandoff(handoff, true, true)
+
+	w = serve()
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("handed-off key answered %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+	if location := w.Header().Get("Location"); location != "http://10.0.0.9:"+strconv.Itoa(DataPort)+"/data/key?ttl=1s" {
+		t.Fatalf("redirected to %q", location)
+	}
+}
+
+func TestOwnerFromError(t *testing.T) {
+	hint := &pb.OwnerHint{Key: "key", Owner: "10.0.0.9", Epoch: 4}
+
+	err := ownerError(hint)
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("owner error has code %v, want %v", status.Code(err), codes.Aborted)
+	}
+	if owner, ok := OwnerFromError(err); !ok || owner.Owner != hint.Owner || owner.Epoch != hint.Epoch {
+		t.Fatalf("OwnerFromError returned %v, %v, want %v", owner, ok, hint)
+	}
+
+	for _, err := range []error{nil, status.Error(codes.Aborted, "aborted"), status.Error(codes.Unavailable, "unavailable")} {
+		if owner, ok := OwnerFromError(err); ok {
+			t.Errorf("OwnerFromError(%v) found owner %v", err, owner)
+		}
+	}
+}
+
+func TestEvictPredecessorAdvancesEpoch(t *testing.T) {
+	chordServer := newTestServer(t)
+	chordServer.Predecessor = &ChordNode{Ip: "10.0.0.9"}
+
+	chordServer.EvictPeer("10.0.0.8")
+	if epoch := chordServer.Epoch(); epoch != 0 {
+		t.Fatalf("evicting another peer moved the epoch to %d", epoch)
+	}
+
+	chordServer.EvictPeer("10.0.0.9")
+	if epoch := chordServer.Epoch(); epoch != 1 || chordServer.Predecessor != nil {
+		t.Fatalf("evicting the predecessor left epoch %d and predecessor %v, want 1 and none", epoch, chordServer.Predecessor)
+	}
+}
+
+func TestUpdatePredecessorAbortsFailedTransfer(t *testing.T) {
+	chordServer := newTestServer(t)
+
+	// Nothing listens at the new predecessor, so the transfer fails.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := chordServer.UpdatePredecessor(ctx, &pb.IP{Ip: &wrapperspb.StringValue{Value: "127.0.0.2"}}); err == nil {
+		t.Fatal("UpdatePredecessor succeeded without a transfer")
+	}
+
+	if chordServer.Predecessor != nil || chordServer.Epoch() != 0 {
+		t.Fatalf("aborted handoff left predecessor %v and epoch %d", chordServer.Predecessor, chordServer.Epoch())
+	}
+	if chordServer.handoff != nil || chordServer.transfers.Load() != 0 {
+		t.Fatal("aborted handoff is still in place")
+	}
+
+	select {
+	case owner := <-fenceAsync(chordServer, "key"):
+		if owner != "" {
+			t.Fatalf("write after the aborted handoff went to %q", owner)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write waited after the handoff was aborted")
+	}
+}
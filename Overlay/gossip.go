@@ -0,0 +1,478 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+)
+
+// SWIM-style membership: each period a node pings one member, falls back to indirect
+// probes through other members, and spreads alive/suspect/dead updates by piggybacking
+// them on the probe messages.
+
+const gossipPeriod time.Duration = 1 * time.Second
+const gossipTimeout time.Duration = 500 * time.Millisecond
+const suspicionTimeout time.Duration = 5 * gossipPeriod
+const indirectProbes int = 3
+const maxPiggyback int = 8
+
+type Member struct {
+	Ip          string
+	Hash        uint64
+	State       pb.MemberState
+	Incarnation uint64
+	changed     time.Time
+}
+
+type gossipUpdate struct {
+	member    *pb.Member
+	transmits int
+}
+
+type Membership struct {
+	self        string
+	incarnation uint64
+	members     map[string]*Member
+	updates     []*gossipUpdate
+	probeOrder  []string
+	clients     map[string]*ChordNode
+	hashFunc    func(string) uint64
+	onDead      func(string)
+	lock        sync.Mutex
+}
+
+func NewMembership(self string, hashFunc func(string) uint64, onDead func(string)) *Membership {
+	return &Membership{
+		self:     self,
+		members:  make(map[string]*Member),
+		clients:  make(map[string]*ChordNode),
+		hashFunc: hashFunc,
+		onDead:   onDead,
+	}
+}
+
+// Add a member learnt outside of gossip (e.g. a contact or successor) as alive, if not already known.
+func (membership *Membership) Add(ip string) {
+	if ip == "" {
+		return
+	}
+
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	if _, known := membership.members[ip]; known || ip == membership.self {
+		return
+	}
+
+	membership.members[ip] = &Member{Ip: ip, Hash: membership.hashFunc(ip), State: pb.MemberState_ALIVE, changed: time.Now()}
+	membership.enqueue(&pb.Member{Ip: ip, State: pb.MemberState_ALIVE})
+}
+
+// Apply a batch of piggybacked updates, invoking onDead for members newly declared dead.
+func (membership *Membership) Apply(updates []*pb.Member) {
+	var dead []string
+
+	membership.lock.Lock()
+	for _, update := range updates {
+		if membership.apply(update) {
+			dead = append(dead, update.Ip)
+		}
+	}
+	membership.lock.Unlock()
+
+	for _, ip := range dead {
+		maintenanceLogger.Info("Gossip: member declared dead", "peer", ip)
+		membership.onDead(ip)
+	}
+}
+
+// Must be called with the lock held. Returns true if the member transitioned to dead.
+func (membership *Membership) apply(update *pb.Member) bool {
+	if update.Ip == membership.self {
+		// Refute suspicion (or a stale death) of ourselves with a higher incarnation.
+		if update.State != pb.MemberState_ALIVE && update.Incarnation >= membership.incarnation {
+			membership.incarnation = update.Incarnation + 1
+			membership.enqueue(&pb.Member{Ip: membership.self, State: pb.MemberState_ALIVE, Incarnation: membership.incarnation})
+		}
+		return false
+	}
+
+	member, known := membership.members[update.Ip]
+
+	if !known {
+		membership.members[update.Ip] = &Member{
+			Ip:          update.Ip,
+			Hash:        membership.hashFunc(update.Ip),
+			State:       update.State,
+			Incarnation: update.Incarnation,
+			changed:     time.Now(),
+		}
+		membership.enqueue(update)
+		return update.State == pb.MemberState_DEAD
+	}
+
+	var overrides bool
+
+	switch update.State {
+	case pb.MemberState_ALIVE:
+		overrides = update.Incarnation > member.Incarnation
+	case pb.MemberState_SUSPECT:
+		overrides = member.State == pb.MemberState_ALIVE && update.Incarnation >= member.Incarnation ||
+			update.Incarnation > member.Incarnation
+	case pb.MemberState_DEAD:
+		overrides = member.State != pb.MemberState_DEAD && update.Incarnation >= member.Incarnation ||
+			update.Incarnation > member.Incarnation
+	}
+
+	if !overrides {
+		return false
+	}
+
+	wasDead := member.State == pb.MemberState_DEAD
+	member.State = update.State
+	member.Incarnation = update.Incarnation
+	member.changed = time.Now()
+	membership.enqueue(update)
+
+	return !wasDead && update.State == pb.MemberState_DEAD
+}
+
+// Must be called with the lock held.
+func (membership *Membership) enqueue(update *pb.Member) {
+	for _, pending := range membership.updates {
+		if pending.member.Ip == update.Ip {
+			pending.member = update
+			pending.transmits = 0
+			return
+		}
+	}
+
+	membership.updates = append(membership.updates, &gossipUpdate{member: update})
+}
+
+// Select the least-transmitted updates to piggyback on the next message.
+func (membership *Membership) piggyback() []*pb.Member {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	// Each update is retransmitted ~ 3 log(n) times, enough to reach every member w.h.p.
+	limit := 3 * int(math.Ceil(math.Log2(float64(len(membership.members)+2))))
+
+	sort.SliceStable(membership.updates, func(i, j int) bool {
+		return membership.updates[i].transmits < membership.updates[j].transmits
+	})
+
+	var selected []*pb.Member
+	remaining := membership.updates[:0]
+
+	for _, pending := range membership.updates {
+		if len(selected) < maxPiggyback {
+			selected = append(selected, pending.member)
+			pending.transmits++
+		}
+
+		if pending.transmits < limit {
+			remaining = append(remaining, pending)
+		}
+	}
+
+	membership.updates = remaining
+
+	return selected
+}
+
+// Full view of the membership, including ourselves, sent to newly discovered members.
+func (membership *Membership) snapshot() []*pb.Member {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	members := []*pb.Member{{Ip: membership.self, State: pb.MemberState_ALIVE, Incarnation: membership.incarnation}}
+	for _, member := range membership.members {
+		members = append(members, &pb.Member{Ip: member.Ip, State: member.State, Incarnation: member.Incarnation})
+	}
+
+	return members
+}
+
+func (membership *Membership) Known(ip string) bool {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	_, known := membership.members[ip]
+	return known || ip == membership.self
+}
+
+func (membership *Membership) incarnationOf(ip string) uint64 {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	if member, known := membership.members[ip]; known {
+		return member.Incarnation
+	}
+	return 0
+}
+
+// Round-robin over a shuffled list of live members, reshuffling after each full pass.
+func (membership *Membership) nextTarget() (string, bool) {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	for {
+		if len(membership.probeOrder) == 0 {
+			for ip, member := range membership.members {
+				if member.State != pb.MemberState_DEAD {
+					membership.probeOrder = append(membership.probeOrder, ip)
+				}
+			}
+
+			if len(membership.probeOrder) == 0 {
+				return "", false
+			}
+
+			rand.Shuffle(len(membership.probeOrder), func(i, j int) {
+				membership.probeOrder[i], membership.probeOrder[j] = membership.probeOrder[j], membership.probeOrder[i]
+			})
+		}
+
+		target := membership.probeOrder[0]
+		membership.probeOrder = membership.probeOrder[1:]
+
+		if member, ok := membership.members[target]; ok && member.State != pb.MemberState_DEAD {
+			return target, true
+		}
+	}
+}
+
+// Up to k random live members other than the excluded one, to relay indirect probes.
+func (membership *Membership) randomMembers(k int, exclude string) []string {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	var candidates []string
+	for ip, member := range membership.members {
+		if ip != exclude && member.State == pb.MemberState_ALIVE {
+			candidates = append(candidates, ip)
+		}
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	return candidates
+}
+
+func (membership *Membership) suspect(ip string) {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	member, known := membership.members[ip]
+	if !known || member.State != pb.MemberState_ALIVE {
+		return
+	}
+
+	maintenanceLogger.Info("Gossip: suspecting member", "peer", ip)
+	membership.apply(&pb.Member{Ip: ip, State: pb.MemberState_SUSPECT, Incarnation: member.Incarnation})
+}
+
+// Declare members dead whose suspicion was not refuted in time.
+func (membership *Membership) expireSuspects() {
+	var expired []*pb.Member
+
+	membership.lock.Lock()
+	for _, member := range membership.members {
+		if member.State == pb.MemberState_SUSPECT && time.Since(member.changed) > suspicionTimeout {
+			expired = append(expired, &pb.Member{Ip: member.Ip, State: pb.MemberState_DEAD, Incarnation: member.Incarnation})
+		}
+	}
+	membership.lock.Unlock()
+
+	membership.Apply(expired)
+}
+
+// Live members (including ourselves) sorted by position on the ring.
+func (membership *Membership) Alive() []*Member {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	alive := []*Member{{Ip: membership.self, Hash: membership.hashFunc(membership.self), State: pb.MemberState_ALIVE, Incarnation: membership.incarnation}}
+	for _, member := range membership.members {
+		if member.State == pb.MemberState_ALIVE {
+			alive = append(alive, &Member{Ip: member.Ip, Hash: member.Hash, State: member.State, Incarnation: member.Incarnation})
+		}
+	}
+
+	sort.Slice(alive, func(i, j int) bool { return alive[i].Hash < alive[j].Hash })
+
+	return alive
+}
+
+// The first live member at or after keyHash on the ring, according to the member list.
+func (membership *Membership) Successor(keyHash uint64) (string, bool) {
+	alive := membership.Alive()
+
+	if len(alive) == 1 {
+		return "", false
+	}
+
+	for _, member := range alive {
+		if member.Hash >= keyHash {
+			return member.Ip, true
+		}
+	}
+
+	return alive[0].Ip, true
+}
+
+// Cached connection to a member, so that each probe does not dial a new connection.
+func (membership *Membership) client(ip string) (*ChordNode, error) {
+	membership.lock.Lock()
+	defer membership.lock.Unlock()
+
+	if node, ok := membership.clients[ip]; ok {
+		return node, nil
+	}
+
+	node, err := Connect(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	membership.clients[ip] = node
+	return node, nil
+}
+
+// Gossip services
+
+func (chordServer *ChordServer) EnableGossip() {
+	chordServer.Membership = NewMembership(
+		chordServer.IP,
+		func(ip string) uint64 { return hash(ip, chordServer.Capacity) },
+		chordServer.EvictPeer,
+	)
+}
+
+func (chordServer *ChordServer) Ping(ctx context.Context, msg *pb.GossipMessage) (*pb.GossipMessage, error) {
+	if chordServer.Membership == nil {
+		return nil, errors.New("gossip not enabled")
+	}
+
+	membership := chordServer.Membership
+
+	// A member we have not heard of yet gets our full view instead of just the recent updates.
+	newcomer := !membership.Known(msg.From)
+
+	membership.Apply(msg.Updates)
+	membership.Add(msg.From)
+
+	if newcomer {
+		return &pb.GossipMessage{From: chordServer.IP, Updates: membership.snapshot()}, nil
+	}
+
+	return &pb.GossipMessage{From: chordServer.IP, Updates: membership.piggyback()}, nil
+}
+
+func (chordServer *ChordServer) PingRequest(ctx context.Context, req *pb.PingRequest) (*pb.GossipMessage, error) {
+	if chordServer.Membership == nil {
+		return nil, errors.New("gossip not enabled")
+	}
+
+	if req.Gossip != nil {
+		chordServer.Membership.Apply(req.Gossip.Updates)
+	}
+
+	err := chordServer.ping(ctx, req.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GossipMessage{From: chordServer.IP, Updates: chordServer.Membership.piggyback()}, nil
+}
+
+func (chordServer *ChordServer) ping(ctx context.Context, target string) error {
+	node, err := chordServer.Membership.client(target)
+	if err != nil {
+		return err
+	}
+
+	reply, err := node.GossipClient.Ping(ctx, &pb.GossipMessage{From: chordServer.IP, Updates: chordServer.Membership.piggyback()})
+	if err != nil {
+		return err
+	}
+
+	chordServer.Membership.Apply(reply.Updates)
+	return nil
+}
+
+// Probe a member directly, then through up to indirectProbes other members before suspecting it.
+func (chordServer *ChordServer) probe(target string) {
+	ctx, cancel := context.WithTimeout(context.Background(), gossipTimeout)
+	err := chordServer.ping(ctx, target)
+	cancel()
+
+	if err == nil {
+		return
+	}
+
+	maintenanceLogger.Debug("Gossip: direct probe failed, probing indirectly", "peer", target, "err", err)
+
+	relays := chordServer.Membership.randomMembers(indirectProbes, target)
+	acks := make(chan bool, len(relays))
+
+	for _, relay := range relays {
+		go func(relay string) {
+			node, err := chordServer.Membership.client(relay)
+			if err != nil {
+				acks <- false
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*gossipTimeout)
+			defer cancel()
+
+			reply, err := node.GossipClient.PingRequest(ctx, &pb.PingRequest{
+				Target: target,
+				Gossip: &pb.GossipMessage{From: chordServer.IP, Updates: chordServer.Membership.piggyback()},
+			})
+			if err != nil {
+				acks <- false
+				return
+			}
+
+			chordServer.Membership.Apply(reply.Updates)
+			acks <- true
+		}(relay)
+	}
+
+	for range relays {
+		if <-acks {
+			return
+		}
+	}
+
+	chordServer.Membership.suspect(target)
+}
+
+func (chordServer *ChordServer) Gossip() {
+	for {
+		time.Sleep(gossipPeriod)
+		chordServer.waitWhilePaused()
+
+		chordServer.Membership.expireSuspects()
+
+		target, ok := chordServer.Membership.nextTarget()
+		if !ok {
+			continue
+		}
+
+		chordServer.probe(target)
+	}
+}
@@ -0,0 +1,125 @@
+package overlay
+
+import (
+	"context"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Hinted handoff: when a coordinated write cannot reach a node of the key's preference list, the
+// coordinator keeps the write as a hint for that node and replays it once the node answers again.
+// A hint counts towards W (a sloppy quorum) except at consistency level ALL.
+
+const DefaultHintBytes uint64 = 16 << 20
+const DefaultHintTTL time.Duration = 1 * time.Hour
+const hintReplayPeriod time.Duration = 10 * time.Second
+
+func (chordServer *ChordServer) SetHintedHandoff(maxBytes uint64, ttl time.Duration) {
+	chordServer.hints = data.NewHints(maxBytes, ttl)
+}
+
+// Whether a failed replica call means the node could not be reached (rather than that it refused the write).
+func unreachable(err error) bool {
+	code := status.Code(err)
+	return code == codes.Unavailable || code == codes.DeadlineExceeded
+}
+
+// Keep a write for an unreachable node; false if hint storage is full.
+func (chordServer *ChordServer) storeHint(target string, mutation *pb.Mutation) bool {
+	if err := chordServer.hints.Add(target, mutation.Key, data.ValueFromProto(mutation.Value)); err != nil {
+		logger.Warn("Dropping hint for unreachable replica", "key", mutation.Key, "peer", target, "err", err)
+		metrics.Hints.WithLabelValues("dropped").Inc()
+		return false
+	}
+
+	logger.Debug("Stored hint for unreachable replica", "key", mutation.Key, "peer", target)
+	metrics.Hints.WithLabelValues("stored").Inc()
+	return true
+}
+
+func (chordServer *ChordServer) ReplayHints() {
+	for {
+		time.Sleep(hintReplayPeriod)
+		chordServer.waitWhilePaused()
+
+		if expired := chordServer.hints.Expire(); expired > 0 {
+			maintenanceLogger.Warn("Hints expired before their replicas came back", "hints", expired)
+			metrics.Hints.WithLabelValues("expired").Add(float64(expired))
+		}
+
+		for _, target := range chordServer.hints.Targets() {
+			chordServer.replayHints(target)
+		}
+	}
+}
+
+func (chordServer *ChordServer) replayHints(target string) {
+	node, err := Connect(target)
+	if err != nil {
+		return
+	}
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	_, err = node.CheckClient.LiveCheck(ctx, &emptypb.Empty{})
+	cancel()
+
+	if err != nil {
+		maintenanceLogger.Debug("Hinted replica is still unreachable", "peer", target)
+		return
+	}
+
+	pending := chordServer.hints.Pending(target)
+
+	for start := 0; start < len(pending); start += antiEntropyBatch {
+		batch := pending[start:min(start+antiEntropyBatch, len(pending))]
+
+		mutations := &pb.Mutations{}
+		for _, hint := range batch {
+			mutations.Mutations = append(mutations.Mutations, &pb.Mutation{Key: hint.Key, Value: hint.Value.ToProto()})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+		_, err := node.DataClient.Replicate(ctx, mutations)
+		cancel()
+
+		if err != nil {
+			maintenanceLogger.Warn("Replaying hints failed", "peer", target, "err", err)
+			return
+		}
+
+		chordServer.hints.Remove(batch)
+		metrics.Hints.WithLabelValues("replayed").Add(float64(len(batch)))
+	}
+
+	maintenanceLogger.Info("Replayed hints to replica", "peer", target, "hints", len(pending))
+}
+
+// The successors of an unreachable owner: the node after it and that node's successors, or none if
+// lookups still lead to the owner.
+func (chordServer *ChordServer) successorsOf(ctx context.Context, owner string) []string {
+	ringSize := uint64(1) << chordServer.Capacity
+
+	ipMsg, err := chordServer.lookup(ctx, (hash(owner, chordServer.Capacity)+1)%ringSize)
+	if err != nil || ipMsg.Ip.Value == owner {
+		return nil
+	}
+
+	next := ipMsg.Ip.Value
+	if next == chordServer.IP {
+		return append([]string{next}, chordServer.Successors()...)
+	}
+
+	info, err := chordServer.remoteNodeInfo(ctx, next)
+	if err != nil {
+		return []string{next}
+	}
+
+	return append([]string{next}, info.Successors...)
+}
@@ -0,0 +1,39 @@
+package overlay
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQuorumWriteHintsUnreachableReplica(t *testing.T) {
+	chordServer := newTestServer(t)
+
+	// Nothing listens at the second replica.
+	preferences := []string{chordServer.IP, "127.0.0.2"}
+
+	for _, test := range []struct {
+		key     string
+		sloppy  bool
+		reached bool
+	}{
+		{"strict", false, false},
+		// The hint counts towards W.
+		{"sloppy", true, true},
+	} {
+		_, _, err := chordServer.quorumWrite(context.Background(), test.key, nil, nil, preferences, 2, test.sloppy)
+		if reached := err == nil; reached != test.reached {
+			t.Errorf("%s write returned %v, want quorum reached %v", test.key, err, test.reached)
+		}
+	}
+
+	pending := chordServer.hints.Pending("127.0.0.2")
+	if len(pending) != 2 {
+		t.Fatalf("%d hints kept for the unreachable replica, want 2", len(pending))
+	}
+
+	// Replaying to a replica that is still down keeps the hints.
+	chordServer.replayHints("127.0.0.2")
+	if count, _ := chordServer.hints.Stats(); count != 2 {
+		t.Fatalf("%d hints left after a failed replay, want 2", count)
+	}
+}
@@ -0,0 +1,100 @@
+package overlay
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const healthPeriod time.Duration = 2 * time.Second
+const healthTimeout time.Duration = 1 * time.Second
+
+// Time given to load balancers to stop routing to a leaving node before its keys are handed off.
+const drainPeriod time.Duration = 5 * time.Second
+
+// Mark the node as the first member of a new ring (as opposed to joining an existing one).
+func (chordServer *ChordServer) Create() {
+	chordServer.joined.Store(true)
+	chordServer.saveIdentity()
+}
+
+// Reasons the node should not receive traffic; empty when it is ready.
+func (chordServer *ChordServer) notReadyReasons(ctx context.Context) []string {
+	var reasons []string
+
+	if chordServer.leaving.Load() {
+		reasons = append(reasons, "leaving the ring")
+	}
+
+	if !chordServer.joined.Load() {
+		reasons = append(reasons, "not joined")
+	}
+
+	if chordServer.transfers.Load() > 0 {
+		reasons = append(reasons, "transfer in progress")
+	}
+
+	chordServer.FingerMuxs[0].RLock()
+	successor := chordServer.FingerTable[0]
+	chordServer.FingerMuxs[0].RUnlock()
+
+	if successor.Ip != chordServer.IP {
+		ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+		_, err := successor.CheckClient.LiveCheck(ctx, &emptypb.Empty{})
+		cancel()
+
+		if err != nil {
+			reasons = append(reasons, "successor "+successor.Ip+" not live")
+		}
+	}
+
+	// A node alone in its ring owns the whole ring; otherwise the arc is only known once a predecessor is.
+	chordServer.PredecessorMux.RLock()
+	arcKnown := chordServer.Predecessor != nil || successor.Ip == chordServer.IP
+	chordServer.PredecessorMux.RUnlock()
+
+	if !arcKnown {
+		reasons = append(reasons, "owned arc unknown")
+	}
+
+	return reasons
+}
+
+// Health HTTP endpoints
+
+func (chordServer *ChordServer) ServeHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write(([]byte)(http.StatusText(http.StatusOK)))
+}
+
+func (chordServer *ChordServer) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	reasons := chordServer.notReadyReasons(r.Context())
+
+	if len(reasons) > 0 {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable)+": "+strings.Join(reasons, ", "), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(([]byte)(http.StatusText(http.StatusOK)))
+}
+
+// Keep the gRPC health service in line with readiness. Updates are ignored by the health server
+// while it is shut down for a Leave.
+func (chordServer *ChordServer) ReportHealth(healthServer *health.Server) {
+	for {
+		status := healthpb.HealthCheckResponse_SERVING
+		if len(chordServer.notReadyReasons(context.Background())) > 0 {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+
+		healthServer.SetServingStatus("", status)
+
+		time.Sleep(healthPeriod)
+	}
+}
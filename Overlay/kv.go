@@ -0,0 +1,268 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The public KV gRPC service: the /data/{key}, /batch and /scan routes for gRPC clients. A single key is
+// served by its owner, which reads its store and applies writes under the fence, or through the key's chain
+// in chain mode. Batches and scans are fanned out from whichever node receives them.
+
+// Header metadata of KV responses.
+const (
+	VersionMetadata string = "version"
+	EpochMetadata   string = "ring-epoch"
+	OwnerMetadata   string = "owner"
+)
+
+// A separate type, as ChordServer's Scan already serves the Data service.
+type kvService struct {
+	pb.UnimplementedKVServer
+	chordServer *ChordServer
+}
+
+// KV Service
+
+func (kv *kvService) Get(ctx context.Context, request *pb.KVKey) (*pb.Value, error) {
+	defer kv.sendEpoch(ctx)
+
+	if request.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "no key provided")
+	}
+
+	chordServer := kv.chordServer
+
+	var value *pb.Value
+	if chordServer.replication.Mode(request.Key) == ChainReplication {
+		var err error
+		value, err = chordServer.chainGet(ctx, request.Key)
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+	} else {
+		if err := kv.redirect(ctx, request.Key); err != nil {
+			return nil, err
+		}
+
+		if stored, found := chordServer.KVStore.Get(ctx, request.Key); found {
+			value = stored.ToProto()
+		}
+	}
+
+	if value == nil || value.Deleted {
+		return nil, status.Errorf(codes.NotFound, "%q not found", request.Key)
+	}
+
+	kv.sendVersion(ctx, value.Version)
+	return value, nil
+}
+
+func (kv *kvService) Put(ctx context.Context, request *pb.KVPutRequest) (*pb.WriteResult, error) {
+	defer kv.sendEpoch(ctx)
+
+	if request.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "no key provided")
+	}
+
+	value := data.Value{Data: request.Data, ContentType: request.ContentType}
+	if value.ContentType == "" {
+		value.ContentType = "application/octet-stream"
+	}
+
+	if request.Ttl != nil {
+		if err := request.Ttl.CheckValid(); err != nil || request.Ttl.AsDuration() <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "TTL must be positive")
+		}
+		value.ExpiresAt = time.Now().Add(request.Ttl.AsDuration()).UnixNano()
+	}
+
+	return kv.write(ctx, request.Key, &value, request.IfVersion, request.IfAbsent)
+}
+
+func (kv *kvService) Delete(ctx context.Context, request *pb.KVDeleteRequest) (*pb.WriteResult, error) {
+	defer kv.sendEpoch(ctx)
+
+	if request.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "no key provided")
+	}
+
+	return kv.write(ctx, request.Key, nil, request.IfVersion, false)
+}
+
+func (kv *kvService) BatchGet(ctx context.Context, request *pb.KVBatchGetRequest) (*pb.KVBatchGetResponse, error) {
+	defer kv.sendEpoch(ctx)
+
+	if len(request.Keys) > maxBatchKeys {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d keys per batch", maxBatchKeys)
+	}
+
+	values, failures := kv.chordServer.batchGet(ctx, request.Keys)
+	return &pb.KVBatchGetResponse{Values: values, Errors: failures}, nil
+}
+
+func (kv *kvService) BatchPut(ctx context.Context, request *pb.KVBatchPutRequest) (*pb.WriteResults, error) {
+	defer kv.sendEpoch(ctx)
+
+	if len(request.Values) > maxBatchKeys {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d keys per batch", maxBatchKeys)
+	}
+
+	values := make(map[string]*pb.Value, len(request.Values))
+	invalid := make(map[string]*pb.WriteResult)
+
+	for key, value := range request.Values {
+		if key == "" || value == nil {
+			invalid[key] = &pb.WriteResult{Error: "no key or value provided"}
+			continue
+		}
+
+		// Versions are assigned by the owner, and deletes are not batched.
+		value := &pb.Value{Data: value.Data, ContentType: value.ContentType, ExpiresAt: value.ExpiresAt}
+		if value.ContentType == "" {
+			value.ContentType = "application/octet-stream"
+		}
+		values[key] = value
+	}
+
+	results := kv.chordServer.batchPut(ctx, values)
+	for key, result := range invalid {
+		results[key] = result
+	}
+
+	return &pb.WriteResults{Results: results}, nil
+}
+
+func (kv *kvService) Scan(ctx context.Context, request *pb.KVScanRequest) (*pb.KVScanResponse, error) {
+	defer kv.sendEpoch(ctx)
+
+	limit := int(request.Limit)
+	if limit == 0 {
+		limit = defaultScanLimit
+	}
+	if limit > maxScanLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxScanLimit)
+	}
+
+	entries, cursor, err := kv.chordServer.scanRing(ctx, request.Cursor, limit, request.Values)
+	if errors.Is(err, errInvalidCursor) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return &pb.KVScanResponse{Entries: entries, Cursor: cursor}, nil
+}
+
+// Write value to key, or delete key when value is nil, at the key's owner or chain head.
+func (kv *kvService) write(ctx context.Context, key string, value *data.Value, ifVersion uint64, ifAbsent bool) (*pb.WriteResult, error) {
+	chordServer := kv.chordServer
+
+	var ifMatch, ifNoneMatch string
+	if ifVersion != 0 {
+		ifMatch = data.FormatETag(ifVersion)
+	}
+	if ifAbsent {
+		ifNoneMatch = "*"
+	}
+
+	if chordServer.replication.Mode(key) == ChainReplication {
+		request := &pb.ChainWriteRequest{Mutation: &pb.Mutation{Key: key}, IfMatch: ifMatch, IfNoneMatch: ifNoneMatch}
+		if value != nil {
+			request.Mutation.Value = value.ToProto()
+		}
+
+		result, err := chordServer.chainWrite(ctx, request)
+		if status.Code(err) == codes.FailedPrecondition {
+			return nil, status.Errorf(codes.FailedPrecondition, "precondition failed for %q", key)
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, status.Convert(err).Message())
+		}
+
+		// A chain delete of a missing key reports it as created, with no tombstone written.
+		if value == nil && result.Created {
+			return nil, status.Errorf(codes.NotFound, "%q not found", key)
+		}
+
+		kv.sendVersion(ctx, result.Version)
+		return result, nil
+	}
+
+	release, hint, err := chordServer.fence(ctx, []string{key})
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if hint != nil {
+		return nil, kv.ownerError(ctx, hint)
+	}
+	defer release()
+
+	precondition := data.HeaderPrecondition(ifMatch, ifNoneMatch)
+
+	var stored data.Value
+	var found bool
+	if value == nil {
+		stored, found, err = chordServer.KVStore.Delete(ctx, key, precondition)
+	} else {
+		stored, found, err = chordServer.KVStore.Put(ctx, key, *value, precondition)
+	}
+
+	if errors.Is(err, data.ErrPreconditionFailed) {
+		return nil, status.Errorf(codes.FailedPrecondition, "precondition failed for %q", key)
+	}
+	if err != nil {
+		logger.Error("Storing KV write failed", "key", key, "err", err)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if value == nil && !found {
+		return nil, status.Errorf(codes.NotFound, "%q not found", key)
+	}
+
+	kv.sendVersion(ctx, stored.Version)
+	return &pb.WriteResult{Version: stored.Version, Created: !found}, nil
+}
+
+// An ABORTED error naming the owner of a key this node does not own, or nil if it owns the key.
+func (kv *kvService) redirect(ctx context.Context, key string) error {
+	chordServer := kv.chordServer
+
+	keyHash := hash(key, chordServer.Capacity)
+	if chordServer.ownsHash(keyHash) {
+		return nil
+	}
+
+	ipMsg, err := chordServer.lookup(ctx, keyHash)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if ipMsg.Ip.Value == chordServer.IP {
+		return nil
+	}
+
+	return kv.ownerError(ctx, &pb.OwnerHint{Key: key, Owner: ipMsg.Ip.Value, Epoch: chordServer.Epoch()})
+}
+
+func (kv *kvService) ownerError(ctx context.Context, hint *pb.OwnerHint) error {
+	logger.Debug("Redirecting KV request to owner", "key", hint.Key, "peer", hint.Owner)
+	grpc.SetHeader(ctx, metadata.Pairs(OwnerMetadata, hint.Owner))
+	return ownerError(hint)
+}
+
+func (kv *kvService) sendVersion(ctx context.Context, version uint64) {
+	grpc.SetHeader(ctx, metadata.Pairs(VersionMetadata, strconv.FormatUint(version, 10)))
+}
+
+func (kv *kvService) sendEpoch(ctx context.Context) {
+	grpc.SetHeader(ctx, metadata.Pairs(EpochMetadata, strconv.FormatUint(kv.chordServer.Epoch(), 10)))
+}
@@ -2,9 +2,9 @@ package overlay
 
 import (
 	"context"
-	"log"
 	"time"
 
+	metrics "github.com/girivad/go-chord/Metrics"
 	pb "github.com/girivad/go-chord/Proto"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -18,12 +18,13 @@ const MaxRetries int = 3
 func (chordServer *ChordServer) Notify() {
 	for {
 		time.Sleep(period)
-		log.Printf("[INFO] Notifying successor %s", chordServer.FingerTable[0].Ip)
+		chordServer.waitWhilePaused()
+
 		chordServer.FingerMuxs[0].RLock()
 		successorIP := chordServer.FingerTable[0].Ip
 
 		if successorIP == chordServer.IP {
-			log.Printf("[INFO] No successor to notify.")
+			maintenanceLogger.Debug("No successor to notify")
 			chordServer.FingerMuxs[0].RUnlock()
 			continue
 		}
@@ -35,9 +36,9 @@ func (chordServer *ChordServer) Notify() {
 		chordServer.FingerMuxs[0].RUnlock()
 
 		if err != nil {
-			log.Printf("[DEBUG] Unable to notify succesor %s due to err: %v", successorIP, err)
+			maintenanceLogger.Warn("Unable to notify successor", "peer", successorIP, "err", err)
 		} else {
-			log.Printf("[INFO] Notified successor %s", successorIP)
+			maintenanceLogger.Debug("Notified successor", "peer", successorIP)
 		}
 	}
 }
@@ -46,99 +47,101 @@ func (chordServer *ChordServer) Notify() {
 
 func (chordServer *ChordServer) FixFingers() {
 	retries := 0
-	expired := false
+	var fingerToUpdate uint64
 
-	var fingerToUpdate, fingerStart uint64
-	var newFinger *ChordNode
-	var previousFingerIP string
+	for {
+		time.Sleep(period)
+		chordServer.waitWhilePaused()
 
-	isExpired := func() bool {
-		retries++
-		if retries > MaxRetries {
-			retries = 0
-			return true
+		err := chordServer.fixFinger(fingerToUpdate)
+
+		if err != nil {
+			retries++
+			if retries <= MaxRetries {
+				maintenanceLogger.Debug("Unable to fix finger, retrying", "finger", fingerToUpdate, "err", err)
+				continue
+			}
+			maintenanceLogger.Warn("Retries for finger expired, moving to next finger", "finger", fingerToUpdate, "err", err)
 		}
 
-		return false
+		retries = 0
+		fingerToUpdate = (fingerToUpdate + 1) % chordServer.Capacity
 	}
+}
 
-	for {
-		time.Sleep(period)
-		log.Printf("[INFO] Fixing Finger %d...", fingerToUpdate)
-
-		fingerStart = (chordServer.Hash + 1<<(fingerToUpdate)) % (1 << chordServer.Capacity)
+// Fix every finger once, returning the first error encountered.
+func (chordServer *ChordServer) fixAllFingers() error {
+	var firstErr error
 
-		if fingerToUpdate > 0 {
-			chordServer.FingerMuxs[fingerToUpdate-1].RLock()
-			previousFingerIP = chordServer.FingerTable[fingerToUpdate-1].Ip
+	for finger := uint64(0); finger < chordServer.Capacity; finger++ {
+		if err := chordServer.fixFinger(finger); err != nil && firstErr == nil {
+			firstErr = err
 		}
+	}
 
-		if fingerToUpdate > 0 && isBetween(hash(previousFingerIP, chordServer.Capacity), fingerStart, chordServer.Hash) { // Use the previously updated finger if in the right segment of the ring.
-			chordServer.FingerMuxs[fingerToUpdate-1].RUnlock()
-			newFinger, err := Connect(previousFingerIP) // Could do chordServer.FingerTable[fingerToUpdate - 1], but the lock would tremendously slow down most operations if all fingers are the same node. Worth thinking about.
-			if err == nil {
-				chordServer.FingerMuxs[fingerToUpdate].Lock()
-				chordServer.FingerTable[fingerToUpdate] = newFinger
-				chordServer.FingerMuxs[fingerToUpdate].Unlock()
+	return firstErr
+}
 
-				log.Printf("[INFO] %s copied the previous finger %s to finger %d.", chordServer.IP, newFinger.Ip, fingerToUpdate)
+func (chordServer *ChordServer) fixFinger(fingerToUpdate uint64) error {
+	var previousFingerIP string
 
-				retries = 0
-				continue
-			}
+	fingerStart := (chordServer.Hash + 1<<(fingerToUpdate)) % (1 << chordServer.Capacity)
 
-			expired = isExpired()
-			if expired {
-				log.Printf("[INFO] Retries for %dth finger expired, moving to next finger.", fingerToUpdate)
-				fingerToUpdate = (fingerToUpdate + 1) % chordServer.Capacity
-			}
-			continue
-		} else if fingerToUpdate > 0 {
-			chordServer.FingerMuxs[fingerToUpdate-1].RUnlock()
+	if fingerToUpdate > 0 {
+		chordServer.FingerMuxs[fingerToUpdate-1].RLock()
+		// Unset while the lookups for it only return this node.
+		if previousFinger := chordServer.FingerTable[fingerToUpdate-1]; previousFinger != nil {
+			previousFingerIP = previousFinger.Ip
 		}
+		chordServer.FingerMuxs[fingerToUpdate-1].RUnlock()
+	}
 
-		newFingerIp, err := chordServer.FindSuccessor(context.Background(), &pb.Hash{
-			Hash: &wrapperspb.UInt64Value{Value: fingerStart},
-		})
+	newFingerIP := previousFingerIP
+
+	// Use the previously updated finger if in the right segment of the ring, otherwise look the finger up.
+	if previousFingerIP == "" || !isBetween(hash(previousFingerIP, chordServer.Capacity), fingerStart, chordServer.Hash) {
+		newFingerIpMsg, err := chordServer.findFinger(fingerStart)
 
 		if err != nil {
-			log.Printf("[INFO] %s Unable to find %d finger due to %v, retrying...", chordServer.IP, fingerToUpdate, err)
-			expired = isExpired()
-			if expired {
-				log.Printf("[INFO] Retries for %dth finger expired, moving to next finger.", fingerToUpdate)
-				fingerToUpdate = (fingerToUpdate + 1) % chordServer.Capacity
-			}
-			continue
+			metrics.FixFingerEvents.WithLabelValues("error").Inc()
+			return err
 		}
 
-		log.Printf("[INFO] FF: New Finger %d is %s", fingerToUpdate, newFingerIp.Ip.Value)
+		newFingerIP = newFingerIpMsg.Ip.Value
 
-		if newFingerIp.Ip.Value == chordServer.IP {
-			log.Printf("[INFO] %s still getting itself as finger %d", chordServer.IP, fingerToUpdate)
-			continue
+		if newFingerIP == chordServer.IP {
+			maintenanceLogger.Debug("Still getting self as finger", "finger", fingerToUpdate)
+			return nil
 		}
+	}
 
-		newFinger, err = Connect(newFingerIp.Ip.Value)
-		if err != nil {
-			log.Printf("[INFO] %s Unable to connect to found %d finger %s due to %v, retrying...", chordServer.IP, fingerToUpdate, newFingerIp.Ip.Value, err)
+	// Could share chordServer.FingerTable[fingerToUpdate - 1], but the lock would tremendously slow down most operations if all fingers are the same node. Worth thinking about.
+	newFinger, err := Connect(newFingerIP)
+	if err != nil {
+		metrics.FixFingerEvents.WithLabelValues("error").Inc()
+		return err
+	}
 
-			expired = isExpired()
-			if expired {
-				log.Printf("[INFO] Retries for %dth finger expired, moving to next finger.", fingerToUpdate)
-				fingerToUpdate = (fingerToUpdate + 1) % chordServer.Capacity
-			}
-			continue
-		}
-		chordServer.FingerMuxs[fingerToUpdate].Lock()
-		chordServer.FingerTable[fingerToUpdate] = newFinger
-		chordServer.FingerMuxs[fingerToUpdate].Unlock()
+	chordServer.FingerMuxs[fingerToUpdate].Lock()
+	chordServer.FingerTable[fingerToUpdate] = newFinger
+	chordServer.FingerMuxs[fingerToUpdate].Unlock()
 
-		log.Printf("[INFO] %s updated finger %d to %s", chordServer.IP, fingerToUpdate, newFinger.Ip)
+	metrics.FixFingerEvents.WithLabelValues("ok").Inc()
 
-		fingerToUpdate = (fingerToUpdate + 1) % chordServer.Capacity
+	maintenanceLogger.Debug("Updated finger", "finger", fingerToUpdate, "peer", newFinger.Ip)
 
-		log.Printf("[INFO] %s to update finger %d next", chordServer.IP, fingerToUpdate)
+	return nil
+}
+
+// Resolve the node responsible for fingerStart, preferring the gossip member list when it is enabled.
+func (chordServer *ChordServer) findFinger(fingerStart uint64) (*pb.IP, error) {
+	if chordServer.Membership != nil {
+		if successorIP, ok := chordServer.Membership.Successor(fingerStart); ok {
+			return &pb.IP{Ip: &wrapperspb.StringValue{Value: successorIP}}, nil
+		}
 	}
+
+	return chordServer.lookup(context.Background(), fingerStart)
 }
 
 // Check Predecessor (Set predecessor to nil if it is not live any more)
@@ -158,11 +161,12 @@ func (chordServer *ChordServer) CheckPredecessor() {
 
 	for {
 		time.Sleep(period)
+		chordServer.waitWhilePaused()
 
 		chordServer.PredecessorMux.RLock()
 
 		if chordServer.Predecessor == nil {
-			log.Printf("[INFO] No predecessor to check.")
+			maintenanceLogger.Debug("No predecessor to check")
 			chordServer.PredecessorMux.RUnlock()
 			continue
 		}
@@ -174,19 +178,24 @@ func (chordServer *ChordServer) CheckPredecessor() {
 		if err != nil {
 
 			if !isExpired() {
-				log.Printf("[INFO] %s's predecessor did not respond to liveness check due to %v, retrying...", chordServer.IP, err)
+				maintenanceLogger.Debug("Predecessor did not respond to liveness check, retrying", "err", err)
 				continue
 			}
 
-			log.Printf("[INFO] %s's predecessor did not respond to liveness check due to %v and was set to nil", chordServer.IP, err)
+			maintenanceLogger.Warn("Predecessor did not respond to liveness check and was cleared", "err", err)
 			chordServer.PredecessorMux.Lock()
 			chordServer.Predecessor = nil
+			chordServer.advanceEpoch()
 			chordServer.PredecessorMux.Unlock()
+			metrics.PredecessorChanges.Inc()
 			retries = 0
+
+			// This node now heads the chains of its former predecessor's keys.
+			go chordServer.reconfigureChains()
 			continue
 		}
 
-		log.Printf("[INFO] %s's predecessor %s is still live.", chordServer.IP, chordServer.Predecessor.Ip)
+		maintenanceLogger.Debug("Predecessor is still live")
 	}
 }
 
@@ -194,38 +203,70 @@ func (chordServer *ChordServer) CheckPredecessor() {
 func (chordServer *ChordServer) Stabilize() {
 	for {
 		time.Sleep(period)
-		log.Println("[INFO] Stabilizing...")
+		chordServer.waitWhilePaused()
 
-		chordServer.FingerMuxs[0].RLock()
-		successorIP := chordServer.FingerTable[0].Ip
+		chordServer.stabilize()
+		chordServer.resendChainWrites()
+	}
+}
 
-		newSuccessorIp, err := chordServer.FingerTable[0].PredecessorClient.GetPredecessor(context.Background(), &emptypb.Empty{})
+func (chordServer *ChordServer) stabilize() error {
+	maintenanceLogger.Debug("Stabilizing")
 
-		chordServer.FingerMuxs[0].RUnlock()
+	chordServer.refreshSuccessors()
 
-		if err != nil {
-			log.Printf("[INFO] %s's successor %s failed to provide its predecessor due to %v", chordServer.IP, successorIP, err)
-			continue
-		}
+	chordServer.FingerMuxs[0].RLock()
+	successor := chordServer.FingerTable[0]
+	chordServer.FingerMuxs[0].RUnlock()
 
-		if successorIP != chordServer.IP && !isBetween(hash(newSuccessorIp.Ip.Value, chordServer.Capacity), chordServer.Hash, hash(successorIP, chordServer.Capacity)) {
-			// chordServer is still the latest predecessor to its successor (i.e. no new nodes have joined in between them).
-			log.Printf("[INFO] %s is still the latest predecessor to %s.", chordServer.IP, successorIP)
-			continue
-		}
+	newSuccessorIp, err := successor.PredecessorClient.GetPredecessor(context.Background(), &emptypb.Empty{})
+
+	if err != nil {
+		maintenanceLogger.Warn("Successor failed to provide its predecessor", "peer", successor.Ip, "err", err)
+		metrics.StabilizeEvents.WithLabelValues("error").Inc()
+		return err
+	}
 
-		newSuccessor, err := Connect(newSuccessorIp.Ip.Value)
+	if successor.Ip != chordServer.IP && !isBetween(hash(newSuccessorIp.Ip.Value, chordServer.Capacity), chordServer.Hash, hash(successor.Ip, chordServer.Capacity)) {
+		// chordServer is still the latest predecessor to its successor (i.e. no new nodes have joined in between them).
+		maintenanceLogger.Debug("Still the latest predecessor of successor", "peer", successor.Ip)
+		metrics.StabilizeEvents.WithLabelValues("ok").Inc()
+		return nil
+	}
 
-		if err != nil {
-			log.Printf("[INFO] %s failed to connect with its new successor %s, retrying while retaining the old successor...", chordServer.IP, newSuccessorIp.Ip.Value)
-		}
+	newSuccessor, err := Connect(newSuccessorIp.Ip.Value)
 
-		chordServer.FingerMuxs[0].Lock()
+	if err != nil {
+		maintenanceLogger.Warn("Failed to connect with new successor, retaining the old successor", "peer", newSuccessorIp.Ip.Value, "err", err)
+		metrics.StabilizeEvents.WithLabelValues("error").Inc()
+		return err
+	}
+
+	chordServer.FingerMuxs[0].Lock()
+
+	chordServer.FingerTable[0] = newSuccessor
+
+	chordServer.FingerMuxs[0].Unlock()
 
-		chordServer.FingerTable[0] = newSuccessor
+	maintenanceLogger.Info("New successor", "peer", newSuccessorIp.Ip.Value)
+	metrics.StabilizeEvents.WithLabelValues("successor_changed").Inc()
 
-		chordServer.FingerMuxs[0].Unlock()
+	return nil
+}
 
-		log.Printf("[INFO] %s is %s's new successor.", newSuccessorIp, chordServer.IP)
+// Block the calling maintenance loop while maintenance is paused.
+func (chordServer *ChordServer) waitWhilePaused() {
+	chordServer.maintenanceMux.Lock()
+	for chordServer.maintenancePaused {
+		chordServer.maintenanceCond.Wait()
 	}
+	chordServer.maintenanceMux.Unlock()
+}
+
+func (chordServer *ChordServer) setMaintenancePaused(paused bool) {
+	chordServer.maintenanceMux.Lock()
+	chordServer.maintenancePaused = paused
+	chordServer.maintenanceMux.Unlock()
+
+	chordServer.maintenanceCond.Broadcast()
 }
@@ -2,18 +2,30 @@ package overlay
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	data "github.com/girivad/go-chord/Data"
+	logging "github.com/girivad/go-chord/Logging"
+	metrics "github.com/girivad/go-chord/Metrics"
 	pb "github.com/girivad/go-chord/Proto"
+	tracing "github.com/girivad/go-chord/Tracing"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
+// Port of the HTTP data server.
+const DataPort int = 8080
+
+var logger = logging.Logger(logging.Overlay)
+var maintenanceLogger = logging.Logger(logging.Maintenance)
+
 // Interface for nodes in the Chord Ring.
 type ChordNode struct {
 	// Collection of clients for multiple services.
@@ -22,6 +34,13 @@ type ChordNode struct {
 	LookupClient      pb.LookupClient
 	CheckClient       pb.CheckClient
 	DataClient        pb.DataClient
+	GossipClient      pb.GossipClient
+	TopologyClient    pb.TopologyClient
+	WatchClient       pb.WatchClient
+	ChainClient       pb.ChainClient
+	AntiEntropyClient pb.AntiEntropyClient
+	KVClient          pb.KVClient
+	conn              *grpc.ClientConn
 }
 
 // The local server
@@ -32,13 +51,60 @@ type ChordServer struct {
 	Capacity       uint64
 	Predecessor    *ChordNode
 	FingerTable    []*ChordNode
-	keyIndex       *KeyIndex
+	Membership     *Membership
 	FingerMuxs     []sync.RWMutex
 	PredecessorMux sync.RWMutex
+	// FingerTable[0] and the successors after it, as reported by FingerTable[0]; the next live one
+	// replaces a failed FingerTable[0].
+	SuccessorList     []string
+	SuccessorListMux  sync.RWMutex
+	successorFailures int
+	// Replication factor N of coordinated requests that do not set their own.
+	replicas int
+	// Replication mode of each key; chainMux serializes chain reconfigurations.
+	replication *ReplicationPolicy
+	chainMux    sync.Mutex
+	// Keys whose chain write was not acknowledged, with the newest such version (see resendChainWrites).
+	chainPending    map[string]uint64
+	chainPendingMux sync.Mutex
+	// Anti-entropy settings, and the Merkle tree built last (see merkleTree).
+	antiEntropy AntiEntropyOptions
+	merkleCache *merkleTree
+	merkleMux   sync.Mutex
+	// Writes kept for unreachable replicas.
+	hints *data.Hints
+	// Age after which acknowledged delete tombstones are purged.
+	tombstoneGrace time.Duration
+	// Redis protocol listener settings.
+	resp RESPOptions
+	// Ring epoch of the arc, and the handoff direct writes wait on (see fence); handoffMux serializes handoffs.
+	epoch      atomic.Uint64
+	fenceMux   sync.RWMutex
+	handoff    *arcHandoff
+	handoffMux sync.Mutex
+	// Directory the node's identity is persisted in; empty when it is not persisted.
+	stateDir    string
+	identityMux sync.Mutex
+	// Maintenance loops block while paused by an operator.
+	maintenancePaused bool
+	maintenanceMux    sync.Mutex
+	maintenanceCond   *sync.Cond
+	grpcServer        *grpc.Server
+	healthServer      *health.Server
+	// Readiness state: joined a ring, number of transfers in flight, and leaving the ring.
+	joined    atomic.Bool
+	transfers atomic.Int32
+	leaving   atomic.Bool
 	pb.UnimplementedLookupServer
 	pb.UnimplementedPredecessorServer
 	pb.UnimplementedCheckServer
 	pb.UnimplementedDataServer
+	pb.UnimplementedGossipServer
+	pb.UnimplementedTopologyServer
+	pb.UnimplementedAdminServer
+	pb.UnimplementedWatchServer
+	pb.UnimplementedChainServer
+	pb.UnimplementedAntiEntropyServer
 }
 
 func NewChordServer(ip string, capacity uint64) (*ChordServer, error) {
@@ -49,10 +115,16 @@ func NewChordServer(ip string, capacity uint64) (*ChordServer, error) {
 		Predecessor: nil,
 		FingerTable: make([]*ChordNode, capacity),
 		FingerMuxs:  make([]sync.RWMutex, capacity),
+		replicas:    DefaultReplicas,
+		replication: &ReplicationPolicy{Default: QuorumReplication},
+		antiEntropy: AntiEntropyOptions{Interval: DefaultAntiEntropyInterval},
 	}
 
-	chordServer.KVStore = data.NewDataServer(chordServer.RegisterKey, chordServer.RegisterDelete)
-	chordServer.keyIndex = NewKeyIndex()
+	chordServer.maintenanceCond = sync.NewCond(&chordServer.maintenanceMux)
+	chordServer.SetHintedHandoff(DefaultHintBytes, DefaultHintTTL)
+	chordServer.SetTombstoneGrace(DefaultTombstoneGrace)
+
+	chordServer.KVStore = data.NewDataServer(data.NewMemoryStore(chordServer.KeyHash))
 
 	successor, err := Connect(ip)
 	if err != nil {
@@ -63,6 +135,24 @@ func NewChordServer(ip string, capacity uint64) (*ChordServer, error) {
 	return chordServer, nil
 }
 
+// Position of a key on this node's ring.
+func (chordServer *ChordServer) KeyHash(key string) uint64 {
+	return hash(key, chordServer.Capacity)
+}
+
+// Replace the default in-memory store with the backend selected by options. Must be called before Serve.
+func (chordServer *ChordServer) OpenStore(options data.StoreOptions) error {
+	store, err := data.OpenStore(options, chordServer.KeyHash)
+	if err != nil {
+		return err
+	}
+
+	chordServer.KVStore.SetStore(store)
+	logger.Info("Opened store", "backend", options.Backend, "keys", store.Stats().Keys)
+
+	return nil
+}
+
 func (chordServer *ChordServer) Serve() error {
 	// Serve the gRPC server as well, at port 8081.
 	grpcListener, err := net.Listen("tcp", ":8081")
@@ -71,18 +161,56 @@ func (chordServer *ChordServer) Serve() error {
 		return err
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(tracing.ServerOption())
+	chordServer.grpcServer = grpcServer
 	pb.RegisterPredecessorServer(grpcServer, chordServer)
 	pb.RegisterLookupServer(grpcServer, chordServer)
 	pb.RegisterCheckServer(grpcServer, chordServer)
 	pb.RegisterDataServer(grpcServer, chordServer)
+	pb.RegisterGossipServer(grpcServer, chordServer)
+	pb.RegisterTopologyServer(grpcServer, chordServer)
+	pb.RegisterAdminServer(grpcServer, chordServer)
+	pb.RegisterWatchServer(grpcServer, chordServer)
+	pb.RegisterChainServer(grpcServer, chordServer)
+	pb.RegisterAntiEntropyServer(grpcServer, chordServer)
+	pb.RegisterKVServer(grpcServer, &kvService{chordServer: chordServer})
+
+	chordServer.healthServer = health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, chordServer.healthServer)
+
+	chordServer.KVStore.HandleFunc("/node", chordServer.ServeNodeInfo, "GET")
+	chordServer.KVStore.HandleFunc("/ring", chordServer.ServeRing, "GET")
+	chordServer.KVStore.HandleFunc("/healthz", chordServer.ServeHealthz, "GET")
+	chordServer.KVStore.HandleFunc("/readyz", chordServer.ServeReadyz, "GET")
+	chordServer.KVStore.HandleFunc("/batch/get", chordServer.ServeBatchGet, "POST")
+	chordServer.KVStore.HandleFunc("/batch/put", chordServer.ServeBatchPut, "POST")
+	chordServer.KVStore.HandleFunc("/scan", chordServer.ServeScan, "GET")
+	chordServer.KVStore.HandleFunc("/watch", chordServer.ServeWatch, "GET")
+	chordServer.KVStore.HandleFunc("/data/{key}", chordServer.ServeGet, "GET")
+	chordServer.KVStore.HandleFunc("/data/{key}", chordServer.ServePut, "PUT")
+	chordServer.KVStore.HandleFunc("/data/{key}", chordServer.ServeDelete, "DELETE")
 
-	// Data served from port 8080.
-	go chordServer.KVStore.Serve(8080)
+	go chordServer.KVStore.Serve(DataPort)
 	go chordServer.Notify()
 	go chordServer.FixFingers()
 	go chordServer.CheckPredecessor()
 	go chordServer.Stabilize()
+	go chordServer.ReportHealth(chordServer.healthServer)
+
+	if chordServer.Membership != nil {
+		go chordServer.Gossip()
+	}
+
+	if chordServer.antiEntropy.Interval > 0 {
+		go chordServer.SyncReplicas()
+	}
+
+	go chordServer.ReplayHints()
+	go chordServer.CollectTombstones()
+
+	if chordServer.resp.Port > 0 {
+		go chordServer.ServeRESP()
+	}
 
 	err = grpcServer.Serve(grpcListener)
 
@@ -91,7 +219,12 @@ func (chordServer *ChordServer) Serve() error {
 
 func Connect(ip string) (*ChordNode, error) {
 	// Returns pointer to ChordNode with clients to the IP address.
-	clientConn, err := grpc.Dial(ip+":8081", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	clientConn, err := grpc.Dial(
+		ip+":8081",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(metrics.UnaryClientInterceptor(ip)),
+		tracing.DialOption(),
+	)
 
 	if err != nil {
 		return nil, err
@@ -103,11 +236,23 @@ func Connect(ip string) (*ChordNode, error) {
 		LookupClient:      pb.NewLookupClient(clientConn),
 		CheckClient:       pb.NewCheckClient(clientConn),
 		DataClient:        pb.NewDataClient(clientConn),
+		GossipClient:      pb.NewGossipClient(clientConn),
+		TopologyClient:    pb.NewTopologyClient(clientConn),
+		WatchClient:       pb.NewWatchClient(clientConn),
+		ChainClient:       pb.NewChainClient(clientConn),
+		AntiEntropyClient: pb.NewAntiEntropyClient(clientConn),
+		KVClient:          pb.NewKVClient(clientConn),
+		conn:              clientConn,
 	}
 
 	return chordNode, nil
 }
 
+// Close the underlying connection of a node that is no longer referenced.
+func (chordNode *ChordNode) Close() error {
+	return chordNode.conn.Close()
+}
+
 func (chordServer *ChordServer) Join(contactNode *ChordNode) error {
 	// Find successor
 	successorIpMsg, err := contactNode.LookupClient.FindSuccessor(context.Background(), &pb.Hash{
@@ -118,7 +263,7 @@ func (chordServer *ChordServer) Join(contactNode *ChordNode) error {
 		return err
 	}
 
-	log.Printf("[INFO] %s joining chord ring of %s: successor is %s", chordServer.IP, contactNode.Ip, successorIpMsg.Ip.Value)
+	logger.Info("Joining chord ring", "contact", contactNode.Ip, "successor", successorIpMsg.Ip.Value)
 
 	// Set successor
 	chordServer.FingerTable[0], err = Connect(successorIpMsg.Ip.Value)
@@ -127,34 +272,136 @@ func (chordServer *ChordServer) Join(contactNode *ChordNode) error {
 		return err
 	}
 
+	if chordServer.Membership != nil {
+		chordServer.Membership.Add(contactNode.Ip)
+		chordServer.Membership.Add(successorIpMsg.Ip.Value)
+	}
+
+	chordServer.joined.Store(true)
+	chordServer.saveIdentity()
+
 	return err
 }
 
-func (chordServer *ChordServer) Leave() {
+// Hand every key over to the successor and stop serving; neighbours repair their routing state
+// through their regular failure detection. Readiness is withdrawn first so that traffic drains.
+func (chordServer *ChordServer) Leave() error {
+	chordServer.leaving.Store(true)
+	if chordServer.healthServer != nil {
+		chordServer.healthServer.Shutdown()
+	}
 
-	transferData := make(map[string]*pb.Value)
-	chordServer.FingerTable[0].DataClient.TransferData(context.Background(), &pb.KVMap{Kvmap: transferData})
-}
+	time.Sleep(drainPeriod)
 
-func (chordServer *ChordServer) RegisterKey(key string) {
-	if chordServer.Predecessor != nil && !isBetween(hash(key, chordServer.Capacity), hash(chordServer.Predecessor.Ip, chordServer.Capacity), hash(chordServer.IP, chordServer.Capacity)) {
-		fmt.Printf("Attempted to register Key %s with node %s, but doesn't belong here.\n", key, chordServer.IP)
-		return
+	chordServer.setMaintenancePaused(true)
+	chordServer.transfers.Add(1)
+	defer chordServer.transfers.Add(-1)
+
+	chordServer.FingerMuxs[0].RLock()
+	successor := chordServer.FingerTable[0]
+	chordServer.FingerMuxs[0].RUnlock()
+
+	if successor.Ip != chordServer.IP {
+		// Direct writes wait for the transfer, then go to the successor.
+		chordServer.handoffMux.Lock()
+		defer chordServer.handoffMux.Unlock()
+		handoff := chordServer.beginHandoff(chordServer.Hash, chordServer.Hash, successor.Ip)
+
+		transferStart := time.Now()
+		transferData, err := chordServer.KVStore.GetValuesForTransfer(chordServer.Hash, chordServer.Hash)
+
+		if err != nil {
+			chordServer.endHandoff(handoff, false, false)
+			chordServer.abortLeave()
+			return err
+		}
+
+		_, err = successor.DataClient.TransferData(context.Background(), transferData)
+
+		if err != nil {
+			chordServer.endHandoff(handoff, false, false)
+			chordServer.abortLeave()
+			return err
+		}
+
+		chordServer.endHandoff(handoff, true, true)
+		chordServer.advanceEpoch()
+		metrics.ObserveTransfer("out", len(transferData.Kvmap), proto.Size(transferData), transferStart)
+	}
+
+	logger.Info("Left the chord ring, handing keys to successor", "peer", successor.Ip)
+
+	if err := chordServer.KVStore.Store.Close(); err != nil {
+		logger.Error("Closing store failed", "err", err)
+	}
+
+	if chordServer.grpcServer != nil {
+		go chordServer.grpcServer.GracefulStop()
 	}
 
-	chordServer.keyIndex.Insert(key, hash(key, chordServer.Capacity))
-	log.Printf("[INFO] Post-Insert %s", key)
-	chordServer.keyIndex.Visualize()
+	return nil
 }
 
-func (chordServer *ChordServer) RegisterDelete(key string) {
-	if chordServer.Predecessor != nil && !isBetween(hash(key, chordServer.Capacity), hash(chordServer.Predecessor.Ip, chordServer.Capacity), hash(chordServer.IP, chordServer.Capacity)) {
-		fmt.Printf("Attempted to register delete key %s at node %s, but doesn't belong here.\n", key, chordServer.IP)
+func (chordServer *ChordServer) abortLeave() {
+	chordServer.setMaintenancePaused(false)
+	chordServer.leaving.Store(false)
+
+	if chordServer.healthServer != nil {
+		chordServer.healthServer.Resume()
+	}
+}
+
+// Remove a failed peer from the routing state: the predecessor is cleared and each finger pointing
+// at the peer is replaced by the next live node known for that finger (ultimately ourselves).
+func (chordServer *ChordServer) EvictPeer(ip string) {
+	if ip == chordServer.IP {
 		return
 	}
 
-	chordServer.keyIndex.Delete(key, hash(key, chordServer.Capacity))
+	chordServer.PredecessorMux.Lock()
+	if chordServer.Predecessor != nil && chordServer.Predecessor.Ip == ip {
+		logger.Info("Evicted predecessor", "peer", ip)
+		chordServer.Predecessor = nil
+		chordServer.advanceEpoch()
+		metrics.PredecessorChanges.Inc()
+		go chordServer.reconfigureChains()
+	}
+	chordServer.PredecessorMux.Unlock()
+
+	for finger := int(chordServer.Capacity) - 1; finger >= 0; finger-- {
+		chordServer.FingerMuxs[finger].RLock()
+		evicted := chordServer.FingerTable[finger] != nil && chordServer.FingerTable[finger].Ip == ip
+		chordServer.FingerMuxs[finger].RUnlock()
 
-	log.Printf("[INFO] Post-Delete %s", key)
-	chordServer.keyIndex.Visualize()
+		if !evicted {
+			continue
+		}
+
+		replacementIP := chordServer.IP
+
+		if chordServer.Membership != nil {
+			fingerStart := (chordServer.Hash + 1<<finger) % (1 << chordServer.Capacity)
+			if successorIP, ok := chordServer.Membership.Successor(fingerStart); ok {
+				replacementIP = successorIP
+			}
+		} else if finger+1 < int(chordServer.Capacity) {
+			chordServer.FingerMuxs[finger+1].RLock()
+			if chordServer.FingerTable[finger+1] != nil && chordServer.FingerTable[finger+1].Ip != ip {
+				replacementIP = chordServer.FingerTable[finger+1].Ip
+			}
+			chordServer.FingerMuxs[finger+1].RUnlock()
+		}
+
+		replacement, err := Connect(replacementIP)
+		if err != nil {
+			logger.Warn("Unable to connect to replacement for evicted finger", "finger", finger, "peer", replacementIP, "err", err)
+			continue
+		}
+
+		chordServer.FingerMuxs[finger].Lock()
+		chordServer.FingerTable[finger] = replacement
+		chordServer.FingerMuxs[finger].Unlock()
+
+		logger.Info("Replaced evicted finger", "finger", finger, "evicted", ip, "peer", replacementIP)
+	}
 }
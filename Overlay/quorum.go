@@ -0,0 +1,514 @@
+package overlay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"github.com/gorilla/mux"
+)
+
+// Tunable consistency: a /data/{key} request carrying a Consistency or Replicas header is coordinated
+// by the node it reaches instead of being served from its local store. The coordinator sends it to the
+// key's preference list (the owner followed by its successors, N distinct nodes) and answers once R
+// nodes (reads) or W nodes (writes) have replied. Reads return the newest version among the replies,
+// and replicas that returned an older version, or none, are repaired in the background.
+
+const ConsistencyHeader string = "Consistency"
+const ReplicasHeader string = "Replicas"
+
+const (
+	ConsistencyOne    string = "ONE"
+	ConsistencyQuorum string = "QUORUM"
+	ConsistencyAll    string = "ALL"
+)
+
+const DefaultReplicas int = 3
+
+// The owner and every entry of its successor list.
+const MaxReplicas int = SuccessorListSize + 1
+
+const replicaTimeout time.Duration = 2 * time.Second
+
+var errQuorumNotReached = errors.New("not enough replicas replied")
+
+func (chordServer *ChordServer) SetReplicas(replicas int) error {
+	if replicas < 1 || replicas > MaxReplicas {
+		return fmt.Errorf("replicas must be between 1 and %d", MaxReplicas)
+	}
+
+	chordServer.replicas = replicas
+	return nil
+}
+
+// N and the consistency level of a request, and whether it asked for coordination at all.
+func (chordServer *ChordServer) requestConsistency(r *http.Request) (int, string, bool, error) {
+	level := strings.ToUpper(r.Header.Get(ConsistencyHeader))
+	replicasHeader := r.Header.Get(ReplicasHeader)
+
+	if level == "" && replicasHeader == "" {
+		return 0, "", false, nil
+	}
+
+	replicas := chordServer.replicas
+	if replicasHeader != "" {
+		var err error
+		replicas, err = strconv.Atoi(replicasHeader)
+		if err != nil || replicas < 1 || replicas > MaxReplicas {
+			return 0, "", true, fmt.Errorf("%s must be between 1 and %d", ReplicasHeader, MaxReplicas)
+		}
+	}
+
+	switch level {
+	case "":
+		level = ConsistencyQuorum
+	case ConsistencyOne, ConsistencyQuorum, ConsistencyAll:
+	default:
+		return 0, "", true, fmt.Errorf("%s must be %s, %s or %s", ConsistencyHeader, ConsistencyOne, ConsistencyQuorum, ConsistencyAll)
+	}
+
+	return replicas, level, true, nil
+}
+
+// Replies needed at a consistency level from a preference list of n nodes. N is capped at the
+// number of nodes in the ring, so QUORUM and ALL are relative to the nodes that exist.
+func requiredReplies(level string, n int) int {
+	switch level {
+	case ConsistencyOne:
+		return 1
+	case ConsistencyAll:
+		return n
+	default:
+		return n/2 + 1
+	}
+}
+
+// The nodes holding a key's replicas: its owner followed by the owner's successors, at most n distinct nodes.
+func (chordServer *ChordServer) preferenceList(ctx context.Context, key string, n int) ([]string, error) {
+	ipMsg, err := chordServer.lookup(ctx, hash(key, chordServer.Capacity))
+	if err != nil {
+		return nil, err
+	}
+
+	owner := ipMsg.Ip.Value
+
+	var successors []string
+	if owner == chordServer.IP {
+		successors = chordServer.Successors()
+	} else {
+		info, err := chordServer.remoteNodeInfo(ctx, owner)
+		if err != nil {
+			// Writes to the owner become hints; the rest of the list is found past it.
+			logger.Warn("Key owner unreachable, building preference list from its successors", "key", key, "peer", owner, "err", err)
+			successors = chordServer.successorsOf(ctx, owner)
+		} else {
+			successors = info.Successors
+		}
+	}
+
+	return replicaSet(owner, successors, n), nil
+}
+
+// A node followed by its successors, at most n distinct nodes.
+func replicaSet(owner string, successors []string, n int) []string {
+	replicas := []string{owner}
+	for _, ip := range successors {
+		if len(replicas) == n {
+			break
+		}
+		if ip != "" && !slices.Contains(replicas, ip) {
+			replicas = append(replicas, ip)
+		}
+	}
+
+	return replicas
+}
+
+type replicaReply struct {
+	ip string
+	// Set by reads; nil if the replica does not hold the key.
+	value *pb.Value
+	// Set by writes.
+	result *pb.WriteResult
+	// The write was kept as a hint for the replica.
+	hinted bool
+	err    error
+}
+
+// Call every node of a preference list in parallel. Calls outlive the request that started them (so that
+// late replicas still apply writes and can be repaired); the channel is closed once all have replied.
+func (chordServer *ChordServer) callReplicas(ctx context.Context, preferences []string, call func(ctx context.Context, ip string) replicaReply) <-chan replicaReply {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), replicaTimeout)
+	replies := make(chan replicaReply, len(preferences))
+
+	var wg sync.WaitGroup
+	for _, ip := range preferences {
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+
+			reply := call(ctx, ip)
+			reply.ip = ip
+			replies <- reply
+		}(ip)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(replies)
+	}()
+
+	return replies
+}
+
+// Collect replies until required of them succeeded or too many failed for that to happen.
+func awaitReplicas(replies <-chan replicaReply, required int, total int) ([]replicaReply, error) {
+	var acked []replicaReply
+	var failures []string
+
+	for reply := range replies {
+		if reply.err != nil {
+			logger.Warn("Replica request failed", "peer", reply.ip, "err", reply.err)
+			failures = append(failures, reply.ip+": "+reply.err.Error())
+		} else {
+			acked = append(acked, reply)
+		}
+
+		if len(acked) == required || total-len(failures) < required {
+			break
+		}
+	}
+
+	if len(acked) < required {
+		metrics.QuorumFailures.Inc()
+		return acked, fmt.Errorf("%w: %d of %d required (%s)", errQuorumNotReached, len(acked), required, strings.Join(failures, "; "))
+	}
+
+	return acked, nil
+}
+
+func (chordServer *ChordServer) replicaGet(ctx context.Context, ip string, key string) replicaReply {
+	keys := &pb.Keys{Keys: []string{key}, Tombstones: true}
+
+	if ip == chordServer.IP {
+		return replicaReply{value: chordServer.KVStore.GetValues(keys.Keys, keys.Tombstones).Kvmap[key]}
+	}
+
+	node, err := Connect(ip)
+	if err != nil {
+		return replicaReply{err: err}
+	}
+	defer node.Close()
+
+	kvMap, err := node.DataClient.GetValues(ctx, keys)
+	if err != nil {
+		return replicaReply{err: err}
+	}
+
+	return replicaReply{value: kvMap.Kvmap[key]}
+}
+
+func (chordServer *ChordServer) replicaWrite(ctx context.Context, ip string, mutation *pb.Mutation) replicaReply {
+	mutations := &pb.Mutations{Mutations: []*pb.Mutation{mutation}}
+
+	var writeResults *pb.WriteResults
+	if ip == chordServer.IP {
+		writeResults = chordServer.KVStore.Replicate(mutations)
+	} else {
+		node, err := Connect(ip)
+		if err != nil {
+			return replicaReply{err: err}
+		}
+		defer node.Close()
+
+		writeResults, err = node.DataClient.Replicate(ctx, mutations)
+		if err != nil {
+			return replicaReply{err: err}
+		}
+	}
+
+	result, found := writeResults.Results[mutation.Key]
+	if !found {
+		return replicaReply{err: errors.New("no result from replica")}
+	}
+	if result.Error != "" {
+		return replicaReply{err: errors.New(result.Error)}
+	}
+
+	return replicaReply{result: result}
+}
+
+// Read a key from R of its preference list, returning the newest version (nil if none holds the key, a
+// tombstone if it was deleted).
+func (chordServer *ChordServer) quorumGet(ctx context.Context, key string, preferences []string, required int) (*pb.Value, error) {
+	replies := chordServer.callReplicas(ctx, preferences, func(ctx context.Context, ip string) replicaReply {
+		return chordServer.replicaGet(ctx, ip, key)
+	})
+
+	acked, err := awaitReplicas(replies, required, len(preferences))
+	if err != nil {
+		return nil, err
+	}
+
+	go chordServer.readRepair(key, acked, replies)
+
+	return newestValue(acked), nil
+}
+
+func newestValue(replies []replicaReply) *pb.Value {
+	var newest *pb.Value
+	for _, reply := range replies {
+		if reply.value != nil && (newest == nil || reply.value.Version > newest.Version) {
+			newest = reply.value
+		}
+	}
+	return newest
+}
+
+// Once every replica has answered a read, send the newest version (or tombstone) to those that returned an
+// older one or none.
+func (chordServer *ChordServer) readRepair(key string, acked []replicaReply, replies <-chan replicaReply) {
+	for reply := range replies {
+		if reply.err == nil {
+			acked = append(acked, reply)
+		}
+	}
+
+	newest := newestValue(acked)
+	if newest == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+
+	for _, reply := range acked {
+		if reply.value != nil && reply.value.Version >= newest.Version {
+			continue
+		}
+
+		logger.Debug("Repairing stale replica", "key", key, "peer", reply.ip, "version", newest.Version)
+		repair := chordServer.replicaWrite(ctx, reply.ip, &pb.Mutation{Key: key, Value: newest})
+		if repair.err != nil {
+			logger.Warn("Read repair failed", "key", key, "peer", reply.ip, "err", repair.err)
+			continue
+		}
+		metrics.ReadRepairs.Inc()
+	}
+}
+
+// Write (or, with a nil value, delete by a tombstone) a key on W of its preference list under a new version. A precondition
+// is checked against a read at the same level. Writes to unreachable replicas are kept as hints, which count
+// towards W when sloppy is set. Reports whether the key existed on any replica that acknowledged.
+func (chordServer *ChordServer) quorumWrite(ctx context.Context, key string, value *data.Value, precondition data.Precondition, preferences []string, required int, sloppy bool) (uint64, bool, error) {
+	var currentVersion uint64
+
+	if precondition != nil {
+		current, err := chordServer.quorumGet(ctx, key, preferences, required)
+		if err != nil {
+			return 0, false, err
+		}
+
+		currentValue := data.Value{}
+		if current != nil {
+			currentValue = *data.ValueFromProto(current)
+			currentVersion = current.Version
+		}
+
+		live := current != nil && !current.Deleted
+		if !live {
+			currentValue = data.Value{}
+		}
+
+		if !precondition(currentValue, live) {
+			return 0, live, data.ErrPreconditionFailed
+		}
+	}
+
+	if value == nil {
+		value = &data.Value{Deleted: true}
+	}
+	value.Version = data.NextVersion(currentVersion)
+	version := value.Version
+	mutation := &pb.Mutation{Key: key, Value: value.ToProto()}
+
+	replies := chordServer.callReplicas(ctx, preferences, func(ctx context.Context, ip string) replicaReply {
+		reply := chordServer.replicaWrite(ctx, ip, mutation)
+		if reply.err != nil && unreachable(reply.err) && chordServer.storeHint(ip, mutation) && sloppy {
+			return replicaReply{result: &pb.WriteResult{Version: version, Created: true}, hinted: true}
+		}
+		return reply
+	})
+
+	acked, err := awaitReplicas(replies, required, len(preferences))
+	if err != nil {
+		return 0, false, err
+	}
+
+	found := false
+	for _, reply := range acked {
+		found = found || !reply.result.Created
+
+		if reply.result.Version > version {
+			logger.Debug("Replica holds a newer version than the write", "key", key, "peer", reply.ip, "version", reply.result.Version)
+		}
+	}
+
+	return version, found, nil
+}
+
+// Data HTTP endpoints: chain-replicated keys go through their chain; other requests are coordinated when
+// they ask for a consistency level, and served locally otherwise.
+
+func (chordServer *ChordServer) ServeGet(w http.ResponseWriter, r *http.Request) {
+	if key, chained := chainKey(r, chordServer.replication); chained {
+		chordServer.serveChainGet(w, r, key)
+		return
+	}
+
+	request, local := chordServer.coordinate(w, r)
+	if local {
+		chordServer.KVStore.GetValue(w, r)
+		return
+	}
+	if request == nil {
+		return
+	}
+
+	value, err := chordServer.quorumGet(r.Context(), request.key, request.preferences, request.required)
+	if err != nil {
+		writeQuorumError(w, err)
+		return
+	}
+
+	if value == nil || value.Deleted {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	data.WriteValue(w, r, *data.ValueFromProto(value))
+}
+
+func (chordServer *ChordServer) ServePut(w http.ResponseWriter, r *http.Request) {
+	if key, chained := chainKey(r, chordServer.replication); chained {
+		chordServer.serveChainWrite(w, r, key, false)
+		return
+	}
+
+	request, local := chordServer.coordinate(w, r)
+	if local {
+		chordServer.serveFenced(w, r, chordServer.KVStore.PutValue)
+		return
+	}
+	if request == nil {
+		return
+	}
+
+	value, err := data.RequestValue(r)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, found, err := chordServer.quorumWrite(r.Context(), request.key, &value, data.RequestPrecondition(r), request.preferences, request.required, request.sloppy)
+	if err != nil {
+		writeQuorumError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if found {
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("ETag", data.FormatETag(version))
+	w.WriteHeader(status)
+	w.Write(([]byte)(http.StatusText(status)))
+}
+
+func (chordServer *ChordServer) ServeDelete(w http.ResponseWriter, r *http.Request) {
+	if key, chained := chainKey(r, chordServer.replication); chained {
+		chordServer.serveChainWrite(w, r, key, true)
+		return
+	}
+
+	request, local := chordServer.coordinate(w, r)
+	if local {
+		chordServer.serveFenced(w, r, chordServer.KVStore.DeleteKV)
+		return
+	}
+	if request == nil {
+		return
+	}
+
+	_, found, err := chordServer.quorumWrite(r.Context(), request.key, nil, data.RequestPrecondition(r), request.preferences, request.required, request.sloppy)
+	if err != nil {
+		writeQuorumError(w, err)
+		return
+	}
+
+	if !found {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(([]byte)(http.StatusText(http.StatusOK)))
+}
+
+type coordinatedRequest struct {
+	key         string
+	preferences []string
+	required    int
+	// Hints count towards W.
+	sloppy bool
+}
+
+// Resolve a request's key, preference list and required replies. local is set for requests without
+// consistency headers; a nil request otherwise means an error response has been written.
+func (chordServer *ChordServer) coordinate(w http.ResponseWriter, r *http.Request) (*coordinatedRequest, bool) {
+	n, level, coordinated, err := chordServer.requestConsistency(r)
+	if !coordinated {
+		return nil, true
+	}
+
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	key := mux.Vars(r)["key"]
+	if key == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": No key provided.", http.StatusBadRequest)
+		return nil, false
+	}
+
+	preferences, err := chordServer.preferenceList(r.Context(), key, n)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway)+": "+err.Error(), http.StatusBadGateway)
+		return nil, false
+	}
+
+	return &coordinatedRequest{key: key, preferences: preferences, required: requiredReplies(level, len(preferences)), sloppy: level != ConsistencyAll}, false
+}
+
+func writeQuorumError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, data.ErrPreconditionFailed):
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	case errors.Is(err, errQuorumNotReached):
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable)+": "+err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, http.StatusText(http.StatusBadGateway)+": "+err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,129 @@
+package overlay
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReplicaSet(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		successors []string
+		n          int
+		replicas   []string
+	}{
+		{"owner only", []string{"b", "c"}, 1, []string{"a"}},
+		{"capped at n", []string{"b", "c", "d"}, 3, []string{"a", "b", "c"}},
+		{"fewer nodes than n", []string{"b"}, 3, []string{"a", "b"}},
+		// A small ring's successor list wraps around to the owner and repeats nodes.
+		{"distinct nodes", []string{"b", "a", "b"}, 3, []string{"a", "b"}},
+		{"empty entries skipped", []string{"", "b", ""}, 3, []string{"a", "b"}},
+		{"no successors", nil, 3, []string{"a"}},
+	} {
+		if replicas := replicaSet("a", test.successors, test.n); !slices.Equal(replicas, test.replicas) {
+			t.Errorf("%s: replicaSet(a, %v, %d) = %v, want %v", test.name, test.successors, test.n, replicas, test.replicas)
+		}
+	}
+}
+
+func TestRequiredReplies(t *testing.T) {
+	for _, test := range []struct {
+		level    string
+		n        int
+		required int
+	}{
+		{ConsistencyOne, 3, 1},
+		{ConsistencyQuorum, 1, 1},
+		{ConsistencyQuorum, 2, 2},
+		{ConsistencyQuorum, 3, 2},
+		{ConsistencyQuorum, 4, 3},
+		{ConsistencyAll, 3, 3},
+	} {
+		if required := requiredReplies(test.level, test.n); required != test.required {
+			t.Errorf("requiredReplies(%s, %d) = %d, want %d", test.level, test.n, required, test.required)
+		}
+	}
+}
+
+// A channel holding replies, closed like the one from callReplicas.
+func repliesOf(replies ...replicaReply) <-chan replicaReply {
+	channel := make(chan replicaReply, len(replies))
+	for _, reply := range replies {
+		channel <- reply
+	}
+	close(channel)
+	return channel
+}
+
+func TestAwaitReplicas(t *testing.T) {
+	failed := replicaReply{ip: "b", err: errors.New("unreachable")}
+
+	for _, test := range []struct {
+		name     string
+		replies  []replicaReply
+		required int
+		acked    int
+		reached  bool
+	}{
+		{"quorum despite a failure", []replicaReply{{ip: "a"}, failed, {ip: "c"}}, 2, 2, true},
+		{"stops at the quorum", []replicaReply{{ip: "a"}, {ip: "b"}, {ip: "c"}}, 2, 2, true},
+		{"too many failures", []replicaReply{failed, failed, {ip: "c"}}, 2, 0, false},
+		{"all required", []replicaReply{{ip: "a"}, {ip: "b"}, failed}, 3, 2, false},
+	} {
+		acked, err := awaitReplicas(repliesOf(test.replies...), test.required, len(test.replies))
+		if reached := err == nil; reached != test.reached || (!test.reached && !errors.Is(err, errQuorumNotReached)) {
+			t.Errorf("%s: awaitReplicas returned %v, want quorum reached %v", test.name, err, test.reached)
+		}
+		if test.reached && len(acked) != test.acked {
+			t.Errorf("%s: %d replies acknowledged, want %d", test.name, len(acked), test.acked)
+		}
+	}
+}
+
+func TestNewestValue(t *testing.T) {
+	newest := newestValue([]replicaReply{
+		{ip: "a", value: &pb.Value{Version: 2}},
+		{ip: "b"},
+		{ip: "c", value: &pb.Value{Version: 5, Deleted: true}},
+		{ip: "d", value: &pb.Value{Version: 3}},
+	})
+	// A newer tombstone wins over older values.
+	if newest == nil || newest.Version != 5 || !newest.Deleted {
+		t.Fatalf("newest value is %v, want the tombstone at version 5", newest)
+	}
+
+	if newest := newestValue([]replicaReply{{ip: "a"}, {ip: "b"}}); newest != nil {
+		t.Fatalf("newest value is %v when no replica holds the key", newest)
+	}
+}
+
+func TestReadRepair(t *testing.T) {
+	chordServer := newTestServer(t)
+	putKeys(t, chordServer, "key")
+	stale, _ := chordServer.KVStore.Store.Entry("key")
+
+	repairs := testutil.ToFloat64(metrics.ReadRepairs)
+
+	// This node answered the read with its stale copy; a late replica holds a newer version.
+	newer := &pb.Value{Data: []byte("newer"), Version: stale.Version + 1}
+	chordServer.readRepair("key", []replicaReply{{ip: chordServer.IP, value: stale.ToProto()}}, repliesOf(replicaReply{ip: "10.0.0.9", value: newer}))
+
+	repaired, _ := chordServer.KVStore.Store.Entry("key")
+	if repaired.Version != newer.Version || string(repaired.Data) != "newer" {
+		t.Fatalf("stale replica holds version %d (%q), want %d", repaired.Version, repaired.Data, newer.Version)
+	}
+	if delta := testutil.ToFloat64(metrics.ReadRepairs) - repairs; delta != 1 {
+		t.Fatalf("%v read repairs counted, want 1", delta)
+	}
+
+	// Replicas already holding the newest version are left alone.
+	chordServer.readRepair("key", []replicaReply{{ip: chordServer.IP, value: newer}}, repliesOf())
+	if delta := testutil.ToFloat64(metrics.ReadRepairs) - repairs; delta != 1 {
+		t.Fatalf("%v read repairs counted after an up-to-date read, want 1", delta)
+	}
+}
@@ -0,0 +1,890 @@
+package overlay
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Redis front-end: an optional RESP listener serving GET, SET, DEL, EXISTS, MGET, MSET, EXPIRE, TTL, INCR
+// and SCAN through the KV service, so that Redis clients can use the ring. A command for a key owned by
+// another node is forwarded to the owner's KV service, or in cluster mode answered with
+// "MOVED <key hash> <owner>:<port>" for the client to follow, as redis-cli -c does.
+//
+// Multi-key commands are not atomic, and in cluster mode every key must be owned by the node they are sent
+// to. SCAN walks the whole ring from any node, and its cursor is the ring position to resume at: pages end
+// on a hash boundary, so a key may be returned twice but is never skipped.
+
+type RESPOptions struct {
+	// Port of the listener; 0 disables it.
+	Port int
+	// Answer commands for other nodes' keys with MOVED redirects instead of forwarding them.
+	Cluster bool
+}
+
+func (chordServer *ChordServer) SetRESP(options RESPOptions) {
+	chordServer.resp = options
+}
+
+// Attempts of a read-modify-write command (SET XX, EXPIRE, INCR) on a key written concurrently.
+const respCASAttempts int = 16
+
+const defaultRESPScanCount int = 10
+
+type respCommand struct {
+	// Number of arguments including the command name, as in Redis: -n for at least n.
+	arity int
+	serve func(session *respSession, ctx context.Context, args [][]byte) error
+}
+
+var respCommands = map[string]respCommand{
+	"PING":   {-1, (*respSession).ping},
+	"GET":    {2, (*respSession).get},
+	"SET":    {-3, (*respSession).set},
+	"DEL":    {-2, (*respSession).del},
+	"EXISTS": {-2, (*respSession).exists},
+	"MGET":   {-2, (*respSession).mget},
+	"MSET":   {-3, (*respSession).mset},
+	"EXPIRE": {3, (*respSession).expire},
+	"TTL":    {2, (*respSession).ttl},
+	"INCR":   {2, (*respSession).incr},
+	"SCAN":   {-2, (*respSession).scan},
+}
+
+// A complete error reply, e.g. "ERR syntax error".
+type respError string
+
+func (err respError) Error() string {
+	return string(err)
+}
+
+const (
+	errRESPSyntax     respError = "ERR syntax error"
+	errRESPNotInteger respError = "ERR value is not an integer or out of range"
+	errRESPContended  respError = "ERR key was modified concurrently, try again"
+)
+
+type movedError struct {
+	keyHash uint64
+	owner   string
+	port    int
+}
+
+func (err *movedError) Error() string {
+	return fmt.Sprintf("MOVED %d %s:%d", err.keyHash, err.owner, err.port)
+}
+
+// Listen for Redis clients on the RESP port.
+func (chordServer *ChordServer) ServeRESP() {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", chordServer.resp.Port))
+	if err != nil {
+		logger.Error("RESP listener failed", "port", chordServer.resp.Port, "err", err)
+		return
+	}
+
+	logger.Info("Serving Redis protocol", "port", chordServer.resp.Port, "cluster", chordServer.resp.Cluster)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logger.Error("RESP listener stopped", "err", err)
+			return
+		}
+
+		go chordServer.serveRESPConn(conn)
+	}
+}
+
+type respSession struct {
+	chordServer *ChordServer
+	kv          *kvService
+	writer      respWriter
+}
+
+// Serve a connection's commands in order. Replies are flushed once no pipelined command is waiting.
+func (chordServer *ChordServer) serveRESPConn(conn net.Conn) {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := bufio.NewReader(conn)
+	session := &respSession{chordServer: chordServer, kv: &kvService{chordServer: chordServer}, writer: respWriter{bufio.NewWriter(conn)}}
+
+	for {
+		args, err := readCommand(reader)
+		if errors.Is(err, errProtocol) {
+			session.writer.error("ERR " + err.Error())
+			session.writer.Flush()
+			return
+		}
+		if err != nil {
+			logger.Debug("RESP connection closed", "peer", conn.RemoteAddr().String(), "err", err)
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if !session.dispatch(ctx, args) {
+			session.writer.Flush()
+			return
+		}
+
+		if reader.Buffered() == 0 {
+			if err := session.writer.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Serve one command, returning false once the client has quit.
+func (session *respSession) dispatch(ctx context.Context, args [][]byte) bool {
+	name := strings.ToUpper(string(args[0]))
+	if name == "QUIT" {
+		session.writer.simple("OK")
+		return false
+	}
+
+	command, found := respCommands[name]
+	if !found {
+		session.writer.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		metrics.RESPCommands.WithLabelValues("unknown", "error").Inc()
+		return true
+	}
+
+	label := strings.ToLower(name)
+	if command.arity > 0 && len(args) != command.arity || command.arity < 0 && len(args) < -command.arity {
+		session.writer.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", label))
+		metrics.RESPCommands.WithLabelValues(label, "error").Inc()
+		return true
+	}
+
+	err := command.serve(session, ctx, args[1:])
+
+	var moved *movedError
+	var reply respError
+	switch {
+	case err == nil:
+		metrics.RESPCommands.WithLabelValues(label, "ok").Inc()
+		return true
+	case errors.As(err, &moved):
+		session.writer.error(moved.Error())
+		metrics.RESPCommands.WithLabelValues(label, "moved").Inc()
+		return true
+	case errors.As(err, &reply):
+		session.writer.error(reply.Error())
+	default:
+		logger.Debug("RESP command failed", "command", label, "err", err)
+		session.writer.error("ERR " + status.Convert(err).Message())
+	}
+
+	metrics.RESPCommands.WithLabelValues(label, "error").Inc()
+	return true
+}
+
+// Routing
+
+// In cluster mode, a MOVED redirect for the first of keys this node does not own.
+func (session *respSession) checkOwnership(ctx context.Context, keys ...string) error {
+	chordServer := session.chordServer
+	if !chordServer.resp.Cluster {
+		return nil
+	}
+
+	for _, key := range keys {
+		keyHash := hash(key, chordServer.Capacity)
+		if chordServer.ownsHash(keyHash) {
+			continue
+		}
+
+		ipMsg, err := chordServer.lookup(ctx, keyHash)
+		if err != nil {
+			return err
+		}
+		if ipMsg.Ip.Value != chordServer.IP {
+			return &movedError{keyHash: keyHash, owner: ipMsg.Ip.Value, port: chordServer.resp.Port}
+		}
+	}
+
+	return nil
+}
+
+// Run call against the KV service owning key: this node's, then that of each owner its hints name.
+// In cluster mode a hint is answered with MOVED instead.
+func (session *respSession) call(ctx context.Context, key string, call func(kv pb.KVClient) error) error {
+	chordServer := session.chordServer
+
+	var kv pb.KVClient = localKV{session.kv}
+	var owner *ChordNode
+	defer func() {
+		if owner != nil {
+			owner.Close()
+		}
+	}()
+
+	var err error
+	for attempt := 0; attempt < MaxRetries; attempt++ {
+		err = call(kv)
+
+		hint, redirected := OwnerFromError(err)
+		if !redirected {
+			return err
+		}
+
+		if chordServer.resp.Cluster {
+			return &movedError{keyHash: hash(key, chordServer.Capacity), owner: hint.Owner, port: chordServer.resp.Port}
+		}
+
+		logger.Debug("Forwarding RESP command to owner", "key", key, "peer", hint.Owner)
+		if owner != nil {
+			owner.Close()
+		}
+		owner, err = Connect(hint.Owner)
+		if err != nil {
+			return err
+		}
+		kv = owner.KVClient
+	}
+
+	return err
+}
+
+// The KV service of this node as a client, so that commands run the same way here as at another owner.
+type localKV struct {
+	kv *kvService
+}
+
+func (local localKV) Get(ctx context.Context, request *pb.KVKey, _ ...grpc.CallOption) (*pb.Value, error) {
+	return local.kv.Get(ctx, request)
+}
+
+func (local localKV) Put(ctx context.Context, request *pb.KVPutRequest, _ ...grpc.CallOption) (*pb.WriteResult, error) {
+	return local.kv.Put(ctx, request)
+}
+
+func (local localKV) Delete(ctx context.Context, request *pb.KVDeleteRequest, _ ...grpc.CallOption) (*pb.WriteResult, error) {
+	return local.kv.Delete(ctx, request)
+}
+
+func (local localKV) BatchGet(ctx context.Context, request *pb.KVBatchGetRequest, _ ...grpc.CallOption) (*pb.KVBatchGetResponse, error) {
+	return local.kv.BatchGet(ctx, request)
+}
+
+func (local localKV) BatchPut(ctx context.Context, request *pb.KVBatchPutRequest, _ ...grpc.CallOption) (*pb.WriteResults, error) {
+	return local.kv.BatchPut(ctx, request)
+}
+
+func (local localKV) Scan(ctx context.Context, request *pb.KVScanRequest, _ ...grpc.CallOption) (*pb.KVScanResponse, error) {
+	return local.kv.Scan(ctx, request)
+}
+
+// The value of key, or nil if it does not exist.
+func (session *respSession) value(ctx context.Context, key string) (*pb.Value, error) {
+	var value *pb.Value
+	err := session.call(ctx, key, func(kv pb.KVClient) error {
+		var err error
+		value, err = kv.Get(ctx, &pb.KVKey{Key: key})
+		return err
+	})
+
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	return value, err
+}
+
+func (session *respSession) put(ctx context.Context, request *pb.KVPutRequest) error {
+	return session.call(ctx, request.Key, func(kv pb.KVClient) error {
+		_, err := kv.Put(ctx, request)
+		return err
+	})
+}
+
+// Delete key, returning whether it existed.
+func (session *respSession) remove(ctx context.Context, key string) (bool, error) {
+	err := session.call(ctx, key, func(kv pb.KVClient) error {
+		_, err := kv.Delete(ctx, &pb.KVDeleteRequest{Key: key})
+		return err
+	})
+
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Write the value update makes of key's current value (nil if the key does not exist), provided the key
+// is unchanged in between. update returns a nil request to leave the key as it is.
+func (session *respSession) update(ctx context.Context, key string, update func(current *pb.Value) (*pb.KVPutRequest, error)) error {
+	for attempt := 0; attempt < respCASAttempts; attempt++ {
+		current, err := session.value(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		request, err := update(current)
+		if err != nil || request == nil {
+			return err
+		}
+
+		request.Key = key
+		if current == nil {
+			request.IfAbsent = true
+		} else {
+			request.IfVersion = current.Version
+		}
+
+		err = session.put(ctx, request)
+		if status.Code(err) != codes.FailedPrecondition {
+			return err
+		}
+	}
+
+	return errRESPContended
+}
+
+// The values of keys, read from their owners in one batch.
+func (session *respSession) values(ctx context.Context, keys []string) (map[string]*pb.Value, error) {
+	response, err := session.kv.BatchGet(ctx, &pb.KVBatchGetRequest{Keys: keys})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, failure := range response.Errors {
+		return nil, fmt.Errorf("%s: %s", key, failure)
+	}
+	return response.Values, nil
+}
+
+// The remaining time to live of a value, or 0 if it does not expire.
+func remainingTTL(value *pb.Value) time.Duration {
+	if value.ExpiresAt == 0 {
+		return 0
+	}
+	return time.Until(time.Unix(0, value.ExpiresAt))
+}
+
+func respKeys(args [][]byte) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys
+}
+
+// Commands
+
+func (session *respSession) ping(ctx context.Context, args [][]byte) error {
+	switch len(args) {
+	case 0:
+		session.writer.simple("PONG")
+	case 1:
+		session.writer.bulk(args[0])
+	default:
+		return respError("ERR wrong number of arguments for 'ping' command")
+	}
+	return nil
+}
+
+// GET key
+func (session *respSession) get(ctx context.Context, args [][]byte) error {
+	key := string(args[0])
+	if err := session.checkOwnership(ctx, key); err != nil {
+		return err
+	}
+
+	value, err := session.value(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		session.writer.null()
+		return nil
+	}
+	session.writer.bulk(value.Data)
+	return nil
+}
+
+// SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (session *respSession) set(ctx context.Context, args [][]byte) error {
+	key := string(args[0])
+	request := &pb.KVPutRequest{Key: key, Data: args[1]}
+
+	var ttl time.Duration
+	var xx bool
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); option {
+		case "NX":
+			if xx {
+				return errRESPSyntax
+			}
+			request.IfAbsent = true
+		case "XX":
+			if request.IfAbsent {
+				return errRESPSyntax
+			}
+			xx = true
+		case "EX", "PX":
+			if ttl != 0 || i+1 == len(args) {
+				return errRESPSyntax
+			}
+			i++
+
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return errRESPNotInteger
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				return respError("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * unit
+		default:
+			return errRESPSyntax
+		}
+	}
+
+	if ttl > 0 {
+		request.Ttl = durationpb.New(ttl)
+	}
+
+	if err := session.checkOwnership(ctx, key); err != nil {
+		return err
+	}
+
+	if xx {
+		var exists bool
+		err := session.update(ctx, key, func(current *pb.Value) (*pb.KVPutRequest, error) {
+			exists = current != nil
+			if !exists {
+				return nil, nil
+			}
+			return request, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			session.writer.null()
+			return nil
+		}
+		session.writer.simple("OK")
+		return nil
+	}
+
+	err := session.put(ctx, request)
+	if request.IfAbsent && status.Code(err) == codes.FailedPrecondition {
+		session.writer.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	session.writer.simple("OK")
+	return nil
+}
+
+// DEL key [key ...]
+func (session *respSession) del(ctx context.Context, args [][]byte) error {
+	keys := respKeys(args)
+	if err := session.checkOwnership(ctx, keys...); err != nil {
+		return err
+	}
+
+	var deleted int64
+	for _, key := range keys {
+		found, err := session.remove(ctx, key)
+		if err != nil {
+			return err
+		}
+		if found {
+			deleted++
+		}
+	}
+
+	session.writer.integer(deleted)
+	return nil
+}
+
+// EXISTS key [key ...]: a key given more than once is counted each time.
+func (session *respSession) exists(ctx context.Context, args [][]byte) error {
+	keys := respKeys(args)
+	if err := session.checkOwnership(ctx, keys...); err != nil {
+		return err
+	}
+
+	values, err := session.values(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	for _, key := range keys {
+		if values[key] != nil {
+			count++
+		}
+	}
+
+	session.writer.integer(count)
+	return nil
+}
+
+// MGET key [key ...]
+func (session *respSession) mget(ctx context.Context, args [][]byte) error {
+	keys := respKeys(args)
+	if err := session.checkOwnership(ctx, keys...); err != nil {
+		return err
+	}
+
+	values, err := session.values(ctx, keys)
+	if err != nil {
+		return err
+	}
+
+	session.writer.array(len(keys))
+	for _, key := range keys {
+		if value := values[key]; value != nil {
+			session.writer.bulk(value.Data)
+		} else {
+			session.writer.null()
+		}
+	}
+	return nil
+}
+
+// MSET key value [key value ...]
+func (session *respSession) mset(ctx context.Context, args [][]byte) error {
+	if len(args)%2 != 0 {
+		return respError("ERR wrong number of arguments for 'mset' command")
+	}
+
+	request := &pb.KVBatchPutRequest{Values: make(map[string]*pb.Value)}
+	var keys []string
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+		request.Values[string(args[i])] = &pb.Value{Data: args[i+1]}
+	}
+
+	if err := session.checkOwnership(ctx, keys...); err != nil {
+		return err
+	}
+
+	results, err := session.kv.BatchPut(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	for key, result := range results.Results {
+		if result.Error != "" {
+			return fmt.Errorf("%s: %s", key, result.Error)
+		}
+	}
+
+	session.writer.simple("OK")
+	return nil
+}
+
+// EXPIRE key seconds: a time that is not positive deletes the key.
+func (session *respSession) expire(ctx context.Context, args [][]byte) error {
+	key := string(args[0])
+
+	seconds, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return errRESPNotInteger
+	}
+	if seconds > math.MaxInt64/int64(time.Second) {
+		return respError("ERR invalid expire time in 'expire' command")
+	}
+
+	if err := session.checkOwnership(ctx, key); err != nil {
+		return err
+	}
+
+	if seconds <= 0 {
+		found, err := session.remove(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			session.writer.integer(1)
+		} else {
+			session.writer.integer(0)
+		}
+		return nil
+	}
+
+	var exists bool
+	err = session.update(ctx, key, func(current *pb.Value) (*pb.KVPutRequest, error) {
+		exists = current != nil
+		if !exists {
+			return nil, nil
+		}
+		return &pb.KVPutRequest{Data: current.Data, ContentType: current.ContentType, Ttl: durationpb.New(time.Duration(seconds) * time.Second)}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		session.writer.integer(1)
+	} else {
+		session.writer.integer(0)
+	}
+	return nil
+}
+
+// TTL key: -2 if the key does not exist, -1 if it does not expire.
+func (session *respSession) ttl(ctx context.Context, args [][]byte) error {
+	key := string(args[0])
+	if err := session.checkOwnership(ctx, key); err != nil {
+		return err
+	}
+
+	value, err := session.value(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case value == nil:
+		session.writer.integer(-2)
+	case value.ExpiresAt == 0:
+		session.writer.integer(-1)
+	default:
+		remaining := max(remainingTTL(value), 0)
+		session.writer.integer(int64((remaining + time.Second/2) / time.Second))
+	}
+	return nil
+}
+
+// INCR key: a missing key counts from 0, and the key keeps its time to live.
+func (session *respSession) incr(ctx context.Context, args [][]byte) error {
+	key := string(args[0])
+	if err := session.checkOwnership(ctx, key); err != nil {
+		return err
+	}
+
+	var result int64
+	err := session.update(ctx, key, func(current *pb.Value) (*pb.KVPutRequest, error) {
+		request := &pb.KVPutRequest{}
+
+		var n int64
+		if current != nil {
+			var err error
+			n, err = strconv.ParseInt(string(current.Data), 10, 64)
+			if err != nil {
+				return nil, errRESPNotInteger
+			}
+
+			request.ContentType = current.ContentType
+			if ttl := remainingTTL(current); ttl > 0 {
+				request.Ttl = durationpb.New(ttl)
+			}
+		}
+
+		if n == math.MaxInt64 {
+			return nil, respError("ERR increment or decrement would overflow")
+		}
+
+		result = n + 1
+		request.Data = []byte(strconv.FormatInt(result, 10))
+		return request, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	session.writer.integer(result)
+	return nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count]
+func (session *respSession) scan(ctx context.Context, args [][]byte) error {
+	chordServer := session.chordServer
+	top := uint64(1)<<chordServer.Capacity - 1
+
+	position, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil || position > top {
+		return respError("ERR invalid cursor")
+	}
+
+	pattern := "*"
+	count := defaultRESPScanCount
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errRESPSyntax
+		}
+
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return errRESPNotInteger
+			}
+			if count < 1 {
+				return errRESPSyntax
+			}
+			count = min(count, maxScanLimit)
+		default:
+			return errRESPSyntax
+		}
+	}
+
+	entries, cursor, err := chordServer.scanRing(ctx, encodeCursor(position, ""), count, false)
+	if err != nil {
+		return err
+	}
+
+	// Finish the last hash of the page, so that the next page can start at the following one.
+	next := uint64(0)
+	if cursor != "" {
+		lastHash, _, err := decodeCursor(cursor)
+		if err != nil {
+			return err
+		}
+		if lastHash < top {
+			next = lastHash + 1
+		}
+
+		for cursor != "" {
+			var more []*pb.ScanEntry
+			more, cursor, err = chordServer.scanRing(ctx, cursor, count, false)
+			if err != nil {
+				return err
+			}
+
+			finished := false
+			for _, entry := range more {
+				if entry.Hash != lastHash {
+					finished = true
+					break
+				}
+				entries = append(entries, entry)
+			}
+			if finished {
+				break
+			}
+		}
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if matchGlob(pattern, entry.Key) {
+			keys = append(keys, entry.Key)
+		}
+	}
+
+	session.writer.array(2)
+	session.writer.bulk([]byte(strconv.FormatUint(next, 10)))
+	session.writer.array(len(keys))
+	for _, key := range keys {
+		session.writer.bulk([]byte(key))
+	}
+	return nil
+}
+
+// Match a key against a Redis glob pattern: *, ?, character classes ([abc], [^a-z]) and \ escapes.
+func matchGlob(pattern string, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(key); i++ {
+				if matchGlob(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if key == "" {
+				return false
+			}
+		case '[':
+			if key == "" {
+				return false
+			}
+			length, matched := matchClass(pattern, key[0])
+			if !matched {
+				return false
+			}
+			pattern, key = pattern[length:], key[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if key == "" || pattern[0] != key[0] {
+				return false
+			}
+		}
+
+		pattern, key = pattern[1:], key[1:]
+	}
+
+	return key == ""
+}
+
+// Match c against the character class at the start of pattern, returning the class's length.
+func matchClass(pattern string, c byte) (int, bool) {
+	i := 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+
+	matched := false
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			matched = matched || pattern[i] == c
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			start, end := pattern[i], pattern[i+2]
+			if start > end {
+				start, end = end, start
+			}
+			matched = matched || start <= c && c <= end
+			i += 2
+		default:
+			matched = matched || pattern[i] == c
+		}
+	}
+
+	if i < len(pattern) {
+		i++
+	}
+	return i, matched != negate
+}
@@ -0,0 +1,170 @@
+package overlay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+)
+
+// A RESP session on a lone node, writing its replies to a buffer.
+func newTestSession(t *testing.T) (*respSession, *bytes.Buffer) {
+	t.Helper()
+
+	chordServer := newTestServer(t)
+	buffer := &bytes.Buffer{}
+	session := &respSession{chordServer: chordServer, kv: &kvService{chordServer: chordServer}, writer: respWriter{bufio.NewWriter(buffer)}}
+	return session, buffer
+}
+
+// Run a command and return its reply.
+func respRun(session *respSession, buffer *bytes.Buffer, args ...string) string {
+	command := make([][]byte, len(args))
+	for i, arg := range args {
+		command[i] = []byte(arg)
+	}
+
+	session.dispatch(context.Background(), command)
+	session.writer.Flush()
+
+	reply := buffer.String()
+	buffer.Reset()
+	return reply
+}
+
+func TestRESPIncr(t *testing.T) {
+	session, buffer := newTestSession(t)
+
+	for _, test := range []struct {
+		args  []string
+		reply string
+	}{
+		{[]string{"INCR", "counter"}, ":1\r\n"},
+		{[]string{"INCR", "counter"}, ":2\r\n"},
+		{[]string{"GET", "counter"}, "$1\r\n2\r\n"},
+		{[]string{"SET", "name", "chord"}, "+OK\r\n"},
+		{[]string{"INCR", "name"}, "-" + string(errRESPNotInteger) + "\r\n"},
+		{[]string{"SET", "max", strconv.FormatInt(1<<63-1, 10)}, "+OK\r\n"},
+		{[]string{"INCR", "max"}, "-ERR increment or decrement would overflow\r\n"},
+	} {
+		if reply := respRun(session, buffer, test.args...); reply != test.reply {
+			t.Errorf("%v replied %q, want %q", test.args, reply, test.reply)
+		}
+	}
+}
+
+func TestRESPUpdateRetriesConcurrentWrite(t *testing.T) {
+	session, _ := newTestSession(t)
+	store := session.chordServer.KVStore.Store
+	putKeys(t, session.chordServer, "key")
+
+	// Another client writes the key between the first read and write, so the first write must not apply.
+	attempts := 0
+	err := session.update(context.Background(), "key", func(current *pb.Value) (*pb.KVPutRequest, error) {
+		attempts++
+		if attempts == 1 {
+			if _, _, err := store.Put("key", data.Value{Data: []byte("concurrent")}, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &pb.KVPutRequest{Data: append([]byte("updated "), current.Data...)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, _ := store.Get("key")
+	if attempts != 2 || string(value.Data) != "updated concurrent" {
+		t.Fatalf("update ran %d times and left %q, want 2 runs and the concurrent write updated", attempts, value.Data)
+	}
+
+	// A key that changes on every attempt is given up on.
+	attempts = 0
+	err = session.update(context.Background(), "key", func(current *pb.Value) (*pb.KVPutRequest, error) {
+		attempts++
+		store.Put("key", data.Value{Data: []byte(strconv.Itoa(attempts))}, nil)
+		return &pb.KVPutRequest{Data: []byte("updated")}, nil
+	})
+	if err != errRESPContended || attempts != respCASAttempts {
+		t.Fatalf("update returned %v after %d attempts, want %v after %d", err, attempts, errRESPContended, respCASAttempts)
+	}
+}
+
+// The cursor and keys of a SCAN reply.
+func scanReply(t *testing.T, reply string) (string, []string) {
+	t.Helper()
+
+	reader := bufio.NewReader(bytes.NewBufferString(reply))
+	next := func() string {
+		line, err := readLine(reader, maxInlineBytes)
+		if err != nil {
+			t.Fatalf("invalid SCAN reply %q: %v", reply, err)
+		}
+		return string(line)
+	}
+
+	if header := next(); header != "*2" {
+		t.Fatalf("invalid SCAN reply %q", reply)
+	}
+	next()
+	cursor := next()
+
+	count, err := strconv.Atoi(next()[1:])
+	if err != nil {
+		t.Fatalf("invalid SCAN reply %q", reply)
+	}
+
+	keys := make([]string, count)
+	for i := range keys {
+		next()
+		keys[i] = next()
+	}
+	return cursor, keys
+}
+
+func TestRESPScanContinuesAfterHash(t *testing.T) {
+	session, buffer := newTestSession(t)
+	capacity := session.chordServer.Capacity
+
+	// Three keys share hash 10, more than a page of two holds.
+	var shared []string
+	for i := 0; len(shared) < 3; i++ {
+		if key := fmt.Sprintf("shared-%d", i); hash(key, capacity) == 10 {
+			shared = append(shared, key)
+		}
+	}
+	keys := keysByHash(capacity)
+	putKeys(t, session.chordServer, append(shared, keys[5], keys[20])...)
+
+	cursor, first := scanReply(t, respRun(session, buffer, "SCAN", "0", "COUNT", "2"))
+
+	// The page is extended to the end of hash 10, and the cursor resumes after it.
+	if cursor != "11" {
+		t.Fatalf("cursor after the first page is %s, want 11", cursor)
+	}
+	if want := append([]string{keys[5]}, shared...); !sameKeys(first, want) {
+		t.Fatalf("first page is %v, want %v", first, want)
+	}
+
+	cursor, second := scanReply(t, respRun(session, buffer, "SCAN", cursor, "COUNT", "2"))
+	if cursor != "0" || !sameKeys(second, []string{keys[20]}) {
+		t.Fatalf("second page is %v with cursor %s, want [%s] and cursor 0", second, cursor, keys[20])
+	}
+
+	if reply := respRun(session, buffer, "SCAN", "256"); reply != "-ERR invalid cursor\r\n" {
+		t.Fatalf("SCAN past the ring replied %q", reply)
+	}
+}
+
+func sameKeys(keys []string, want []string) bool {
+	keys, want = slices.Clone(keys), slices.Clone(want)
+	slices.Sort(keys)
+	slices.Sort(want)
+	return slices.Equal(keys, want)
+}
@@ -0,0 +1,120 @@
+package overlay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The Redis serialization protocol (RESP2): commands arrive as arrays of bulk strings, or as inline
+// space-separated lines (e.g. from telnet), and replies are simple strings, errors, integers, bulk strings
+// or arrays of them.
+
+// Limits from Redis: proto-max-bulk-len, and the longest inline command.
+const maxBulkBytes int = 512 << 20
+const maxInlineBytes int = 64 << 10
+const maxCommandArgs int = 1 << 20
+
+var errProtocol = errors.New("protocol error")
+
+// Read the next command and its arguments.
+func readCommand(reader *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(reader, maxInlineBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		return bytes.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > maxCommandArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	args := make([][]byte, 0, min(count, 1024))
+	for i := 0; i < count; i++ {
+		header, err := readLine(reader, maxInlineBytes)
+		if err != nil {
+			return nil, err
+		}
+		if len(header) == 0 || header[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got '%s'", errProtocol, header)
+		}
+
+		size, err := strconv.Atoi(string(header[1:]))
+		if err != nil || size < 0 || size > maxBulkBytes {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		if !bytes.HasSuffix(arg, []byte("\r\n")) {
+			return nil, fmt.Errorf("%w: bulk string not terminated", errProtocol)
+		}
+
+		args = append(args, arg[:size])
+	}
+
+	return args, nil
+}
+
+// A line without its CRLF (or LF, for inline commands).
+func readLine(reader *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > limit {
+			return nil, fmt.Errorf("%w: line too long", errProtocol)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line = bytes.TrimSuffix(line[:len(line)-1], []byte("\r"))
+		return line, nil
+	}
+}
+
+type respWriter struct {
+	*bufio.Writer
+}
+
+func (writer respWriter) simple(s string) {
+	writer.WriteString("+" + s + "\r\n")
+}
+
+// Error replies start with their kind, e.g. "ERR" or "MOVED".
+func (writer respWriter) error(s string) {
+	writer.WriteString("-" + s + "\r\n")
+}
+
+func (writer respWriter) integer(n int64) {
+	writer.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (writer respWriter) bulk(b []byte) {
+	writer.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	writer.Write(b)
+	writer.WriteString("\r\n")
+}
+
+// The null bulk string, e.g. for a missing key.
+func (writer respWriter) null() {
+	writer.WriteString("$-1\r\n")
+}
+
+// The header of an array; its n elements follow.
+func (writer respWriter) array(n int) {
+	writer.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
@@ -0,0 +1,102 @@
+package overlay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadCommand(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input string
+		args  []string
+	}{
+		{"inline", "SET key value\r\n", []string{"SET", "key", "value"}},
+		{"inline without CR", "GET  key\n", []string{"GET", "key"}},
+		{"empty inline", "\r\n", []string{}},
+		{"multibulk", "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n", []string{"GET", "key"}},
+		// Bulk strings are binary-safe: spaces and CRLF inside them are data.
+		{"binary bulk", "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$4\r\na\r\nb\r\n", []string{"SET", "k", "a\r\nb"}},
+		{"empty bulk", "*2\r\n$3\r\nGET\r\n$0\r\n\r\n", []string{"GET", ""}},
+	} {
+		args, err := readCommand(bufio.NewReader(strings.NewReader(test.input)))
+		if err != nil {
+			t.Errorf("%s: readCommand(%q) failed: %v", test.name, test.input, err)
+			continue
+		}
+
+		got := make([]string, len(args))
+		for i, arg := range args {
+			got[i] = string(arg)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.args) {
+			t.Errorf("%s: readCommand(%q) = %q, want %q", test.name, test.input, got, test.args)
+		}
+	}
+}
+
+func TestReadCommandPipelined(t *testing.T) {
+	reader := bufio.NewReader(bytes.NewBufferString("*1\r\n$4\r\nPING\r\nGET key\r\n"))
+
+	for _, want := range []string{"[PING]", "[GET key]"} {
+		args, err := readCommand(reader)
+		if err != nil || fmt.Sprintf("%s", args) != want {
+			t.Fatalf("readCommand returned %s, %v, want %s", args, err, want)
+		}
+	}
+
+	if _, err := readCommand(reader); err != io.EOF {
+		t.Fatalf("readCommand at the end of the stream returned %v, want EOF", err)
+	}
+}
+
+func TestReadCommandErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		protocol bool
+	}{
+		{"invalid multibulk length", "*x\r\n", true},
+		{"too many arguments", fmt.Sprintf("*%d\r\n", maxCommandArgs+1), true},
+		{"missing bulk header", "*1\r\n:3\r\n", true},
+		{"negative bulk length", "*1\r\n$-1\r\n", true},
+		{"oversized bulk", fmt.Sprintf("*1\r\n$%d\r\n", maxBulkBytes+1), true},
+		{"unterminated bulk", "*1\r\n$3\r\nabcde\r\n", true},
+		{"oversized inline", strings.Repeat("a", maxInlineBytes+1) + "\r\n", true},
+		{"oversized bulk header", "*1\r\n$" + strings.Repeat("1", maxInlineBytes+1) + "\r\n", true},
+		// A connection closed mid-command is not a protocol error.
+		{"truncated bulk", "*1\r\n$5\r\nab", false},
+		{"truncated multibulk", "*2\r\n$3\r\nGET\r\n", false},
+	} {
+		_, err := readCommand(bufio.NewReader(strings.NewReader(test.input)))
+		if err == nil {
+			t.Errorf("%s: readCommand accepted %.20q", test.name, test.input)
+			continue
+		}
+		if errors.Is(err, errProtocol) != test.protocol {
+			t.Errorf("%s: readCommand returned %v, want a protocol error: %v", test.name, err, test.protocol)
+		}
+	}
+}
+
+func TestRESPWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := respWriter{bufio.NewWriter(&buffer)}
+
+	writer.array(5)
+	writer.simple("OK")
+	writer.error("ERR no")
+	writer.integer(-3)
+	writer.bulk([]byte("a\r\nb"))
+	writer.null()
+	writer.Flush()
+
+	if want := "*5\r\n+OK\r\n-ERR no\r\n:-3\r\n$4\r\na\r\nb\r\n$-1\r\n"; buffer.String() != want {
+		t.Fatalf("wrote %q, want %q", buffer.String(), want)
+	}
+}
@@ -0,0 +1,219 @@
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const identityFile string = "node.json"
+
+// Persisted identity of a node, used to rejoin the ring at the same position after a restart.
+type Identity struct {
+	IP         string
+	Capacity   uint64
+	Hash       uint64
+	Successors []string
+}
+
+// Persist this node's identity in dir and return the identity an earlier run left there, if any.
+func (chordServer *ChordServer) EnablePersistence(dir string) (*Identity, error) {
+	chordServer.stateDir = dir
+
+	identityBytes, err := os.ReadFile(filepath.Join(dir, identityFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{}
+	err = json.Unmarshal(identityBytes, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity.IP != chordServer.IP || identity.Capacity != chordServer.Capacity {
+		return nil, fmt.Errorf("%s belongs to node %s in a ring of capacity %d", dir, identity.IP, identity.Capacity)
+	}
+
+	return identity, nil
+}
+
+func (chordServer *ChordServer) saveIdentity() {
+	if chordServer.stateDir == "" {
+		return
+	}
+
+	chordServer.identityMux.Lock()
+	defer chordServer.identityMux.Unlock()
+
+	identity := Identity{IP: chordServer.IP, Capacity: chordServer.Capacity, Hash: chordServer.Hash, Successors: chordServer.Successors()}
+
+	identityBytes, err := json.Marshal(identity)
+	if err == nil {
+		path := filepath.Join(chordServer.stateDir, identityFile)
+		err = os.WriteFile(path+".tmp", identityBytes, 0644)
+		if err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+	}
+
+	if err != nil {
+		logger.Error("Saving node identity failed", "err", err)
+	}
+}
+
+// Rejoin the ring after a restart through the contact or, failing that, the successors known before
+// the restart, then hand off the recovered keys this node no longer owns. A node that cannot reach
+// any of them recreates the ring on its own, keeping all of its keys.
+func (chordServer *ChordServer) Rejoin(identity *Identity, contact string) error {
+	var candidates []string
+	if contact != "None" {
+		candidates = append(candidates, contact)
+	}
+	for _, ip := range identity.Successors {
+		if ip != chordServer.IP && !slices.Contains(candidates, ip) {
+			candidates = append(candidates, ip)
+		}
+	}
+
+	for _, candidate := range candidates {
+		contactNode, err := Connect(candidate)
+		if err != nil {
+			continue
+		}
+
+		err = chordServer.Join(contactNode)
+		if err != nil {
+			logger.Warn("Rejoining through peer failed", "peer", candidate, "err", err)
+			contactNode.Close()
+			continue
+		}
+
+		chordServer.FingerMuxs[0].RLock()
+		successor := chordServer.FingerTable[0]
+		chordServer.FingerMuxs[0].RUnlock()
+
+		// The ring may not have noticed the restart yet and route our own position back to us.
+		if successor.Ip == chordServer.IP && slices.Contains(identity.Successors, candidate) {
+			chordServer.FingerMuxs[0].Lock()
+			chordServer.FingerTable[0] = contactNode
+			chordServer.FingerMuxs[0].Unlock()
+			successor = contactNode
+		}
+
+		logger.Info("Rejoined chord ring", "peer", candidate, "successor", successor.Ip)
+
+		if successor.Ip != chordServer.IP {
+			err = chordServer.reconcile(successor)
+			if err != nil {
+				logger.Error("Reconciling recovered keys failed", "err", err)
+			}
+		}
+
+		chordServer.saveIdentity()
+		return nil
+	}
+
+	if contact != "None" {
+		return fmt.Errorf("no contact or previous successor of %s is reachable", chordServer.IP)
+	}
+
+	logger.Warn("No previous successor is reachable, recreating the ring")
+	chordServer.Create()
+
+	return nil
+}
+
+// Hand off the recovered keys outside this node's arc, which is bounded by its successor's current
+// predecessor, to their owners. Owners keep the values they already hold, since those were written
+// while this node was down; keys this node still owns are refreshed by the successor's transfer
+// once it learns of its new predecessor.
+func (chordServer *ChordServer) reconcile(successor *ChordNode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), walkTimeout)
+	info, err := successor.TopologyClient.NodeInfo(ctx, &emptypb.Empty{})
+	cancel()
+
+	if err != nil {
+		return err
+	}
+
+	if info.Predecessor == "" || info.Predecessor == chordServer.IP {
+		logger.Info("Arc unchanged since the restart, keeping all recovered keys")
+		return nil
+	}
+
+	predHash := hash(info.Predecessor, chordServer.Capacity)
+
+	// Group the moved keys by their current owner.
+	handoffs := make(map[string]*pb.KVMap)
+	var handoffErr error
+
+	transferData, err := chordServer.KVStore.GetValuesForTransfer(chordServer.Hash, predHash)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range transferData.Kvmap {
+		ipMsg, err := successor.LookupClient.FindSuccessor(context.Background(), &pb.Hash{
+			Hash: &(wrapperspb.UInt64Value{Value: hash(key, chordServer.Capacity)}),
+		})
+
+		if err != nil {
+			handoffErr = err
+			continue
+		}
+
+		owner := ipMsg.Ip.Value
+		if owner == chordServer.IP {
+			continue
+		}
+
+		if handoffs[owner] == nil {
+			handoffs[owner] = &pb.KVMap{Kvmap: make(map[string]*pb.Value), KeepExisting: true}
+		}
+		handoffs[owner].Kvmap[key] = value
+	}
+
+	for owner, handoff := range handoffs {
+		node, err := Connect(owner)
+		if err != nil {
+			handoffErr = err
+			continue
+		}
+
+		_, err = node.DataClient.TransferData(context.Background(), handoff)
+		node.Close()
+
+		if err != nil {
+			logger.Warn("Handing off recovered keys failed", "peer", owner, "keys", len(handoff.Kvmap), "err", err)
+			handoffErr = err
+			continue
+		}
+
+		var deletes []data.Mutation
+		for key := range handoff.Kvmap {
+			deletes = append(deletes, data.Mutation{Key: key})
+		}
+
+		err = chordServer.KVStore.Store.Apply(deletes)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Handed off recovered keys", "peer", owner, "keys", len(handoff.Kvmap))
+	}
+
+	return handoffErr
+}
@@ -0,0 +1,252 @@
+package overlay
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Cluster-wide scan: the ring is walked in hash order, from hash 0 upwards, one owner at a time.
+// The continuation token records the last position returned (hash and key) rather than a node, so
+// each page resumes at whichever node owns that position by then and the scan stays correct while
+// keys move between nodes.
+
+const defaultScanLimit int = 100
+const maxScanLimit int = 1000
+
+// Scan Service
+
+func (chordServer *ChordServer) Scan(ctx context.Context, request *pb.ScanRequest) (*pb.ScanPage, error) {
+	chordServer.PredecessorMux.RLock()
+	if chordServer.Predecessor != nil {
+		predHash := hash(chordServer.Predecessor.Ip, chordServer.Capacity)
+		if !isBetween(request.StartHash, predHash, chordServer.Hash) {
+			chordServer.PredecessorMux.RUnlock()
+			return nil, status.Errorf(codes.FailedPrecondition, "hash %d is not in the arc of %s", request.StartHash, chordServer.IP)
+		}
+	}
+	chordServer.PredecessorMux.RUnlock()
+
+	var entries []*pb.ScanEntry
+
+	// (start - 1, end] wraps to [0, end] when start is 0.
+	chordServer.KVStore.Store.Range(request.StartHash-1, request.EndHash, func(key string, value data.Value) bool {
+		keyHash := hash(key, chordServer.Capacity)
+		if value.Deleted || keyHash == request.StartHash && key <= request.AfterKey {
+			return true
+		}
+
+		entry := &pb.ScanEntry{Key: key, Hash: keyHash}
+		if request.Values {
+			entry.Value = value.ToProto()
+		}
+		entries = append(entries, entry)
+		return true
+	})
+
+	slices.SortFunc(entries, func(entry1, entry2 *pb.ScanEntry) int {
+		if entry1.Hash != entry2.Hash {
+			return cmp.Compare(entry1.Hash, entry2.Hash)
+		}
+		return strings.Compare(entry1.Key, entry2.Key)
+	})
+
+	page := &pb.ScanPage{Entries: entries}
+	if len(entries) > int(request.Limit) {
+		page.Entries = entries[:request.Limit]
+		page.More = true
+	}
+
+	return page, nil
+}
+
+// Scan HTTP endpoint
+
+type scanEntry struct {
+	Key         string `json:"key"`
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+}
+
+type scanResponse struct {
+	Entries []scanEntry `json:"entries"`
+	// Empty once the whole ring has been scanned.
+	Cursor string `json:"cursor"`
+}
+
+// GET /scan?limit=N&values=true&cursor=TOKEN
+func (chordServer *ChordServer) ServeScan(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultScanLimit
+	if query.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxScanLimit {
+			http.Error(w, fmt.Sprintf("%s: limit must be between 1 and %d.", http.StatusText(http.StatusBadRequest), maxScanLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	values := query.Get("values") == "true"
+
+	entries, cursor, err := chordServer.scanRing(r.Context(), query.Get("cursor"), limit, values)
+	if errors.Is(err, errInvalidCursor) {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": invalid cursor.", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway)+": "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	response := &scanResponse{Entries: []scanEntry{}, Cursor: cursor}
+	for _, entry := range entries {
+		result := scanEntry{Key: entry.Key}
+		if entry.Value != nil {
+			result.Value = entry.Value.Data
+			result.ContentType = entry.Value.ContentType
+			result.ETag = data.FormatETag(entry.Value.Version)
+		}
+		response.Entries = append(response.Entries, result)
+	}
+
+	writeJSON(w, response)
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Walk the ring from a cursor, owner by owner, until limit entries are found. Returns the entries and the
+// cursor of the next page, empty once the whole ring has been scanned.
+func (chordServer *ChordServer) scanRing(ctx context.Context, cursor string, limit int, values bool) ([]*pb.ScanEntry, string, error) {
+	position, afterKey, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", errInvalidCursor
+	}
+
+	top := uint64(1)<<chordServer.Capacity - 1
+	var entries []*pb.ScanEntry
+
+	for position <= top {
+		page, endHash, err := chordServer.scanOwner(ctx, position, afterKey, limit-len(entries), values)
+		if err != nil {
+			return nil, "", err
+		}
+
+		entries = append(entries, page.Entries...)
+
+		if page.More || (len(entries) == limit && endHash < top) {
+			if len(page.Entries) > 0 {
+				last := page.Entries[len(page.Entries)-1]
+				return entries, encodeCursor(last.Hash, last.Key), nil
+			}
+			return entries, encodeCursor(position, afterKey), nil
+		}
+
+		if endHash == top {
+			break
+		}
+
+		position, afterKey = endHash+1, ""
+	}
+
+	return entries, "", nil
+}
+
+// Scan the part of [position, top] owned by position's successor, retrying the lookup if ownership
+// moved in between. Returns the page and the last hash it covers.
+func (chordServer *ChordServer) scanOwner(ctx context.Context, position uint64, afterKey string, limit int, values bool) (*pb.ScanPage, uint64, error) {
+	top := uint64(1)<<chordServer.Capacity - 1
+
+	var err error
+	for attempt := 0; attempt < MaxRetries; attempt++ {
+		var ipMsg *pb.IP
+		ipMsg, err = chordServer.lookup(ctx, position)
+		if err != nil {
+			continue
+		}
+
+		ownerHash := hash(ipMsg.Ip.Value, chordServer.Capacity)
+		endHash := ownerHash
+		if ownerHash < position {
+			// The owner's arc wraps past the top of the ring.
+			endHash = top
+		}
+
+		request := &pb.ScanRequest{StartHash: position, AfterKey: afterKey, EndHash: endHash, Limit: uint32(limit), Values: values}
+
+		var page *pb.ScanPage
+		if ipMsg.Ip.Value == chordServer.IP {
+			page, err = chordServer.Scan(ctx, request)
+		} else {
+			var owner *ChordNode
+			owner, err = Connect(ipMsg.Ip.Value)
+			if err != nil {
+				continue
+			}
+			page, err = owner.DataClient.Scan(ctx, request)
+			owner.Close()
+		}
+
+		if status.Code(err) == codes.FailedPrecondition {
+			logger.Debug("Scan position moved to another owner, retrying", "key_hash", position, "peer", ipMsg.Ip.Value)
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return page, endHash, nil
+	}
+
+	return nil, 0, err
+}
+
+// Cursors are opaque to clients: base64 of "hash:key", the last position returned.
+func encodeCursor(position uint64, afterKey string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(position, 10) + ":" + afterKey))
+}
+
+func decodeCursor(cursor string) (uint64, string, error) {
+	if cursor == "" {
+		return 0, "", nil
+	}
+
+	cursorBytes, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", err
+	}
+
+	positionString, afterKey, found := strings.Cut(string(cursorBytes), ":")
+	if !found {
+		return 0, "", fmt.Errorf("malformed cursor")
+	}
+
+	position, err := strconv.ParseUint(positionString, 10, 64)
+	return position, afterKey, err
+}
+
+func writeJSON(w http.ResponseWriter, response any) {
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseBytes)
+}
@@ -0,0 +1,135 @@
+package overlay
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	data "github.com/girivad/go-chord/Data"
+)
+
+// A lone node on a ring of 2^8 hashes, which owns every key.
+func newTestServer(t *testing.T) *ChordServer {
+	t.Helper()
+
+	chordServer, err := NewChordServer("127.0.0.1", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chordServer.FingerTable[0].Close() })
+
+	return chordServer
+}
+
+func putKeys(t *testing.T, chordServer *ChordServer, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		if _, _, err := chordServer.KVStore.Store.Put(key, data.Value{Data: []byte(key)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		position uint64
+		afterKey string
+	}{
+		{0, ""},
+		{255, "key"},
+		{17, "a:b:c"},
+	} {
+		position, afterKey, err := decodeCursor(encodeCursor(test.position, test.afterKey))
+		if err != nil || position != test.position || afterKey != test.afterKey {
+			t.Errorf("decodeCursor(encodeCursor(%d, %q)) = %d, %q, %v", test.position, test.afterKey, position, afterKey, err)
+		}
+	}
+
+	for _, cursor := range []string{"!", "MTc", "eDph"} {
+		if _, _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) accepted an invalid cursor", cursor)
+		}
+	}
+}
+
+func TestScanRingWraparound(t *testing.T) {
+	chordServer := newTestServer(t)
+
+	var keys []string
+	for i := 0; i < 40; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+
+	// Two keys at the same hash, so that a page can end between them.
+	seen := make(map[uint64]string)
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("collision-%d", i)
+		keyHash := hash(key, chordServer.Capacity)
+		if other, found := seen[keyHash]; found {
+			keys = append(keys, other, key)
+			break
+		}
+		seen[keyHash] = key
+	}
+
+	putKeys(t, chordServer, keys...)
+
+	// The node's arc wraps past the top of the ring, so the scan must cross from it to hash 0.
+	if !slices.ContainsFunc(keys, func(key string) bool { return hash(key, chordServer.Capacity) > chordServer.Hash }) {
+		t.Fatal("no key hashes past the node, so the scan never wraps")
+	}
+
+	want := slices.Clone(keys)
+	slices.SortFunc(want, func(key1, key2 string) int {
+		hash1, hash2 := hash(key1, chordServer.Capacity), hash(key2, chordServer.Capacity)
+		if hash1 != hash2 {
+			return cmp.Compare(hash1, hash2)
+		}
+		return strings.Compare(key1, key2)
+	})
+
+	for limit := 1; limit <= 7; limit++ {
+		var got []string
+		cursor := ""
+
+		for pages := 0; ; pages++ {
+			if pages > len(keys) {
+				t.Fatalf("limit %d: scan did not finish after %d pages", limit, pages)
+			}
+
+			entries, next, err := chordServer.scanRing(context.Background(), cursor, limit, false)
+			if err != nil {
+				t.Fatalf("limit %d: %v", limit, err)
+			}
+			if len(entries) > limit {
+				t.Fatalf("limit %d: page of %d entries", limit, len(entries))
+			}
+
+			for _, entry := range entries {
+				got = append(got, entry.Key)
+			}
+
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("limit %d: scanned %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func TestScanRingInvalidCursor(t *testing.T) {
+	chordServer := newTestServer(t)
+
+	if _, _, err := chordServer.scanRing(context.Background(), "!", 10, false); !errors.Is(err, errInvalidCursor) {
+		t.Fatalf("scanRing with an invalid cursor returned %v, want errInvalidCursor", err)
+	}
+}
@@ -3,9 +3,16 @@ package overlay
 import (
 	"context"
 	"errors"
-	"log"
+	"sync"
+	"time"
 
+	metrics "github.com/girivad/go-chord/Metrics"
 	pb "github.com/girivad/go-chord/Proto"
+	tracing "github.com/girivad/go-chord/Tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
@@ -15,25 +22,19 @@ import (
 
 func (chordServer *ChordServer) FindSuccessor(ctx context.Context, keyHash *pb.Hash) (*pb.IP, error) {
 	// Find the nearest predecessor and return its successor.
-	log.Printf("[DEBUG] Find Successor Invoked")
-	defer log.Printf("[DEBUG] Find Successor Completed.")
+	logger.Debug("Find Successor invoked", "key_hash", keyHash.Hash.Value)
+	defer logger.Debug("Find Successor completed", "key_hash", keyHash.Hash.Value)
 
 	// Ask the latest finger before the key to find the successor.
-	for finger := chordServer.Capacity - 1; finger >= 0; finger-- {
-		chordServer.FingerMuxs[finger].RLock()
-
-		if chordServer.FingerTable[finger] == nil || chordServer.FingerTable[finger].Ip == chordServer.IP {
-			chordServer.FingerMuxs[finger].RUnlock()
-			continue
-		}
-
-		if isBetween(hash(chordServer.FingerTable[finger].Ip, chordServer.Capacity), chordServer.Hash, keyHash.Hash.Value) {
-			log.Printf("[INFO] Find Successor Transferred to %s", chordServer.FingerTable[finger].Ip)
-			ipMsg, err := chordServer.FingerTable[finger].LookupClient.FindSuccessor(ctx, keyHash)
-			return ipMsg, err
+	if fingerNode := chordServer.closestPrecedingFinger(keyHash.Hash.Value); fingerNode != nil {
+		logger.Debug("Find Successor forwarded", "key_hash", keyHash.Hash.Value, "peer", fingerNode.Ip)
+		ipMsg, err := fingerNode.LookupClient.FindSuccessor(ctx, keyHash)
+		if err != nil {
+			return nil, err
 		}
 
-		chordServer.FingerMuxs[finger].RUnlock()
+		ipMsg.Hops++
+		return ipMsg, nil
 	}
 
 	chordServer.FingerMuxs[0].RLock()
@@ -44,11 +45,108 @@ func (chordServer *ChordServer) FindSuccessor(ctx context.Context, keyHash *pb.H
 	return &pb.IP{Ip: &wrapperspb.StringValue{Value: successorIP}}, nil
 }
 
+// Resolve many hashes at once: hashes that fall to the successor are answered directly, and the
+// rest are forwarded in one batch per closest preceding finger, in parallel.
+func (chordServer *ChordServer) FindSuccessors(ctx context.Context, hashes *pb.Hashes) (*pb.Owners, error) {
+	logger.Debug("Find Successors invoked", "hashes", len(hashes.Hashes))
+
+	owners := &pb.Owners{Ips: make([]string, len(hashes.Hashes)), Errors: make([]string, len(hashes.Hashes))}
+	forwards := make(map[*ChordNode][]int)
+
+	chordServer.FingerMuxs[0].RLock()
+	successorIP := chordServer.FingerTable[0].Ip
+	chordServer.FingerMuxs[0].RUnlock()
+
+	for i, keyHash := range hashes.Hashes {
+		if fingerNode := chordServer.closestPrecedingFinger(keyHash); fingerNode != nil {
+			forwards[fingerNode] = append(forwards[fingerNode], i)
+		} else {
+			owners.Ips[i] = successorIP
+		}
+	}
+
+	var wg sync.WaitGroup
+	for fingerNode, indexes := range forwards {
+		wg.Add(1)
+		go func(fingerNode *ChordNode, indexes []int) {
+			defer wg.Done()
+
+			batch := &pb.Hashes{}
+			for _, i := range indexes {
+				batch.Hashes = append(batch.Hashes, hashes.Hashes[i])
+			}
+
+			reply, err := fingerNode.LookupClient.FindSuccessors(ctx, batch)
+			if err == nil && len(reply.Ips) != len(indexes) {
+				err = errors.New("mismatched batch lookup reply")
+			}
+
+			for j, i := range indexes {
+				if err != nil {
+					owners.Errors[i] = err.Error()
+					continue
+				}
+				owners.Ips[i] = reply.Ips[j]
+				if j < len(reply.Errors) {
+					owners.Errors[i] = reply.Errors[j]
+				}
+			}
+		}(fingerNode, indexes)
+	}
+	wg.Wait()
+
+	return owners, nil
+}
+
+// The latest finger strictly between this node and the key, or nil if the key's successor is this node's successor.
+func (chordServer *ChordServer) closestPrecedingFinger(keyHash uint64) *ChordNode {
+	for finger := int(chordServer.Capacity) - 1; finger >= 0; finger-- {
+		chordServer.FingerMuxs[finger].RLock()
+		fingerNode := chordServer.FingerTable[finger]
+		chordServer.FingerMuxs[finger].RUnlock()
+
+		if fingerNode == nil || fingerNode.Ip == chordServer.IP {
+			continue
+		}
+
+		// A node whose hash equals the key owns it, so only fingers strictly before the key qualify.
+		fingerHash := hash(fingerNode.Ip, chordServer.Capacity)
+		if fingerHash != keyHash && isBetween(fingerHash, chordServer.Hash, keyHash) {
+			return fingerNode
+		}
+	}
+
+	return nil
+}
+
+// Resolve the successor of a key hash on behalf of this node, recording lookup metrics.
+func (chordServer *ChordServer) lookup(ctx context.Context, keyHash uint64) (*pb.IP, error) {
+	start := time.Now()
+
+	ctx, span := tracing.Start(ctx, "chord.lookup", attribute.Int64("chord.key_hash", int64(keyHash)))
+	ipMsg, err := chordServer.FindSuccessor(ctx, &pb.Hash{Hash: &wrapperspb.UInt64Value{Value: keyHash}})
+	if err == nil {
+		span.SetAttributes(attribute.String("chord.successor", ipMsg.Ip.Value), attribute.Int("chord.hops", int(ipMsg.Hops)))
+	}
+	tracing.End(span, err)
+
+	if err != nil {
+		metrics.Lookups.WithLabelValues("error").Inc()
+		return nil, err
+	}
+
+	metrics.Lookups.WithLabelValues("ok").Inc()
+	metrics.LookupDuration.Observe(time.Since(start).Seconds())
+	metrics.LookupHops.Observe(float64(ipMsg.Hops))
+
+	return ipMsg, nil
+}
+
 // Predecessor Services
 
 func (chordServer *ChordServer) GetPredecessor(ctx context.Context, empty *emptypb.Empty) (*pb.IP, error) {
-	log.Printf("[DEBUG] Get Predecessor Invoked.")
-	defer log.Printf("[DEBUG] Get Predecessor Completed.")
+	logger.Debug("Get Predecessor invoked")
+	defer logger.Debug("Get Predecessor completed")
 
 	chordServer.PredecessorMux.RLock()
 	if chordServer.Predecessor != nil {
@@ -67,8 +165,8 @@ func (chordServer *ChordServer) GetPredecessor(ctx context.Context, empty *empty
 
 func (chordServer *ChordServer) UpdatePredecessor(ctx context.Context, ip *pb.IP) (*emptypb.Empty, error) {
 
-	log.Printf("[DEBUG] Update Predecessor Invoked.")
-	defer log.Printf("[DEBUG] Update Predecessor Completed.")
+	logger.Debug("Update Predecessor invoked", "peer", ip.Ip.Value)
+	defer logger.Debug("Update Predecessor completed", "peer", ip.Ip.Value)
 
 	var predecessorIP string
 
@@ -90,17 +188,54 @@ func (chordServer *ChordServer) UpdatePredecessor(ctx context.Context, ip *pb.IP
 			return &emptypb.Empty{}, err
 		}
 
+		chordServer.transfers.Add(1)
+		defer chordServer.transfers.Add(-1)
+
+		// Direct writes to the arc moving to the new predecessor wait until it owns the arc.
+		chordServer.handoffMux.Lock()
+		defer chordServer.handoffMux.Unlock()
+
+		startHash := (chordServer.Hash + 1) % (1 << chordServer.Capacity)
+		if predecessorIP != "" {
+			startHash = hash(predecessorIP, chordServer.Capacity)
+		}
+		handoff := chordServer.beginHandoff(startHash, hash(newPredecessor.Ip, chordServer.Capacity), newPredecessor.Ip)
+
+		transferStart := time.Now()
+		transferCtx, span := tracing.Start(ctx, "chord.transfer", attribute.String("chord.peer", newPredecessor.Ip))
 		data, err := chordServer.DataToTransfer(hash(newPredecessor.Ip, chordServer.Capacity))
 
 		if err != nil {
+			tracing.End(span, err)
+			chordServer.endHandoff(handoff, false, false)
+			newPredecessor.Close()
 			return &emptypb.Empty{}, err
 		}
 
-		newPredecessor.DataClient.TransferData(context.Background(), data)
+		span.SetAttributes(attribute.Int("chord.keys", len(data.Kvmap)))
+		_, err = newPredecessor.DataClient.TransferData(transferCtx, data)
+		tracing.End(span, err)
+
+		if err != nil {
+			chordServer.endHandoff(handoff, false, false)
+			newPredecessor.Close()
+			return &emptypb.Empty{}, err
+		}
+
+		metrics.ObserveTransfer("out", len(data.Kvmap), proto.Size(data), transferStart)
 
 		chordServer.PredecessorMux.Lock()
 		chordServer.Predecessor = newPredecessor
+		chordServer.advanceEpoch()
 		chordServer.PredecessorMux.Unlock()
+
+		chordServer.endHandoff(handoff, true, false)
+
+		metrics.PredecessorChanges.Inc()
+
+		if chordServer.Membership != nil {
+			chordServer.Membership.Add(newPredecessor.Ip)
+		}
 	}
 
 	return &emptypb.Empty{}, nil
@@ -129,24 +264,53 @@ func (chordServer *ChordServer) DataToTransfer(nodeHash uint64) (*pb.KVMap, erro
 		predHash = (hash(chordServer.IP, chordServer.Capacity) + 1) % (1 << chordServer.Capacity)
 	}
 
-	log.Printf("[DEBUG] nodeHash: %d, predHash: %d, chordHash: %d", nodeHash, predHash, chordServer.Hash)
+	logger.Debug("Selecting keys to transfer", "new_node_hash", nodeHash, "predecessor_hash", predHash)
 
 	chordServer.PredecessorMux.RUnlock()
 
-	keys := chordServer.keyIndex.KeysToTransfer(predHash, nodeHash, chordServer.Hash)
-
-	keyValuePairs, err := chordServer.KVStore.GetValuesForTransfer(keys)
+	keyValuePairs, err := chordServer.KVStore.GetValuesForTransfer(predHash, nodeHash)
 
 	return keyValuePairs, err
 }
 
+func (chordServer *ChordServer) GetValues(ctx context.Context, keys *pb.Keys) (*pb.KVMap, error) {
+	return chordServer.KVStore.GetValues(keys.Keys, keys.Tombstones), nil
+}
+
+func (chordServer *ChordServer) PutValues(ctx context.Context, data *pb.KVMap) (*pb.WriteResults, error) {
+	keys := make([]string, 0, len(data.Kvmap))
+	for key := range data.Kvmap {
+		keys = append(keys, key)
+	}
+
+	release, hint, err := chordServer.fence(ctx, keys)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if hint != nil {
+		return nil, ownerError(hint)
+	}
+	defer release()
+
+	return chordServer.KVStore.PutValues(data), nil
+}
+
+func (chordServer *ChordServer) Replicate(ctx context.Context, mutations *pb.Mutations) (*pb.WriteResults, error) {
+	return chordServer.KVStore.Replicate(mutations), nil
+}
+
+func (chordServer *ChordServer) Purge(ctx context.Context, tombstones *pb.Mutations) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, chordServer.KVStore.Purge(tombstones)
+}
+
 func (chordServer *ChordServer) TransferData(ctx context.Context, data *pb.KVMap) (*emptypb.Empty, error) {
-	log.Printf("[INFO] Received Data Transfer")
+	chordServer.transfers.Add(1)
+	defer chordServer.transfers.Add(-1)
+
+	transferStart := time.Now()
 	err := chordServer.KVStore.PutValuesForTransfer(data)
-	log.Printf("[INFO] Updated Data: %v", chordServer.KVStore.KVMap)
-	chordServer.keyIndex.InsertBatch(data, func(key string) uint64 { return hash(key, chordServer.Capacity) })
-	log.Println("[INFO] Updated Key Index")
-	chordServer.keyIndex.Visualize()
+	logger.Info("Received data transfer", "keys", len(data.Kvmap))
+	metrics.ObserveTransfer("in", len(data.Kvmap), proto.Size(data), transferStart)
 
 	return &emptypb.Empty{}, err
 }
@@ -0,0 +1,155 @@
+package overlay
+
+import (
+	"context"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	metrics "github.com/girivad/go-chord/Metrics"
+	pb "github.com/girivad/go-chord/Proto"
+)
+
+// Deletes leave versioned tombstones, which replicate like values so that a stale copy of a key cannot
+// bring it back. Each node purges the tombstones of its arc once they are older than the grace period and
+// every replica of the key holds the tombstone (or something newer), then tells the replicas to drop theirs.
+// The grace period should outlast hints, which could otherwise replay an older write over a purged delete.
+
+const DefaultTombstoneGrace time.Duration = 24 * time.Hour
+const tombstoneCollectionPeriod time.Duration = 1 * time.Minute
+
+func (chordServer *ChordServer) SetTombstoneGrace(grace time.Duration) {
+	chordServer.tombstoneGrace = grace
+}
+
+func (chordServer *ChordServer) CollectTombstones() {
+	for {
+		time.Sleep(tombstoneCollectionPeriod)
+		chordServer.waitWhilePaused()
+
+		chordServer.collectTombstones()
+	}
+}
+
+func (chordServer *ChordServer) collectTombstones() {
+	startHash := chordServer.Hash
+	chordServer.PredecessorMux.RLock()
+	if chordServer.Predecessor != nil {
+		startHash = hash(chordServer.Predecessor.Ip, chordServer.Capacity)
+	}
+	chordServer.PredecessorMux.RUnlock()
+
+	// Versions are nanosecond timestamps, so a tombstone's version dates the delete.
+	cutoff := uint64(time.Now().Add(-chordServer.tombstoneGrace).UnixNano())
+
+	var expired []*pb.Mutation
+	chordServer.KVStore.Store.Range(startHash, chordServer.Hash, func(key string, value data.Value) bool {
+		if value.Deleted && value.Version < cutoff {
+			expired = append(expired, &pb.Mutation{Key: key, Value: value.ToProto()})
+		}
+		return true
+	})
+
+	if len(expired) == 0 {
+		return
+	}
+
+	replicas := chordServer.chain()[1:]
+	purged := 0
+
+	for start := 0; start < len(expired); start += antiEntropyBatch {
+		batch := expired[start:min(start+antiEntropyBatch, len(expired))]
+
+		tombstones, err := chordServer.acknowledgedTombstones(replicas, batch)
+		if err != nil {
+			maintenanceLogger.Warn("Checking tombstones with replicas failed", "err", err)
+			return
+		}
+		if len(tombstones.Mutations) == 0 {
+			continue
+		}
+
+		// Replicas purge first: a tombstone left behind here is retried next round.
+		for _, ip := range replicas {
+			if err := chordServer.purge(ip, tombstones); err != nil {
+				maintenanceLogger.Warn("Purging tombstones on replica failed", "peer", ip, "err", err)
+				return
+			}
+		}
+
+		if err := chordServer.KVStore.Purge(tombstones); err != nil {
+			maintenanceLogger.Error("Purging tombstones failed", "err", err)
+			return
+		}
+
+		purged += len(tombstones.Mutations)
+	}
+
+	if purged > 0 {
+		maintenanceLogger.Info("Purged tombstones", "tombstones", purged, "replicas", replicas)
+		metrics.TombstonesPurged.Add(float64(purged))
+	}
+}
+
+// The tombstones of a batch that every replica holds at the same or a newer version.
+func (chordServer *ChordServer) acknowledgedTombstones(replicas []string, batch []*pb.Mutation) (*pb.Mutations, error) {
+	keys := &pb.Keys{Tombstones: true}
+	for _, tombstone := range batch {
+		keys.Keys = append(keys.Keys, tombstone.Key)
+	}
+
+	remoteValues := make([]map[string]*pb.Value, 0, len(replicas))
+	for _, ip := range replicas {
+		kvMap, err := chordServer.remoteValues(ip, keys)
+		if err != nil {
+			return nil, err
+		}
+		remoteValues = append(remoteValues, kvMap.Kvmap)
+	}
+
+	return heldTombstones(batch, remoteValues), nil
+}
+
+// The tombstones of a batch held at the same or a newer version in each of the replicas' values.
+func heldTombstones(batch []*pb.Mutation, remoteValues []map[string]*pb.Value) *pb.Mutations {
+	acknowledged := &pb.Mutations{}
+	for _, tombstone := range batch {
+		held := true
+		for _, kvMap := range remoteValues {
+			value := kvMap[tombstone.Key]
+			held = held && value != nil && value.Version >= tombstone.Value.Version
+		}
+
+		if held {
+			acknowledged.Mutations = append(acknowledged.Mutations, tombstone)
+		}
+	}
+
+	return acknowledged
+}
+
+func (chordServer *ChordServer) remoteValues(ip string, keys *pb.Keys) (*pb.KVMap, error) {
+	node, err := Connect(ip)
+	if err != nil {
+		return nil, err
+	}
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+
+	return node.DataClient.GetValues(ctx, keys)
+}
+
+func (chordServer *ChordServer) purge(ip string, tombstones *pb.Mutations) error {
+	node, err := Connect(ip)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+
+	_, err = node.DataClient.Purge(ctx, tombstones)
+	return err
+}
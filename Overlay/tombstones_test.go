@@ -0,0 +1,73 @@
+package overlay
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+)
+
+func TestHeldTombstones(t *testing.T) {
+	tombstone := func(key string) *pb.Mutation {
+		return &pb.Mutation{Key: key, Value: &pb.Value{Version: 5, Deleted: true}}
+	}
+	batch := []*pb.Mutation{tombstone("a"), tombstone("b"), tombstone("c"), tombstone("d")}
+
+	for _, test := range []struct {
+		name         string
+		remoteValues []map[string]*pb.Value
+		held         []string
+	}{
+		{"no replicas", nil, []string{"a", "b", "c", "d"}},
+		{"held by every replica", []map[string]*pb.Value{
+			{"a": {Version: 5, Deleted: true}, "b": {Version: 5, Deleted: true}},
+			{"a": {Version: 5, Deleted: true}, "b": {Version: 5, Deleted: true}},
+		}, []string{"a", "b"}},
+		// A newer write or delete supersedes the tombstone, so purging it cannot resurrect anything.
+		{"newer versions", []map[string]*pb.Value{
+			{"a": {Version: 6}, "b": {Version: 7, Deleted: true}},
+		}, []string{"a", "b"}},
+		{"older version or missing", []map[string]*pb.Value{
+			{"a": {Version: 4}, "b": {Version: 5, Deleted: true}, "c": {Version: 5, Deleted: true}},
+			{"b": {Version: 5, Deleted: true}, "c": {Version: 4, Deleted: true}},
+		}, []string{"b"}},
+	} {
+		var held []string
+		for _, mutation := range heldTombstones(batch, test.remoteValues).Mutations {
+			held = append(held, mutation.Key)
+		}
+
+		if !slices.Equal(held, test.held) {
+			t.Errorf("%s: tombstones %v acknowledged, want %v", test.name, held, test.held)
+		}
+	}
+}
+
+func TestCollectTombstonesAfterGrace(t *testing.T) {
+	chordServer := newTestServer(t)
+	chordServer.SetTombstoneGrace(time.Hour)
+	keys := keysByHash(chordServer.Capacity)
+
+	old := uint64(time.Now().Add(-2 * time.Hour).UnixNano())
+	recent := uint64(time.Now().UnixNano())
+
+	chordServer.KVStore.Replicate(&pb.Mutations{Mutations: []*pb.Mutation{
+		{Key: keys[1], Value: &pb.Value{Version: old, Deleted: true}},
+		{Key: keys[2], Value: &pb.Value{Version: recent, Deleted: true}},
+		{Key: keys[3], Value: &pb.Value{Version: old, Data: []byte("live")}},
+	}})
+
+	// A lone node has no replicas to wait for.
+	chordServer.collectTombstones()
+
+	if _, found := chordServer.KVStore.Store.Entry(keys[1]); found {
+		t.Error("tombstone older than the grace period was kept")
+	}
+	if value, found := chordServer.KVStore.Store.Entry(keys[2]); !found || !value.Deleted {
+		t.Error("tombstone within the grace period was purged")
+	}
+	if value, found := chordServer.KVStore.Store.Entry(keys[3]); !found || value.Deleted {
+		t.Error("old live value was purged")
+	}
+}
@@ -0,0 +1,304 @@
+package overlay
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const SuccessorListSize int = 3
+const maxRingWalk int = 1 << 12
+const walkTimeout time.Duration = 2 * time.Second
+
+// Topology Services
+
+func (chordServer *ChordServer) NodeInfo(ctx context.Context, empty *emptypb.Empty) (*pb.NodeInfo, error) {
+	info := &pb.NodeInfo{
+		Id:       chordServer.Hash,
+		Ip:       chordServer.IP,
+		ArcStart: chordServer.Hash,
+		ArcEnd:   chordServer.Hash,
+		KeyCount: chordServer.KVStore.Store.Stats().Keys,
+		Epoch:    chordServer.Epoch(),
+		Capacity: chordServer.Capacity,
+	}
+
+	chordServer.PredecessorMux.RLock()
+	if chordServer.Predecessor != nil {
+		info.Predecessor = chordServer.Predecessor.Ip
+		info.ArcStart = hash(chordServer.Predecessor.Ip, chordServer.Capacity)
+	}
+	chordServer.PredecessorMux.RUnlock()
+
+	info.Successors = chordServer.Successors()
+
+	for finger := 0; finger < int(chordServer.Capacity); finger++ {
+		entry := &pb.Finger{Start: (chordServer.Hash + 1<<finger) % (1 << chordServer.Capacity)}
+
+		chordServer.FingerMuxs[finger].RLock()
+		if chordServer.FingerTable[finger] != nil {
+			entry.Ip = chordServer.FingerTable[finger].Ip
+		}
+		chordServer.FingerMuxs[finger].RUnlock()
+
+		info.Fingers = append(info.Fingers, entry)
+	}
+
+	return info, nil
+}
+
+// Walk successors around the ring starting at this node. Unreachable nodes are recorded and skipped
+// using the next entries of the previous node's successor list and finger table; the walk stops when
+// it returns to this node (complete), revisits another node, or has travelled more than a full lap.
+func (chordServer *ChordServer) RingWalk(ctx context.Context, empty *emptypb.Empty) (*pb.Ring, error) {
+	ring := &pb.Ring{Capacity: chordServer.Capacity}
+	visited := make(map[string]bool)
+	ringSize := uint64(1) << chordServer.Capacity
+
+	info, err := chordServer.NodeInfo(ctx, empty)
+	if err != nil {
+		return nil, err
+	}
+
+	var travelled uint64
+
+walk:
+	for len(ring.Nodes) < maxRingWalk {
+		visited[info.Ip] = true
+		ring.Nodes = append(ring.Nodes, &pb.RingNode{Ip: info.Ip, Reachable: true, Info: info})
+
+		var candidates []string
+		candidates = append(candidates, info.Successors...)
+		for _, finger := range info.Fingers {
+			candidates = append(candidates, finger.Ip)
+		}
+
+		currentId := info.Id
+
+		for _, candidate := range candidates {
+			if candidate == "" || candidate == info.Ip {
+				continue
+			}
+
+			if candidate == chordServer.IP {
+				ring.Complete = true
+				break walk
+			}
+
+			if visited[candidate] {
+				logger.Warn("Ring walk looped back", "peer", candidate)
+				break walk
+			}
+
+			nextInfo, err := chordServer.remoteNodeInfo(ctx, candidate)
+			if err != nil {
+				logger.Warn("Ring walk skipping unreachable node", "peer", candidate, "err", err)
+				visited[candidate] = true
+				ring.Nodes = append(ring.Nodes, &pb.RingNode{Ip: candidate})
+				continue
+			}
+
+			travelled += (nextInfo.Id - currentId + ringSize) % ringSize
+			if travelled >= ringSize {
+				logger.Warn("Ring walk passed its start without returning to it")
+				break walk
+			}
+
+			info = nextInfo
+			continue walk
+		}
+
+		// No live successor to continue the walk with (or a single-node ring).
+		ring.Complete = len(ring.Nodes) == 1 && info.Ip == chordServer.IP
+		break
+	}
+
+	// Derive each reachable node's arc from its position relative to the previous reachable node in the walk.
+	var reachable []*pb.RingNode
+	for _, node := range ring.Nodes {
+		if node.Reachable {
+			reachable = append(reachable, node)
+		}
+	}
+
+	for i, node := range reachable {
+		if len(reachable) == 1 {
+			node.ArcSize = ringSize
+			break
+		}
+
+		previous := reachable[(i-1+len(reachable))%len(reachable)]
+		node.ArcSize = (node.Info.Id - previous.Info.Id + ringSize) % ringSize
+	}
+
+	return ring, nil
+}
+
+func (chordServer *ChordServer) remoteNodeInfo(ctx context.Context, ip string) (*pb.NodeInfo, error) {
+	node, err := Connect(ip)
+	if err != nil {
+		return nil, err
+	}
+	defer node.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, walkTimeout)
+	defer cancel()
+
+	return node.TopologyClient.NodeInfo(ctx, &emptypb.Empty{})
+}
+
+// Successor List
+
+func (chordServer *ChordServer) Successors() []string {
+	chordServer.SuccessorListMux.RLock()
+	defer chordServer.SuccessorListMux.RUnlock()
+
+	if len(chordServer.SuccessorList) == 0 {
+		chordServer.FingerMuxs[0].RLock()
+		defer chordServer.FingerMuxs[0].RUnlock()
+		return []string{chordServer.FingerTable[0].Ip}
+	}
+
+	return append([]string(nil), chordServer.SuccessorList...)
+}
+
+// Refresh the successor list from the successor's own list.
+func (chordServer *ChordServer) refreshSuccessors() {
+	chordServer.FingerMuxs[0].RLock()
+	successor := chordServer.FingerTable[0]
+	chordServer.FingerMuxs[0].RUnlock()
+
+	if successor.Ip == chordServer.IP {
+		chordServer.SuccessorListMux.Lock()
+		chordServer.SuccessorList = []string{chordServer.IP}
+		chordServer.successorFailures = 0
+		chordServer.SuccessorListMux.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), walkTimeout)
+	info, err := successor.TopologyClient.NodeInfo(ctx, &emptypb.Empty{})
+	cancel()
+
+	if err != nil {
+		chordServer.successorFailed(successor, err)
+		return
+	}
+
+	successors := []string{successor.Ip}
+	for _, ip := range info.Successors {
+		if len(successors) == SuccessorListSize || ip == chordServer.IP {
+			break
+		}
+		successors = append(successors, ip)
+	}
+
+	chordServer.SuccessorListMux.Lock()
+	changed := !slices.Equal(chordServer.SuccessorList, successors)
+	chordServer.SuccessorList = successors
+	chordServer.successorFailures = 0
+	chordServer.SuccessorListMux.Unlock()
+
+	if changed {
+		go chordServer.saveIdentity()
+		go chordServer.reconfigureChains()
+	}
+}
+
+// Count a failure of the successor to respond, and once it has failed more than MaxRetries times in a
+// row replace it with the next live node of the successor list. Without this a node whose successor
+// dies keeps asking the dead node for its predecessor, and the ring stays broken at that point.
+func (chordServer *ChordServer) successorFailed(successor *ChordNode, err error) {
+	chordServer.SuccessorListMux.Lock()
+	chordServer.successorFailures++
+	if chordServer.successorFailures <= MaxRetries {
+		chordServer.SuccessorListMux.Unlock()
+		maintenanceLogger.Debug("Successor did not provide its successor list, retrying", "peer", successor.Ip, "err", err)
+		return
+	}
+
+	var candidates []string
+	for _, ip := range chordServer.SuccessorList {
+		if ip != successor.Ip && ip != chordServer.IP {
+			candidates = append(candidates, ip)
+		}
+	}
+	chordServer.SuccessorListMux.Unlock()
+
+	// Probe the candidates without the lock, so that readers of the successor list are not held up.
+	for _, ip := range candidates {
+		candidate, err := Connect(ip)
+		if err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), walkTimeout)
+		_, err = candidate.CheckClient.LiveCheck(ctx, &emptypb.Empty{})
+		cancel()
+
+		if err != nil {
+			candidate.Close()
+			continue
+		}
+
+		chordServer.FingerMuxs[0].Lock()
+		if chordServer.FingerTable[0] != successor {
+			// Stabilize replaced the successor in the meantime.
+			chordServer.FingerMuxs[0].Unlock()
+			candidate.Close()
+			return
+		}
+		chordServer.FingerTable[0] = candidate
+		chordServer.FingerMuxs[0].Unlock()
+
+		chordServer.SuccessorListMux.Lock()
+		if i := slices.Index(chordServer.SuccessorList, ip); i >= 0 {
+			chordServer.SuccessorList = chordServer.SuccessorList[i:]
+		} else {
+			chordServer.SuccessorList = []string{ip}
+		}
+		chordServer.successorFailures = 0
+		chordServer.SuccessorListMux.Unlock()
+
+		maintenanceLogger.Warn("Successor failed, promoted next successor", "failed", successor.Ip, "peer", ip)
+		go chordServer.reconfigureChains()
+		return
+	}
+
+	maintenanceLogger.Error("Successor failed and no other successor is live", "peer", successor.Ip)
+}
+
+// Topology HTTP endpoints
+
+func (chordServer *ChordServer) ServeNodeInfo(w http.ResponseWriter, r *http.Request) {
+	info, err := chordServer.NodeInfo(r.Context(), &emptypb.Empty{})
+	writeProto(w, info, err)
+}
+
+func (chordServer *ChordServer) ServeRing(w http.ResponseWriter, r *http.Request) {
+	ring, err := chordServer.RingWalk(r.Context(), &emptypb.Empty{})
+	writeProto(w, ring, err)
+}
+
+func writeProto(w http.ResponseWriter, msg proto.Message, err error) {
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError)+": "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	msgBytes, err := protojson.Marshal(msg)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(msgBytes)
+}
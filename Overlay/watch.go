@@ -0,0 +1,312 @@
+package overlay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	data "github.com/girivad/go-chord/Data"
+	pb "github.com/girivad/go-chord/Proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Watches are served where the changes happen: at the owner of a key, or at every node for a
+// prefix. The node a client subscribes to holds one local watch per such node, re-resolves them
+// every watchRefresh so that a watch follows its keys when ownership moves, and drops events it
+// has already delivered (a key's version only grows, also across transfers).
+
+const watchRefresh time.Duration = 5 * time.Second
+
+var eventTypes = map[string]pb.WatchEventType{
+	data.EventPut:    pb.WatchEventType_PUT,
+	data.EventDelete: pb.WatchEventType_DELETE,
+	data.EventExpire: pb.WatchEventType_EXPIRE,
+	data.EventEvict:  pb.WatchEventType_EVICT,
+}
+
+// Watch Service
+
+func (chordServer *ChordServer) Watch(request *pb.WatchRequest, stream pb.Watch_WatchServer) error {
+	if request.Local {
+		return chordServer.watchLocal(stream.Context(), request, stream.Send)
+	}
+	return chordServer.watchRing(stream.Context(), request, stream.Send)
+}
+
+// Report changes to matching keys on this node, starting with their current values.
+func (chordServer *ChordServer) watchLocal(ctx context.Context, request *pb.WatchRequest, send func(*pb.WatchEvent) error) error {
+	watchers := chordServer.KVStore.Watchers
+
+	// Subscribe before reading the current values so that no change falls in between.
+	subscription := watchers.Subscribe(request.Key, request.Prefix)
+	defer watchers.Unsubscribe(subscription)
+
+	// Tombstones newer than the watcher's version tell it of deletes it missed; without one, nothing was deleted.
+	var current []*pb.WatchEvent
+	visit := func(key string, value data.Value) bool {
+		if !subscription.Matches(key) || value.Version <= request.SinceVersion {
+			return true
+		}
+
+		if value.Deleted {
+			if request.SinceVersion != 0 {
+				current = append(current, &pb.WatchEvent{Type: pb.WatchEventType_DELETE, Key: key, Version: value.Version})
+			}
+			return true
+		}
+
+		current = append(current, &pb.WatchEvent{Type: pb.WatchEventType_PUT, Key: key, Version: value.Version, Value: value.ToProto()})
+		return true
+	}
+
+	if request.Prefix {
+		chordServer.KVStore.Store.Range(chordServer.Hash, chordServer.Hash, visit)
+	} else if value, found := chordServer.KVStore.Store.Entry(request.Key); found {
+		visit(request.Key, value)
+	}
+
+	for _, event := range current {
+		if err := send(event); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, open := <-subscription.Events:
+			if !open {
+				return status.Error(codes.ResourceExhausted, "watch fell behind")
+			}
+
+			if event.Version <= request.SinceVersion {
+				continue
+			}
+
+			watchEvent := &pb.WatchEvent{Type: eventTypes[event.Type], Key: event.Key, Version: event.Version}
+			if event.Value != nil {
+				watchEvent.Value = event.Value.ToProto()
+			}
+
+			if err := send(watchEvent); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Follow matching keys around the ring, merging the local watches of the nodes that hold them.
+func (chordServer *ChordServer) watchRing(ctx context.Context, request *pb.WatchRequest, send func(*pb.WatchEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan *pb.WatchEvent)
+	ended := make(chan string)
+	upstreams := make(map[string]context.CancelFunc)
+	delivered := make(map[string]uint64)
+
+	refresh := func() {
+		targets, err := chordServer.watchTargets(ctx, request)
+		if err != nil {
+			logger.Warn("Resolving watch targets failed", "key", request.Key, "err", err)
+			return
+		}
+
+		for ip, upstreamCancel := range upstreams {
+			if !targets[ip] {
+				logger.Debug("Watch moved away from node", "key", request.Key, "peer", ip)
+				upstreamCancel()
+				delete(upstreams, ip)
+			}
+		}
+
+		for ip := range targets {
+			if upstreams[ip] != nil {
+				continue
+			}
+
+			upstreamCtx, upstreamCancel := context.WithCancel(ctx)
+			upstreams[ip] = upstreamCancel
+
+			go func(ip string) {
+				err := chordServer.watchUpstream(upstreamCtx, ip, request, events)
+				if upstreamCtx.Err() == nil {
+					logger.Debug("Upstream watch ended", "key", request.Key, "peer", ip, "err", err)
+				}
+
+				select {
+				case ended <- ip:
+				case <-ctx.Done():
+				}
+			}(ip)
+		}
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(watchRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			refresh()
+		case ip := <-ended:
+			// Resubscribed at the next refresh if the node still holds matching keys.
+			if upstreamCancel := upstreams[ip]; upstreamCancel != nil {
+				upstreamCancel()
+				delete(upstreams, ip)
+			}
+		case event := <-events:
+			if event.Version <= delivered[event.Key] {
+				continue
+			}
+			delivered[event.Key] = event.Version
+
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// The nodes holding a watch's keys: the owner of a single key, or every node for a prefix.
+func (chordServer *ChordServer) watchTargets(ctx context.Context, request *pb.WatchRequest) (map[string]bool, error) {
+	targets := make(map[string]bool)
+
+	if !request.Prefix {
+		ipMsg, err := chordServer.lookup(ctx, hash(request.Key, chordServer.Capacity))
+		if err != nil {
+			return nil, err
+		}
+
+		targets[ipMsg.Ip.Value] = true
+		return targets, nil
+	}
+
+	ring, err := chordServer.RingWalk(ctx, &emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range ring.Nodes {
+		if node.Reachable {
+			targets[node.Ip] = true
+		}
+	}
+
+	return targets, nil
+}
+
+func (chordServer *ChordServer) watchUpstream(ctx context.Context, ip string, request *pb.WatchRequest, events chan<- *pb.WatchEvent) error {
+	localRequest := &pb.WatchRequest{Key: request.Key, Prefix: request.Prefix, SinceVersion: request.SinceVersion, Local: true}
+
+	forward := func(event *pb.WatchEvent) error {
+		select {
+		case events <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if ip == chordServer.IP {
+		return chordServer.watchLocal(ctx, localRequest, forward)
+	}
+
+	node, err := Connect(ip)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	stream, err := node.WatchClient.Watch(ctx, localRequest)
+	if err != nil {
+		return err
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		if err = forward(event); err != nil {
+			return err
+		}
+	}
+}
+
+// Watch HTTP endpoint (Server-Sent Events)
+
+type watchEventJSON struct {
+	Type        string `json:"type"`
+	Key         string `json:"key"`
+	Version     uint64 `json:"version"`
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// GET /watch?key=K[&prefix=true][&since=VERSION]; a reconnecting client's Last-Event-ID takes the place of since.
+func (chordServer *ChordServer) ServeWatch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request := &pb.WatchRequest{Key: query.Get("key"), Prefix: query.Get("prefix") == "true"}
+
+	if request.Key == "" && !request.Prefix {
+		http.Error(w, http.StatusText(http.StatusBadRequest)+": No key provided.", http.StatusBadRequest)
+		return
+	}
+
+	since := query.Get("since")
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		since = lastEventID
+	}
+	if since != "" {
+		var err error
+		request.SinceVersion, err = strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest)+": invalid version.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	controller := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	err := chordServer.watchRing(r.Context(), request, func(event *pb.WatchEvent) error {
+		eventJSON := watchEventJSON{Type: strings.ToLower(event.Type.String()), Key: event.Key, Version: event.Version}
+		if event.Value != nil {
+			eventJSON.Value = event.Value.Data
+			eventJSON.ContentType = event.Value.ContentType
+		}
+
+		eventBytes, err := json.Marshal(eventJSON)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Version, eventJSON.Type, eventBytes)
+		if err != nil {
+			return err
+		}
+		return controller.Flush()
+	})
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		logger.Debug("Watch stream ended", "key", request.Key, "err", err)
+	}
+}
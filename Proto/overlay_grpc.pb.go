@@ -146,6 +146,7 @@ var Predecessor_ServiceDesc = grpc.ServiceDesc{
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LookupClient interface {
 	FindSuccessor(ctx context.Context, in *Hash, opts ...grpc.CallOption) (*IP, error)
+	FindSuccessors(ctx context.Context, in *Hashes, opts ...grpc.CallOption) (*Owners, error)
 }
 
 type lookupClient struct {
@@ -165,11 +166,21 @@ func (c *lookupClient) FindSuccessor(ctx context.Context, in *Hash, opts ...grpc
 	return out, nil
 }
 
+func (c *lookupClient) FindSuccessors(ctx context.Context, in *Hashes, opts ...grpc.CallOption) (*Owners, error) {
+	out := new(Owners)
+	err := c.cc.Invoke(ctx, "/overlay.Lookup/findSuccessors", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LookupServer is the server API for Lookup service.
 // All implementations must embed UnimplementedLookupServer
 // for forward compatibility
 type LookupServer interface {
 	FindSuccessor(context.Context, *Hash) (*IP, error)
+	FindSuccessors(context.Context, *Hashes) (*Owners, error)
 	mustEmbedUnimplementedLookupServer()
 }
 
@@ -180,6 +191,9 @@ type UnimplementedLookupServer struct {
 func (UnimplementedLookupServer) FindSuccessor(context.Context, *Hash) (*IP, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method FindSuccessor not implemented")
 }
+func (UnimplementedLookupServer) FindSuccessors(context.Context, *Hashes) (*Owners, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindSuccessors not implemented")
+}
 func (UnimplementedLookupServer) mustEmbedUnimplementedLookupServer() {}
 
 // UnsafeLookupServer may be embedded to opt out of forward compatibility for this service.
@@ -211,6 +225,24 @@ func _Lookup_FindSuccessor_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Lookup_FindSuccessors_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Hashes)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LookupServer).FindSuccessors(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Lookup/findSuccessors",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LookupServer).FindSuccessors(ctx, req.(*Hashes))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Lookup_ServiceDesc is the grpc.ServiceDesc for Lookup service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -222,6 +254,10 @@ var Lookup_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "findSuccessor",
 			Handler:    _Lookup_FindSuccessor_Handler,
 		},
+		{
+			MethodName: "findSuccessors",
+			Handler:    _Lookup_FindSuccessors_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "Proto/overlay.proto",
@@ -318,6 +354,11 @@ var Check_ServiceDesc = grpc.ServiceDesc{
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type DataClient interface {
 	TransferData(ctx context.Context, in *KVMap, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetValues(ctx context.Context, in *Keys, opts ...grpc.CallOption) (*KVMap, error)
+	PutValues(ctx context.Context, in *KVMap, opts ...grpc.CallOption) (*WriteResults, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanPage, error)
+	Replicate(ctx context.Context, in *Mutations, opts ...grpc.CallOption) (*WriteResults, error)
+	Purge(ctx context.Context, in *Mutations, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type dataClient struct {
@@ -337,11 +378,61 @@ func (c *dataClient) TransferData(ctx context.Context, in *KVMap, opts ...grpc.C
 	return out, nil
 }
 
+func (c *dataClient) GetValues(ctx context.Context, in *Keys, opts ...grpc.CallOption) (*KVMap, error) {
+	out := new(KVMap)
+	err := c.cc.Invoke(ctx, "/overlay.Data/getValues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataClient) PutValues(ctx context.Context, in *KVMap, opts ...grpc.CallOption) (*WriteResults, error) {
+	out := new(WriteResults)
+	err := c.cc.Invoke(ctx, "/overlay.Data/putValues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanPage, error) {
+	out := new(ScanPage)
+	err := c.cc.Invoke(ctx, "/overlay.Data/scan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataClient) Replicate(ctx context.Context, in *Mutations, opts ...grpc.CallOption) (*WriteResults, error) {
+	out := new(WriteResults)
+	err := c.cc.Invoke(ctx, "/overlay.Data/replicate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataClient) Purge(ctx context.Context, in *Mutations, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Data/purge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DataServer is the server API for Data service.
 // All implementations must embed UnimplementedDataServer
 // for forward compatibility
 type DataServer interface {
 	TransferData(context.Context, *KVMap) (*emptypb.Empty, error)
+	GetValues(context.Context, *Keys) (*KVMap, error)
+	PutValues(context.Context, *KVMap) (*WriteResults, error)
+	Scan(context.Context, *ScanRequest) (*ScanPage, error)
+	Replicate(context.Context, *Mutations) (*WriteResults, error)
+	Purge(context.Context, *Mutations) (*emptypb.Empty, error)
 	mustEmbedUnimplementedDataServer()
 }
 
@@ -352,6 +443,21 @@ type UnimplementedDataServer struct {
 func (UnimplementedDataServer) TransferData(context.Context, *KVMap) (*emptypb.Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method TransferData not implemented")
 }
+func (UnimplementedDataServer) GetValues(context.Context, *Keys) (*KVMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetValues not implemented")
+}
+func (UnimplementedDataServer) PutValues(context.Context, *KVMap) (*WriteResults, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutValues not implemented")
+}
+func (UnimplementedDataServer) Scan(context.Context, *ScanRequest) (*ScanPage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedDataServer) Replicate(context.Context, *Mutations) (*WriteResults, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Replicate not implemented")
+}
+func (UnimplementedDataServer) Purge(context.Context, *Mutations) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
 func (UnimplementedDataServer) mustEmbedUnimplementedDataServer() {}
 
 // UnsafeDataServer may be embedded to opt out of forward compatibility for this service.
@@ -383,6 +489,96 @@ func _Data_TransferData_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Data_GetValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Keys)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServer).GetValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Data/getValues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServer).GetValues(ctx, req.(*Keys))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Data_PutValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVMap)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServer).PutValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Data/putValues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServer).PutValues(ctx, req.(*KVMap))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Data_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Data/scan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Data_Replicate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Mutations)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServer).Replicate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Data/replicate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServer).Replicate(ctx, req.(*Mutations))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Data_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Mutations)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Data/purge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataServer).Purge(ctx, req.(*Mutations))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Data_ServiceDesc is the grpc.ServiceDesc for Data service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -394,6 +590,1259 @@ var Data_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "transferData",
 			Handler:    _Data_TransferData_Handler,
 		},
+		{
+			MethodName: "getValues",
+			Handler:    _Data_GetValues_Handler,
+		},
+		{
+			MethodName: "putValues",
+			Handler:    _Data_PutValues_Handler,
+		},
+		{
+			MethodName: "scan",
+			Handler:    _Data_Scan_Handler,
+		},
+		{
+			MethodName: "replicate",
+			Handler:    _Data_Replicate_Handler,
+		},
+		{
+			MethodName: "purge",
+			Handler:    _Data_Purge_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "Proto/overlay.proto",
+}
+
+// ChainClient is the client API for Chain service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChainClient interface {
+	ChainWrite(ctx context.Context, in *ChainWriteRequest, opts ...grpc.CallOption) (*WriteResult, error)
+}
+
+type chainClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChainClient(cc grpc.ClientConnInterface) ChainClient {
+	return &chainClient{cc}
+}
+
+func (c *chainClient) ChainWrite(ctx context.Context, in *ChainWriteRequest, opts ...grpc.CallOption) (*WriteResult, error) {
+	out := new(WriteResult)
+	err := c.cc.Invoke(ctx, "/overlay.Chain/chainWrite", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChainServer is the server API for Chain service.
+// All implementations must embed UnimplementedChainServer
+// for forward compatibility
+type ChainServer interface {
+	ChainWrite(context.Context, *ChainWriteRequest) (*WriteResult, error)
+	mustEmbedUnimplementedChainServer()
+}
+
+// UnimplementedChainServer must be embedded to have forward compatible implementations.
+type UnimplementedChainServer struct {
+}
+
+func (UnimplementedChainServer) ChainWrite(context.Context, *ChainWriteRequest) (*WriteResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChainWrite not implemented")
+}
+func (UnimplementedChainServer) mustEmbedUnimplementedChainServer() {}
+
+// UnsafeChainServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChainServer will
+// result in compilation errors.
+type UnsafeChainServer interface {
+	mustEmbedUnimplementedChainServer()
+}
+
+func RegisterChainServer(s grpc.ServiceRegistrar, srv ChainServer) {
+	s.RegisterService(&Chain_ServiceDesc, srv)
+}
+
+func _Chain_ChainWrite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChainWriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChainServer).ChainWrite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Chain/chainWrite",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChainServer).ChainWrite(ctx, req.(*ChainWriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Chain_ServiceDesc is the grpc.ServiceDesc for Chain service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Chain_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.Chain",
+	HandlerType: (*ChainServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "chainWrite",
+			Handler:    _Chain_ChainWrite_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "Proto/overlay.proto",
+}
+
+// AntiEntropyClient is the client API for AntiEntropy service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AntiEntropyClient interface {
+	MerkleNodes(ctx context.Context, in *MerkleRequest, opts ...grpc.CallOption) (*MerkleHashes, error)
+	LeafVersions(ctx context.Context, in *MerkleRequest, opts ...grpc.CallOption) (AntiEntropy_LeafVersionsClient, error)
+}
+
+type antiEntropyClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAntiEntropyClient(cc grpc.ClientConnInterface) AntiEntropyClient {
+	return &antiEntropyClient{cc}
+}
+
+func (c *antiEntropyClient) MerkleNodes(ctx context.Context, in *MerkleRequest, opts ...grpc.CallOption) (*MerkleHashes, error) {
+	out := new(MerkleHashes)
+	err := c.cc.Invoke(ctx, "/overlay.AntiEntropy/merkleNodes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *antiEntropyClient) LeafVersions(ctx context.Context, in *MerkleRequest, opts ...grpc.CallOption) (AntiEntropy_LeafVersionsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AntiEntropy_ServiceDesc.Streams[0], "/overlay.AntiEntropy/leafVersions", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &antiEntropyLeafVersionsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AntiEntropy_LeafVersionsClient interface {
+	Recv() (*KeyVersion, error)
+	grpc.ClientStream
+}
+
+type antiEntropyLeafVersionsClient struct {
+	grpc.ClientStream
+}
+
+func (x *antiEntropyLeafVersionsClient) Recv() (*KeyVersion, error) {
+	m := new(KeyVersion)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AntiEntropyServer is the server API for AntiEntropy service.
+// All implementations must embed UnimplementedAntiEntropyServer
+// for forward compatibility
+type AntiEntropyServer interface {
+	MerkleNodes(context.Context, *MerkleRequest) (*MerkleHashes, error)
+	LeafVersions(*MerkleRequest, AntiEntropy_LeafVersionsServer) error
+	mustEmbedUnimplementedAntiEntropyServer()
+}
+
+// UnimplementedAntiEntropyServer must be embedded to have forward compatible implementations.
+type UnimplementedAntiEntropyServer struct {
+}
+
+func (UnimplementedAntiEntropyServer) MerkleNodes(context.Context, *MerkleRequest) (*MerkleHashes, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MerkleNodes not implemented")
+}
+func (UnimplementedAntiEntropyServer) LeafVersions(*MerkleRequest, AntiEntropy_LeafVersionsServer) error {
+	return status.Errorf(codes.Unimplemented, "method LeafVersions not implemented")
+}
+func (UnimplementedAntiEntropyServer) mustEmbedUnimplementedAntiEntropyServer() {}
+
+// UnsafeAntiEntropyServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AntiEntropyServer will
+// result in compilation errors.
+type UnsafeAntiEntropyServer interface {
+	mustEmbedUnimplementedAntiEntropyServer()
+}
+
+func RegisterAntiEntropyServer(s grpc.ServiceRegistrar, srv AntiEntropyServer) {
+	s.RegisterService(&AntiEntropy_ServiceDesc, srv)
+}
+
+func _AntiEntropy_MerkleNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MerkleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AntiEntropyServer).MerkleNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.AntiEntropy/merkleNodes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AntiEntropyServer).MerkleNodes(ctx, req.(*MerkleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AntiEntropy_LeafVersions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MerkleRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AntiEntropyServer).LeafVersions(m, &antiEntropyLeafVersionsServer{stream})
+}
+
+type AntiEntropy_LeafVersionsServer interface {
+	Send(*KeyVersion) error
+	grpc.ServerStream
+}
+
+type antiEntropyLeafVersionsServer struct {
+	grpc.ServerStream
+}
+
+func (x *antiEntropyLeafVersionsServer) Send(m *KeyVersion) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// AntiEntropy_ServiceDesc is the grpc.ServiceDesc for AntiEntropy service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AntiEntropy_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.AntiEntropy",
+	HandlerType: (*AntiEntropyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "merkleNodes",
+			Handler:    _AntiEntropy_MerkleNodes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "leafVersions",
+			Handler:       _AntiEntropy_LeafVersions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "Proto/overlay.proto",
+}
+
+// GossipClient is the client API for Gossip service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GossipClient interface {
+	Ping(ctx context.Context, in *GossipMessage, opts ...grpc.CallOption) (*GossipMessage, error)
+	PingRequest(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*GossipMessage, error)
+}
+
+type gossipClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGossipClient(cc grpc.ClientConnInterface) GossipClient {
+	return &gossipClient{cc}
+}
+
+func (c *gossipClient) Ping(ctx context.Context, in *GossipMessage, opts ...grpc.CallOption) (*GossipMessage, error) {
+	out := new(GossipMessage)
+	err := c.cc.Invoke(ctx, "/overlay.Gossip/ping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gossipClient) PingRequest(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*GossipMessage, error) {
+	out := new(GossipMessage)
+	err := c.cc.Invoke(ctx, "/overlay.Gossip/pingRequest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GossipServer is the server API for Gossip service.
+// All implementations must embed UnimplementedGossipServer
+// for forward compatibility
+type GossipServer interface {
+	Ping(context.Context, *GossipMessage) (*GossipMessage, error)
+	PingRequest(context.Context, *PingRequest) (*GossipMessage, error)
+	mustEmbedUnimplementedGossipServer()
+}
+
+// UnimplementedGossipServer must be embedded to have forward compatible implementations.
+type UnimplementedGossipServer struct {
+}
+
+func (UnimplementedGossipServer) Ping(context.Context, *GossipMessage) (*GossipMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedGossipServer) PingRequest(context.Context, *PingRequest) (*GossipMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PingRequest not implemented")
+}
+func (UnimplementedGossipServer) mustEmbedUnimplementedGossipServer() {}
+
+// UnsafeGossipServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GossipServer will
+// result in compilation errors.
+type UnsafeGossipServer interface {
+	mustEmbedUnimplementedGossipServer()
+}
+
+func RegisterGossipServer(s grpc.ServiceRegistrar, srv GossipServer) {
+	s.RegisterService(&Gossip_ServiceDesc, srv)
+}
+
+func _Gossip_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GossipMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GossipServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Gossip/ping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GossipServer).Ping(ctx, req.(*GossipMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gossip_PingRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GossipServer).PingRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Gossip/pingRequest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GossipServer).PingRequest(ctx, req.(*PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Gossip_ServiceDesc is the grpc.ServiceDesc for Gossip service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gossip_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.Gossip",
+	HandlerType: (*GossipServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ping",
+			Handler:    _Gossip_Ping_Handler,
+		},
+		{
+			MethodName: "pingRequest",
+			Handler:    _Gossip_PingRequest_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "Proto/overlay.proto",
+}
+
+// TopologyClient is the client API for Topology service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TopologyClient interface {
+	NodeInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NodeInfo, error)
+	RingWalk(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Ring, error)
+}
+
+type topologyClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTopologyClient(cc grpc.ClientConnInterface) TopologyClient {
+	return &topologyClient{cc}
+}
+
+func (c *topologyClient) NodeInfo(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NodeInfo, error) {
+	out := new(NodeInfo)
+	err := c.cc.Invoke(ctx, "/overlay.Topology/nodeInfo", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *topologyClient) RingWalk(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Ring, error) {
+	out := new(Ring)
+	err := c.cc.Invoke(ctx, "/overlay.Topology/ringWalk", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TopologyServer is the server API for Topology service.
+// All implementations must embed UnimplementedTopologyServer
+// for forward compatibility
+type TopologyServer interface {
+	NodeInfo(context.Context, *emptypb.Empty) (*NodeInfo, error)
+	RingWalk(context.Context, *emptypb.Empty) (*Ring, error)
+	mustEmbedUnimplementedTopologyServer()
+}
+
+// UnimplementedTopologyServer must be embedded to have forward compatible implementations.
+type UnimplementedTopologyServer struct {
+}
+
+func (UnimplementedTopologyServer) NodeInfo(context.Context, *emptypb.Empty) (*NodeInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NodeInfo not implemented")
+}
+func (UnimplementedTopologyServer) RingWalk(context.Context, *emptypb.Empty) (*Ring, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RingWalk not implemented")
+}
+func (UnimplementedTopologyServer) mustEmbedUnimplementedTopologyServer() {}
+
+// UnsafeTopologyServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TopologyServer will
+// result in compilation errors.
+type UnsafeTopologyServer interface {
+	mustEmbedUnimplementedTopologyServer()
+}
+
+func RegisterTopologyServer(s grpc.ServiceRegistrar, srv TopologyServer) {
+	s.RegisterService(&Topology_ServiceDesc, srv)
+}
+
+func _Topology_NodeInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopologyServer).NodeInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Topology/nodeInfo",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopologyServer).NodeInfo(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Topology_RingWalk_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopologyServer).RingWalk(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Topology/ringWalk",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopologyServer).RingWalk(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Topology_ServiceDesc is the grpc.ServiceDesc for Topology service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Topology_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.Topology",
+	HandlerType: (*TopologyServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "nodeInfo",
+			Handler:    _Topology_NodeInfo_Handler,
+		},
+		{
+			MethodName: "ringWalk",
+			Handler:    _Topology_RingWalk_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "Proto/overlay.proto",
+}
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	GetState(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NodeState, error)
+	TriggerStabilize(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	TriggerFixFingers(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	PauseMaintenance(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ResumeMaintenance(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	ForceLeave(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Evict(ctx context.Context, in *IP, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	GetLogLevels(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LogLevels, error)
+	SetLogLevel(ctx context.Context, in *LogLevel, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) GetState(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*NodeState, error) {
+	out := new(NodeState)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/getState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TriggerStabilize(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/triggerStabilize", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TriggerFixFingers(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/triggerFixFingers", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PauseMaintenance(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/pauseMaintenance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ResumeMaintenance(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/resumeMaintenance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ForceLeave(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/forceLeave", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Evict(ctx context.Context, in *IP, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/evict", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetLogLevels(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*LogLevels, error) {
+	out := new(LogLevels)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/getLogLevels", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetLogLevel(ctx context.Context, in *LogLevel, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/overlay.Admin/setLogLevel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	GetState(context.Context, *emptypb.Empty) (*NodeState, error)
+	TriggerStabilize(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	TriggerFixFingers(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	PauseMaintenance(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	ResumeMaintenance(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	ForceLeave(context.Context, *emptypb.Empty) (*emptypb.Empty, error)
+	Evict(context.Context, *IP) (*emptypb.Empty, error)
+	GetLogLevels(context.Context, *emptypb.Empty) (*LogLevels, error)
+	SetLogLevel(context.Context, *LogLevel) (*emptypb.Empty, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) GetState(context.Context, *emptypb.Empty) (*NodeState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedAdminServer) TriggerStabilize(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerStabilize not implemented")
+}
+func (UnimplementedAdminServer) TriggerFixFingers(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerFixFingers not implemented")
+}
+func (UnimplementedAdminServer) PauseMaintenance(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseMaintenance not implemented")
+}
+func (UnimplementedAdminServer) ResumeMaintenance(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResumeMaintenance not implemented")
+}
+func (UnimplementedAdminServer) ForceLeave(context.Context, *emptypb.Empty) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ForceLeave not implemented")
+}
+func (UnimplementedAdminServer) Evict(context.Context, *IP) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Evict not implemented")
+}
+func (UnimplementedAdminServer) GetLogLevels(context.Context, *emptypb.Empty) (*LogLevels, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLogLevels not implemented")
+}
+func (UnimplementedAdminServer) SetLogLevel(context.Context, *LogLevel) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLogLevel not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/getState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetState(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TriggerStabilize_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TriggerStabilize(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/triggerStabilize",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TriggerStabilize(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TriggerFixFingers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TriggerFixFingers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/triggerFixFingers",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TriggerFixFingers(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PauseMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PauseMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/pauseMaintenance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PauseMaintenance(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ResumeMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ResumeMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/resumeMaintenance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ResumeMaintenance(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ForceLeave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ForceLeave(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/forceLeave",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ForceLeave(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Evict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IP)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Evict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/evict",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Evict(ctx, req.(*IP))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetLogLevels_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetLogLevels(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/getLogLevels",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetLogLevels(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetLogLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LogLevel)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetLogLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.Admin/setLogLevel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetLogLevel(ctx, req.(*LogLevel))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "getState",
+			Handler:    _Admin_GetState_Handler,
+		},
+		{
+			MethodName: "triggerStabilize",
+			Handler:    _Admin_TriggerStabilize_Handler,
+		},
+		{
+			MethodName: "triggerFixFingers",
+			Handler:    _Admin_TriggerFixFingers_Handler,
+		},
+		{
+			MethodName: "pauseMaintenance",
+			Handler:    _Admin_PauseMaintenance_Handler,
+		},
+		{
+			MethodName: "resumeMaintenance",
+			Handler:    _Admin_ResumeMaintenance_Handler,
+		},
+		{
+			MethodName: "forceLeave",
+			Handler:    _Admin_ForceLeave_Handler,
+		},
+		{
+			MethodName: "evict",
+			Handler:    _Admin_Evict_Handler,
+		},
+		{
+			MethodName: "getLogLevels",
+			Handler:    _Admin_GetLogLevels_Handler,
+		},
+		{
+			MethodName: "setLogLevel",
+			Handler:    _Admin_SetLogLevel_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "Proto/overlay.proto",
+}
+
+// WatchClient is the client API for Watch service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type WatchClient interface {
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Watch_WatchClient, error)
+}
+
+type watchClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWatchClient(cc grpc.ClientConnInterface) WatchClient {
+	return &watchClient{cc}
+}
+
+func (c *watchClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Watch_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Watch_ServiceDesc.Streams[0], "/overlay.Watch/watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &watchWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Watch_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type watchWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *watchWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WatchServer is the server API for Watch service.
+// All implementations must embed UnimplementedWatchServer
+// for forward compatibility
+type WatchServer interface {
+	Watch(*WatchRequest, Watch_WatchServer) error
+	mustEmbedUnimplementedWatchServer()
+}
+
+// UnimplementedWatchServer must be embedded to have forward compatible implementations.
+type UnimplementedWatchServer struct {
+}
+
+func (UnimplementedWatchServer) Watch(*WatchRequest, Watch_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedWatchServer) mustEmbedUnimplementedWatchServer() {}
+
+// UnsafeWatchServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to WatchServer will
+// result in compilation errors.
+type UnsafeWatchServer interface {
+	mustEmbedUnimplementedWatchServer()
+}
+
+func RegisterWatchServer(s grpc.ServiceRegistrar, srv WatchServer) {
+	s.RegisterService(&Watch_ServiceDesc, srv)
+}
+
+func _Watch_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(WatchServer).Watch(m, &watchWatchServer{stream})
+}
+
+type Watch_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type watchWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *watchWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Watch_ServiceDesc is the grpc.ServiceDesc for Watch service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Watch_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.Watch",
+	HandlerType: (*WatchServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "watch",
+			Handler:       _Watch_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "Proto/overlay.proto",
+}
+
+// KVClient is the client API for KV service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KVClient interface {
+	Get(ctx context.Context, in *KVKey, opts ...grpc.CallOption) (*Value, error)
+	Put(ctx context.Context, in *KVPutRequest, opts ...grpc.CallOption) (*WriteResult, error)
+	Delete(ctx context.Context, in *KVDeleteRequest, opts ...grpc.CallOption) (*WriteResult, error)
+	BatchGet(ctx context.Context, in *KVBatchGetRequest, opts ...grpc.CallOption) (*KVBatchGetResponse, error)
+	BatchPut(ctx context.Context, in *KVBatchPutRequest, opts ...grpc.CallOption) (*WriteResults, error)
+	Scan(ctx context.Context, in *KVScanRequest, opts ...grpc.CallOption) (*KVScanResponse, error)
+}
+
+type kVClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKVClient(cc grpc.ClientConnInterface) KVClient {
+	return &kVClient{cc}
+}
+
+func (c *kVClient) Get(ctx context.Context, in *KVKey, opts ...grpc.CallOption) (*Value, error) {
+	out := new(Value)
+	err := c.cc.Invoke(ctx, "/overlay.KV/get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) Put(ctx context.Context, in *KVPutRequest, opts ...grpc.CallOption) (*WriteResult, error) {
+	out := new(WriteResult)
+	err := c.cc.Invoke(ctx, "/overlay.KV/put", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) Delete(ctx context.Context, in *KVDeleteRequest, opts ...grpc.CallOption) (*WriteResult, error) {
+	out := new(WriteResult)
+	err := c.cc.Invoke(ctx, "/overlay.KV/delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) BatchGet(ctx context.Context, in *KVBatchGetRequest, opts ...grpc.CallOption) (*KVBatchGetResponse, error) {
+	out := new(KVBatchGetResponse)
+	err := c.cc.Invoke(ctx, "/overlay.KV/batchGet", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) BatchPut(ctx context.Context, in *KVBatchPutRequest, opts ...grpc.CallOption) (*WriteResults, error) {
+	out := new(WriteResults)
+	err := c.cc.Invoke(ctx, "/overlay.KV/batchPut", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) Scan(ctx context.Context, in *KVScanRequest, opts ...grpc.CallOption) (*KVScanResponse, error) {
+	out := new(KVScanResponse)
+	err := c.cc.Invoke(ctx, "/overlay.KV/scan", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KVServer is the server API for KV service.
+// All implementations must embed UnimplementedKVServer
+// for forward compatibility
+type KVServer interface {
+	Get(context.Context, *KVKey) (*Value, error)
+	Put(context.Context, *KVPutRequest) (*WriteResult, error)
+	Delete(context.Context, *KVDeleteRequest) (*WriteResult, error)
+	BatchGet(context.Context, *KVBatchGetRequest) (*KVBatchGetResponse, error)
+	BatchPut(context.Context, *KVBatchPutRequest) (*WriteResults, error)
+	Scan(context.Context, *KVScanRequest) (*KVScanResponse, error)
+	mustEmbedUnimplementedKVServer()
+}
+
+// UnimplementedKVServer must be embedded to have forward compatible implementations.
+type UnimplementedKVServer struct {
+}
+
+func (UnimplementedKVServer) Get(context.Context, *KVKey) (*Value, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedKVServer) Put(context.Context, *KVPutRequest) (*WriteResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedKVServer) Delete(context.Context, *KVDeleteRequest) (*WriteResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKVServer) BatchGet(context.Context, *KVBatchGetRequest) (*KVBatchGetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchGet not implemented")
+}
+func (UnimplementedKVServer) BatchPut(context.Context, *KVBatchPutRequest) (*WriteResults, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchPut not implemented")
+}
+func (UnimplementedKVServer) Scan(context.Context, *KVScanRequest) (*KVScanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedKVServer) mustEmbedUnimplementedKVServer() {}
+
+// UnsafeKVServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KVServer will
+// result in compilation errors.
+type UnsafeKVServer interface {
+	mustEmbedUnimplementedKVServer()
+}
+
+func RegisterKVServer(s grpc.ServiceRegistrar, srv KVServer) {
+	s.RegisterService(&KV_ServiceDesc, srv)
+}
+
+func _KV_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.KV/get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Get(ctx, req.(*KVKey))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVPutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.KV/put",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Put(ctx, req.(*KVPutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.KV/delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Delete(ctx, req.(*KVDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_BatchGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVBatchGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).BatchGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.KV/batchGet",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).BatchGet(ctx, req.(*KVBatchGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_BatchPut_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVBatchPutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).BatchPut(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.KV/batchPut",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).BatchPut(ctx, req.(*KVBatchPutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KVScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/overlay.KV/scan",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Scan(ctx, req.(*KVScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KV_ServiceDesc is the grpc.ServiceDesc for KV service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KV_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "overlay.KV",
+	HandlerType: (*KVServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "get",
+			Handler:    _KV_Get_Handler,
+		},
+		{
+			MethodName: "put",
+			Handler:    _KV_Put_Handler,
+		},
+		{
+			MethodName: "delete",
+			Handler:    _KV_Delete_Handler,
+		},
+		{
+			MethodName: "batchGet",
+			Handler:    _KV_BatchGet_Handler,
+		},
+		{
+			MethodName: "batchPut",
+			Handler:    _KV_BatchPut_Handler,
+		},
+		{
+			MethodName: "scan",
+			Handler:    _KV_Scan_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "Proto/overlay.proto",
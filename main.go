@@ -1,21 +1,28 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 
+	data "github.com/girivad/go-chord/Data"
+	logging "github.com/girivad/go-chord/Logging"
 	overlay "github.com/girivad/go-chord/Overlay"
+	tracing "github.com/girivad/go-chord/Tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var logger = logging.Logger(logging.Overlay)
+
 func main() {
 	// Read cmdline args (ip + contact address if joining an existing chord ring)
 	// contactPtr := flag.String("contact", "None", "IP address of a contact in a Chord Ring you want to join.")
 	// flag.Parse()
 
 	if len(os.Args) < 4 {
-		log.Println("Please provide this node's IP address and the capacity of its chord ring.")
+		fmt.Println("Please provide this node's IP address and the capacity of its chord ring.")
 		os.Exit(1)
 	}
 
@@ -29,42 +36,134 @@ func main() {
 
 	contact := os.Args[3]
 
+	// Optional flags follow the positional arguments.
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	gossip := flags.Bool("gossip", false, "Enable SWIM-style gossip membership alongside the Chord ring.")
+	logLevel := flags.String("log-level", "info", "Log level for every subsystem (debug, info, warn, error), or subsystem=level pairs, e.g. overlay=debug,keyindex=warn.")
+	logFormat := flags.String("log-format", "text", "Log format: text or json.")
+	logValues := flags.Bool("log-values", false, "Include stored values in logs instead of redacting them.")
+	traceExporter := flags.String("trace-exporter", "none", "Trace exporter: none, stdout, file or otlp.")
+	traceEndpoint := flags.String("trace-endpoint", "", "OTLP collector host:port for the otlp exporter, or output path for the file exporter.")
+	backend := flags.String("store", "", "Storage backend: memory, disk or cache. Defaults to disk when -data-dir is set, memory otherwise.")
+	dataDir := flags.String("data-dir", "", "Directory for the disk backend's write-ahead log and snapshots.")
+	fsync := flags.String("fsync", "always", "When the disk backend fsyncs its write-ahead log: always, interval or never.")
+	cacheBytes := flags.Uint64("cache-bytes", 64<<20, "Size limit of the cache backend, in bytes.")
+	replication := flags.String("replication", overlay.QuorumReplication, "Replication mode for keys: quorum or chain, optionally followed by prefix=mode pairs, e.g. quorum,orders/=chain.")
+	antiEntropyInterval := flags.Duration("anti-entropy-interval", overlay.DefaultAntiEntropyInterval, "Time between anti-entropy rounds with the replicas of this node's keys; 0 disables anti-entropy.")
+	antiEntropyBandwidth := flags.Uint64("anti-entropy-bandwidth", 0, "Bytes per second anti-entropy may send or fetch; 0 for no limit.")
+	hintBytes := flags.Uint64("hint-bytes", overlay.DefaultHintBytes, "Size limit of the writes kept for unreachable replicas, in bytes.")
+	hintTTL := flags.Duration("hint-ttl", overlay.DefaultHintTTL, "How long writes for an unreachable replica are kept for it.")
+	tombstoneGrace := flags.Duration("tombstone-grace", overlay.DefaultTombstoneGrace, "How long delete tombstones are kept before being purged; keep it above -hint-ttl.")
+	respPort := flags.Int("resp-port", 0, "Port of the Redis protocol (RESP) listener, e.g. 6379; 0 disables it.")
+	respCluster := flags.Bool("resp-cluster", false, "Answer Redis commands for keys owned by other nodes with MOVED redirects instead of forwarding them.")
+	replicas := flags.Int("replicas", overlay.DefaultReplicas, "Replication factor N of requests that set a Consistency header without a Replicas header.")
+	flags.Parse(os.Args[4:])
+
+	if err := logging.SetLevels(*logLevel); err != nil {
+		fmt.Println("Error Reading Log Level:", err)
+		os.Exit(1)
+	}
+	logging.ShowValues(*logValues)
+
+	fsyncPolicy, err := data.ParseFsyncPolicy(*fsync)
+	if err != nil {
+		fmt.Println("Error Reading Fsync Policy:", err)
+		os.Exit(1)
+	}
+
 	// TO-DO: Implement IP Verification (verify that this is a valid IP address, at least via Regex)
 
 	// Create a new ChordNode and join an existing chord ring if requested.
 	chordServer, err := overlay.NewChordServer(ip, (uint64)(capacity))
 
 	if err != nil {
-		log.Printf("[FATAL] Failed to connect to self.")
+		logger.Error("Failed to connect to self", "err", err)
+		os.Exit(1)
+	}
+
+	if err := chordServer.SetReplicas(*replicas); err != nil {
+		fmt.Println("Error Reading Replicas:", err)
+		os.Exit(1)
+	}
+
+	replicationPolicy, err := overlay.ParseReplicationPolicy(*replication)
+	if err != nil {
+		fmt.Println("Error Reading Replication Mode:", err)
 		os.Exit(1)
 	}
+	chordServer.SetReplicationPolicy(replicationPolicy)
+	chordServer.SetHintedHandoff(*hintBytes, *hintTTL)
+	chordServer.SetTombstoneGrace(*tombstoneGrace)
+	chordServer.SetRESP(overlay.RESPOptions{Port: *respPort, Cluster: *respCluster})
+	chordServer.SetAntiEntropy(overlay.AntiEntropyOptions{Interval: *antiEntropyInterval, Bandwidth: *antiEntropyBandwidth})
+
+	logging.Configure(os.Stderr, *logFormat == "json", "node", ip, "node_id", chordServer.Hash)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), *traceExporter, *traceEndpoint, attribute.String("chord.node", ip))
+	if err != nil {
+		logger.Error("Failed to set up tracing", "err", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing(context.Background())
+
+	if *backend == "" && *dataDir != "" {
+		*backend = data.DiskBackend
+	}
 
-	if contact != "None" {
+	err = chordServer.OpenStore(data.StoreOptions{Backend: *backend, Dir: *dataDir, Fsync: fsyncPolicy, MaxBytes: *cacheBytes})
+	if err != nil {
+		logger.Error("Failed to open store", "backend", *backend, "err", err)
+		os.Exit(1)
+	}
+
+	if *gossip {
+		chordServer.EnableGossip()
+	}
+
+	var identity *overlay.Identity
+	if *dataDir != "" {
+		identity, err = chordServer.EnablePersistence(*dataDir)
+		if err != nil {
+			logger.Error("Failed to load node identity", "dir", *dataDir, "err", err)
+			os.Exit(1)
+		}
+	}
+
+	if identity != nil {
+		// Restarting: rejoin at the same position with the recovered keys.
+		err = chordServer.Rejoin(identity, contact)
+
+		if err != nil {
+			logger.Error("Failed to rejoin chord ring", "err", err)
+			os.Exit(1)
+		}
+	} else if contact == "None" {
+		chordServer.Create()
+	} else {
 		// Make a client for the contact, and then run a join service on it.
-		log.Printf("[INFO] Contact in the Chord Ring: %s", contact)
+		logger.Info("Contact in the Chord Ring", "contact", contact)
 		contactNode, err := overlay.Connect(contact)
 
 		if err != nil {
-			log.Println("Unable to connect to the contact in the Chord Ring:", err)
+			logger.Error("Unable to connect to the contact in the Chord Ring", "contact", contact, "err", err)
 			os.Exit(1)
 		}
 
 		err = chordServer.Join(contactNode)
 
 		if err != nil {
-			log.Println("Failed to join chord ring:", err)
+			logger.Error("Failed to join chord ring", "contact", contact, "err", err)
 			os.Exit(1)
 		}
 	}
 
-	// Serve data from 8080, gRPC through 8081.
-	go func() {
-		err = chordServer.Serve()
-		if err != nil {
-			log.Println("Failed to Serve Data/Services:", err)
-			os.Exit(1)
-		}
-	}()
+	// Serve data from 8080, gRPC through 8081. Serve returns once the node has left the ring.
+	err = chordServer.Serve()
+	if err != nil {
+		logger.Error("Failed to serve data/services", "err", err)
+		shutdownTracing(context.Background())
+		os.Exit(1)
+	}
 
-	select {}
+	logger.Info("Left the chord ring, exiting")
 }